@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Embed the time zone database so profile time zones validate on minimal images.
+	_ "time/tzdata"
 
 	"github.com/example/golang-rest-boilerplate/internal/config"
 	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
 	"github.com/example/golang-rest-boilerplate/internal/http/handlers"
 	"github.com/example/golang-rest-boilerplate/internal/http/router"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
 	"github.com/example/golang-rest-boilerplate/internal/repository"
 	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/cache"
 )
 
 func main() {
@@ -23,24 +37,133 @@ func main() {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
 
-	userRepo := repository.NewUserRepository(database)
-	authService := service.NewAuthService(userRepo, cfg)
-	userService := service.NewUserService(userRepo)
+	var userCache cache.StatsProvider
+	users := repository.NewUserRepository(database)
+	var userRepo repository.UserStore = users
+	if cfg.UserCacheSize > 0 {
+		cached := repository.NewCachedUserStore(userRepo, cache.NewLRU(cfg.UserCacheSize), time.Duration(cfg.UserCacheTTLSeconds)*time.Second)
+		userRepo, userCache = cached, cached
+	}
+
+	var (
+		identityRepo   repository.IdentityStore     = repository.NewIdentityRepository(database)
+		loginCodeRepo  repository.LoginCodeStore    = repository.NewLoginCodeRepository(database)
+		sessionRepo    repository.SessionStore      = repository.NewSessionRepository(database)
+		emailChanges   repository.EmailChangeStore  = repository.NewEmailChangeRepository(database)
+		jobRepo        repository.JobStore          = repository.NewJobRepository(database)
+		auditRepo      repository.AuditStore        = repository.NewAuditRepository(database)
+		webhookRepo    repository.WebhookStore      = repository.NewWebhookRepository(database)
+		orgRepo        repository.OrganizationStore = repository.NewOrganizationRepository(database)
+		invitationRepo repository.InvitationStore   = repository.NewInvitationRepository(database)
+		erasureRepo    repository.ErasureStore      = repository.NewErasureRepository(database)
+		transactor     repository.Transactor        = repository.NewGormTransactor(database)
+	)
+
+	queue := jobs.NewQueue(jobRepo)
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	auditService := service.NewAuditService(auditRepo)
+	auditService.Subscribe(bus)
+	authMetrics := service.NewAuthMetrics()
+	authMetrics.Subscribe(bus)
+	webhookService, err := service.NewWebhookService(webhookRepo, queue, transactor, cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize webhook service: %v", err)
+	}
+	webhookService.Subscribe(bus)
+	orgService := service.NewOrganizationService(orgRepo, transactor, auditService)
+	orgService.Subscribe(bus)
+	authService := service.NewAuthService(userRepo, identityRepo, loginCodeRepo, sessionRepo, orgRepo, transactor, auditService, bus, cfg)
+	identityService := service.NewIdentityService(userRepo, identityRepo, transactor, auditService, bus)
+	var userService service.UserManager = service.NewUserService(userRepo, transactor, bus)
+	var tokenIssuer service.TokenIssuer = authService
+
+	transport, err := mailer.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to configure mailer: %v", err)
+	}
+	mail := mailer.NewQueued(queue, cfg.MailMaxAttempts)
+	mailTemplates, err := mailer.NewTemplates()
+	if err != nil {
+		log.Fatalf("failed to load mail templates: %v", err)
+	}
+	invitationService := service.NewInvitationService(invitationRepo, orgRepo, userRepo, authService, transactor, mail, mailTemplates, auditService, cfg)
+	invitationService.Subscribe(bus)
+	transferService := service.NewUserTransferService(userRepo, transactor, auditService, bus)
+	privacyService := service.NewPrivacyService(userRepo, identityRepo, sessionRepo, loginCodeRepo, emailChanges, orgRepo, erasureRepo, queue, transactor, auditService, bus)
+
+	providers, err := oauth.NewRegistryFromConfig(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize oauth providers: %v", err)
+	}
 
-	var googleService *service.GoogleOAuthService
-	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
-		googleService = service.NewGoogleOAuthService(cfg)
+	providerTokens, err := service.NewProviderTokenService(identityRepo, providers, cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize provider token service: %v", err)
+	}
+
+	sessionCodec, err := oauth.NewSessionCodec(cfg.JWTSecret)
+	if err != nil {
+		log.Fatalf("failed to initialize oauth session codec: %v", err)
+	}
+
+	authHandler := handlers.NewAuthHandler(authService, identityService, invitationService, providerTokens, providers, sessionCodec, cfg)
+	userHandler := handlers.NewUserHandler(userService, service.NewUserSearchService(users), orgService)
+	accountService := service.NewAccountService(userRepo, identityRepo, sessionRepo, loginCodeRepo, emailChanges, transactor, auditService, bus)
+	accountService.Subscribe(bus)
+	emailChangeService := service.NewEmailChangeService(userRepo, emailChanges, transactor, mail, mailTemplates, auditService, bus, cfg)
+	meHandler := handlers.NewMeHandler(userService, accountService, emailChangeService, privacyService)
+	orgHandler := handlers.NewOrganizationHandler(orgService, invitationService)
+	adminHandler := handlers.NewAdminHandler(auditService, webhookService, authService, accountService, privacyService, transferService)
+	healthHandler := handlers.NewHealthHandler(userCache, authMetrics)
+
+	runner := jobs.NewRunner(jobRepo, jobs.Config{
+		Workers:      cfg.JobWorkers,
+		PollInterval: time.Duration(cfg.JobPollIntervalMS) * time.Millisecond,
+		LockTimeout:  time.Duration(cfg.JobLockTimeoutSeconds) * time.Second,
+		Retention:    time.Duration(cfg.JobRetentionHours) * time.Hour,
+	})
+	mailer.RegisterSendJob(runner, transport)
+	webhookService.RegisterJobs(runner)
+	privacyService.RegisterJobs(runner)
+	maintenanceService := service.NewMaintenanceService(sessionRepo, loginCodeRepo, emailChanges, transactor, auditService)
+	jobs.Handle(runner, service.PurgeExpiredJob, func(ctx context.Context, _ struct{}) error {
+		return maintenanceService.PurgeExpired(ctx)
+	})
+	if err := runner.Schedule("@hourly", service.PurgeExpiredJob, struct{}{}); err != nil {
+		log.Fatalf("failed to schedule jobs: %v", err)
 	}
 
-	authHandler := handlers.NewAuthHandler(authService, googleService)
-	userHandler := handlers.NewUserHandler(userService)
-	healthHandler := handlers.NewHealthHandler()
+	r := router.SetupRouter(authHandler, userHandler, meHandler, orgHandler, adminHandler, healthHandler, tokenIssuer, userService, orgService, cfg)
 
-	r := router.SetupRouter(authHandler, userHandler, healthHandler, authService, cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	addr := fmt.Sprintf(":%s", cfg.AppPort)
-	log.Printf("starting server on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("server error: %v", err)
+	if cfg.JobWorkers > 0 {
+		runner.Start()
+	}
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%s", cfg.AppPort), Handler: r}
+	go func() {
+		log.Printf("starting server on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	if cfg.JobWorkers > 0 {
+		if err := runner.Stop(shutdownCtx); err != nil {
+			log.Printf("job runner shutdown: %v", err)
+		}
+	}
+	if err := bus.Close(shutdownCtx); err != nil {
+		log.Printf("event bus shutdown: %v", err)
 	}
 }
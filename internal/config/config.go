@@ -9,15 +9,64 @@ import (
 
 // Config holds configuration values for the application.
 type Config struct {
-	AppPort            string   `env:"APP_PORT" default:"8080"`
-	DatabaseURL        string   `env:"DATABASE_URL" default:"postgres://postgres:postgres@db:5432/app?sslmode=disable"`
-	JWTSecret          string   `env:"JWT_SECRET" default:"change-me"`
-	JWTIssuer          string   `env:"JWT_ISSUER" default:"golang-rest-boilerplate"`
-	TokenExpireMinutes int      `env:"TOKEN_EXPIRE_MINUTES" default:"60"`
-	GoogleClientID     string   `env:"GOOGLE_CLIENT_ID"`
-	GoogleClientSecret string   `env:"GOOGLE_CLIENT_SECRET"`
-	GoogleRedirectURL  string   `env:"GOOGLE_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/google/callback"`
-	AllowedOrigins     []string `env:"ALLOWED_ORIGINS" default:"*"`
+	AppPort                     string   `envconfig:"APP_PORT" default:"8080"`
+	DBDriver                    string   `envconfig:"DB_DRIVER" default:"postgres"`
+	DatabaseURL                 string   `envconfig:"DATABASE_URL" default:"postgres://postgres:postgres@db:5432/app?sslmode=disable"`
+	DBMaxOpenConns              int      `envconfig:"DB_MAX_OPEN_CONNS" default:"25"`
+	DBMaxIdleConns              int      `envconfig:"DB_MAX_IDLE_CONNS" default:"5"`
+	DBConnMaxLifetimeMinutes    int      `envconfig:"DB_CONN_MAX_LIFETIME_MINUTES" default:"30"`
+	DBConnectRetries            int      `envconfig:"DB_CONNECT_RETRIES" default:"5"`
+	DBConnectRetryDelayMS       int      `envconfig:"DB_CONNECT_RETRY_DELAY_MS" default:"1000"`
+	DBReplicaURLs               []string `envconfig:"DB_REPLICA_URLS"`
+	DBReadYourWrites            bool     `envconfig:"DB_READ_YOUR_WRITES" default:"true"`
+	DBReplicaHealthCheckSeconds int      `envconfig:"DB_REPLICA_HEALTH_CHECK_SECONDS" default:"10"`
+	JWTSecret                   string   `envconfig:"JWT_SECRET" default:"change-me"`
+	JWTIssuer                   string   `envconfig:"JWT_ISSUER" default:"golang-rest-boilerplate"`
+	TokenExpireMinutes          int      `envconfig:"TOKEN_EXPIRE_MINUTES" default:"60"`
+	ImpersonationTTLMinutes     int      `envconfig:"IMPERSONATION_TTL_MINUTES" default:"15"`
+	GoogleClientID              string   `envconfig:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret          string   `envconfig:"GOOGLE_CLIENT_SECRET"`
+	GoogleRedirectURL           string   `envconfig:"GOOGLE_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/google/callback"`
+	GitHubClientID              string   `envconfig:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret          string   `envconfig:"GITHUB_CLIENT_SECRET"`
+	GitHubRedirectURL           string   `envconfig:"GITHUB_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/github/callback"`
+	MicrosoftTenant             string   `envconfig:"MICROSOFT_TENANT" default:"common"`
+	MicrosoftClientID           string   `envconfig:"MICROSOFT_CLIENT_ID"`
+	MicrosoftClientSecret       string   `envconfig:"MICROSOFT_CLIENT_SECRET"`
+	MicrosoftRedirectURL        string   `envconfig:"MICROSOFT_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/microsoft/callback"`
+	GitLabBaseURL               string   `envconfig:"GITLAB_BASE_URL" default:"https://gitlab.com"`
+	GitLabClientID              string   `envconfig:"GITLAB_CLIENT_ID"`
+	GitLabClientSecret          string   `envconfig:"GITLAB_CLIENT_SECRET"`
+	GitLabRedirectURL           string   `envconfig:"GITLAB_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/gitlab/callback"`
+	OIDCProviderName            string   `envconfig:"OIDC_PROVIDER_NAME" default:"oidc"`
+	OIDCIssuerURL               string   `envconfig:"OIDC_ISSUER_URL"`
+	OIDCClientID                string   `envconfig:"OIDC_CLIENT_ID"`
+	OIDCClientSecret            string   `envconfig:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL             string   `envconfig:"OIDC_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/oidc/callback"`
+	OIDCScopes                  []string `envconfig:"OIDC_SCOPES" default:"openid,email,profile"`
+	UserCacheSize               int      `envconfig:"USER_CACHE_SIZE" default:"10000"`
+	UserCacheTTLSeconds         int      `envconfig:"USER_CACHE_TTL_SECONDS" default:"60"`
+	AppURL                      string   `envconfig:"APP_URL" default:"http://localhost:8080"`
+	MailTransport               string   `envconfig:"MAIL_TRANSPORT" default:"stdout"`
+	MailFrom                    string   `envconfig:"MAIL_FROM" default:"no-reply@example.com"`
+	MailDir                     string   `envconfig:"MAIL_DIR" default:"tmp/mail"`
+	MailMaxAttempts             int      `envconfig:"MAIL_MAX_ATTEMPTS" default:"5"`
+	SMTPHost                    string   `envconfig:"SMTP_HOST"`
+	SMTPPort                    int      `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername                string   `envconfig:"SMTP_USERNAME"`
+	SMTPPassword                string   `envconfig:"SMTP_PASSWORD"`
+	JobWorkers                  int      `envconfig:"JOB_WORKERS" default:"2"`
+	JobPollIntervalMS           int      `envconfig:"JOB_POLL_INTERVAL_MS" default:"1000"`
+	JobLockTimeoutSeconds       int      `envconfig:"JOB_LOCK_TIMEOUT_SECONDS" default:"300"`
+	JobRetentionHours           int      `envconfig:"JOB_RETENTION_HOURS" default:"168"`
+	WebhookMaxAttempts          int      `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"10"`
+	WebhookTimeoutSeconds       int      `envconfig:"WEBHOOK_TIMEOUT_SECONDS" default:"10"`
+	TenantDomain                string   `envconfig:"TENANT_DOMAIN"`
+	InvitationTTLHours          int      `envconfig:"INVITATION_TTL_HOURS" default:"168"`
+	AllowedOrigins              []string `envconfig:"ALLOWED_ORIGINS" default:"*"`
+	CookieSecure                bool     `envconfig:"COOKIE_SECURE" default:"true"`
+	TokenEncryptionKey          string   `envconfig:"TOKEN_ENCRYPTION_KEY"`
+	OAuthRedirectURLs           []string `envconfig:"OAUTH_REDIRECT_URLS"`
 }
 
 // Load reads configuration from environment variables and .env files.
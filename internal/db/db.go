@@ -2,24 +2,194 @@ package db
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"github.com/example/golang-rest-boilerplate/internal/config"
 	"github.com/example/golang-rest-boilerplate/internal/models"
 )
 
+// Supported values for DB_DRIVER.
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// maxConnectBackoff caps the delay between connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// sleep waits between connection attempts; tests replace it.
+var sleep = time.Sleep
+
 // New initializes a new GORM database instance using configuration.
 func New(cfg *config.Config) (*gorm.DB, error) {
-	database, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+	dialector, err := Dialector(cfg.DBDriver, cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := connect(dialector, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	if err := database.AutoMigrate(&models.User{}); err != nil {
+	if err := configurePool(database, cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure connection pool: %w", err)
+	}
+
+	if err := Migrate(database); err != nil {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := backfillIdentities(database); err != nil {
+		return nil, fmt.Errorf("failed to backfill user identities: %w", err)
+	}
+
+	if err := useReplicas(database, cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure read replicas: %w", err)
+	}
+
 	return database, nil
 }
+
+// Dialector returns the GORM dialector for driver.
+func Dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch strings.ToLower(driver) {
+	case DriverPostgres, "postgresql", "":
+		return postgres.Open(dsn), nil
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	case DriverSQLite, "sqlite3":
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// connect opens the database, retrying with exponential backoff so the server
+// can start before the database is accepting connections.
+func connect(dialector gorm.Dialector, cfg *config.Config) (*gorm.DB, error) {
+	delay := time.Duration(cfg.DBConnectRetryDelayMS) * time.Millisecond
+	var lastErr error
+	for attempt := 0; attempt <= cfg.DBConnectRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("db: connection attempt %d failed: %v; retrying in %s", attempt, lastErr, delay)
+			sleep(delay)
+			delay *= 2
+			if delay > maxConnectBackoff {
+				delay = maxConnectBackoff
+			}
+		}
+
+		database, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+		if err == nil {
+			return database, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func configurePool(database *gorm.DB, cfg *config.Config) error {
+	sqlDB, err := database.DB()
+	if err != nil {
+		return err
+	}
+
+	maxOpen := cfg.DBMaxOpenConns
+	if database.Dialector.Name() == DriverSQLite {
+		// SQLite allows a single writer; one connection avoids "database is locked".
+		maxOpen = 1
+	}
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeMinutes) * time.Minute)
+	return nil
+}
+
+// Migrate creates or updates the schema for every model.
+func Migrate(database *gorm.DB) error {
+	all := []interface{}{&models.User{}, &models.UserIdentity{}, &models.LoginCode{}, &models.Session{}, &models.EmailChange{}, &models.Job{}, &models.AuditEvent{}, &models.WebhookEndpoint{}, &models.WebhookDelivery{}, &models.Organization{}, &models.Membership{}, &models.Invitation{}, &models.ErasureRequest{}}
+
+	if database.Dialector.Name() == DriverMySQL {
+		// MySQL has no uuid column type; store UUIDs in their canonical text form.
+		for _, model := range all {
+			stmt := &gorm.Statement{DB: database}
+			if err := stmt.Parse(model); err != nil {
+				return err
+			}
+			for _, field := range stmt.Schema.Fields {
+				if strings.EqualFold(string(field.DataType), "uuid") {
+					field.DataType = "char(36)"
+				}
+			}
+		}
+	}
+
+	if err := database.AutoMigrate(all...); err != nil {
+		return err
+	}
+	if database.Dialector.Name() == DriverPostgres {
+		return createSearchIndexes(database)
+	}
+	return nil
+}
+
+// UserSearchDocument is the full-text search document of a user on
+// PostgreSQL. Queries must use the same expression to use its index.
+const UserSearchDocument = "to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(display_name, '') || ' ' || coalesce(email, ''))"
+
+// createSearchIndexes adds the PostgreSQL full-text and trigram indexes used
+// by user search, and the index behind case-insensitive email lookups. The
+// pg_trgm extension is created if it is missing, which needs a role allowed to
+// create extensions.
+func createSearchIndexes(database *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_users_search_document ON users USING GIN ((" + UserSearchDocument + "))",
+		"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (lower(name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING GIN (lower(display_name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (lower(email) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email))",
+	}
+	for _, statement := range statements {
+		if err := database.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create search indexes: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillIdentities creates identities for users that were created by an OAuth
+// sign-in before identities were stored in their own table.
+func backfillIdentities(database *gorm.DB) error {
+	var users []models.User
+	err := database.
+		Where("provider NOT IN ? AND provider_id <> ''", []string{"", "local"}).
+		Where("NOT EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id AND user_identities.provider = users.provider)").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		identity := &models.UserIdentity{
+			UserID:   user.ID,
+			Provider: user.Provider,
+			Subject:  user.ProviderID,
+			Email:    user.Email,
+			LinkedAt: user.CreatedAt,
+		}
+		if err := database.Create(identity).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+)
+
+func TestDialector(t *testing.T) {
+	tests := []struct {
+		driver string
+		dsn    string
+		name   string
+	}{
+		{driver: "", dsn: "host=localhost dbname=app", name: DriverPostgres},
+		{driver: "postgres", dsn: "host=localhost dbname=app", name: DriverPostgres},
+		{driver: "PostgreSQL", dsn: "postgres://localhost/app", name: DriverPostgres},
+		{driver: "mysql", dsn: "app:secret@tcp(localhost:3306)/app?parseTime=true", name: DriverMySQL},
+		{driver: "sqlite", dsn: "file:app.db", name: DriverSQLite},
+		{driver: "sqlite3", dsn: ":memory:", name: DriverSQLite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			dialector, err := Dialector(tt.driver, tt.dsn)
+			require.NoError(t, err)
+			require.Equal(t, tt.name, dialector.Name())
+
+			var dsn string
+			switch d := dialector.(type) {
+			case *postgres.Dialector:
+				dsn = d.DSN
+			case *mysql.Dialector:
+				dsn = d.DSN
+			case *sqlite.Dialector:
+				dsn = d.DSN
+			}
+			require.Equal(t, tt.dsn, dsn)
+		})
+	}
+
+	_, err := Dialector("oracle", "")
+	require.ErrorContains(t, err, `unsupported database driver "oracle"`)
+}
+
+func TestConfigurePoolLimitsSQLiteToOneConnection(t *testing.T) {
+	cfg := &config.Config{DBMaxOpenConns: 10, DBMaxIdleConns: 5}
+	database, err := connect(sqlite.Open("file:pool?mode=memory&cache=shared"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, configurePool(database, cfg))
+
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.Equal(t, 1, sqlDB.Stats().MaxOpenConnections)
+}
+
+// flakyDialector fails to initialize a number of times before delegating.
+type flakyDialector struct {
+	gorm.Dialector
+	failures int
+	attempts int
+}
+
+func (d *flakyDialector) Initialize(db *gorm.DB) error {
+	d.attempts++
+	if d.attempts <= d.failures {
+		return errors.New("connection refused")
+	}
+	return d.Dialector.Initialize(db)
+}
+
+func TestConnectRetriesWithCappedBackoff(t *testing.T) {
+	var delays []time.Duration
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+
+	cfg := &config.Config{DBConnectRetries: 6, DBConnectRetryDelayMS: 10000}
+
+	t.Run("succeeds once the database is up", func(t *testing.T) {
+		delays = nil
+		dialector := &flakyDialector{Dialector: sqlite.Open("file:connect?mode=memory&cache=shared"), failures: 2}
+		database, err := connect(dialector, cfg)
+		require.NoError(t, err)
+		sqlDB, err := database.DB()
+		require.NoError(t, err)
+		sqlDB.Close()
+		require.Equal(t, 3, dialector.attempts)
+		require.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second}, delays)
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		delays = nil
+		dialector := &flakyDialector{Dialector: sqlite.Open("file:connect?mode=memory&cache=shared"), failures: 100}
+		_, err := connect(dialector, cfg)
+		require.ErrorContains(t, err, "connection refused")
+		require.Equal(t, 7, dialector.attempts)
+		require.Equal(t, []time.Duration{
+			10 * time.Second, 20 * time.Second, maxConnectBackoff, maxConnectBackoff, maxConnectBackoff, maxConnectBackoff,
+		}, delays)
+	})
+}
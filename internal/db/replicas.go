@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+)
+
+// useReplicas routes reads to the configured replicas. Writes and transactions
+// stay on the primary. The primary is appended as the last replica so the
+// policy always has somewhere to send reads when every replica is unhealthy.
+func useReplicas(database *gorm.DB, cfg *config.Config) error {
+	if len(cfg.DBReplicaURLs) == 0 {
+		return nil
+	}
+
+	dialectors := make([]gorm.Dialector, 0, len(cfg.DBReplicaURLs)+1)
+	for _, dsn := range cfg.DBReplicaURLs {
+		dialector, err := Dialector(cfg.DBDriver, dsn)
+		if err != nil {
+			return err
+		}
+		dialectors = append(dialectors, dialector)
+	}
+	primary, err := Dialector(cfg.DBDriver, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	dialectors = append(dialectors, primary)
+
+	policy := newReplicaPolicy(time.Duration(cfg.DBReplicaHealthCheckSeconds) * time.Second)
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: policy}).
+		SetMaxOpenConns(cfg.DBMaxOpenConns).
+		SetMaxIdleConns(cfg.DBMaxIdleConns).
+		SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeMinutes) * time.Minute)
+
+	if err := database.Use(resolver); err != nil {
+		return err
+	}
+	return registerPrimaryPinCallbacks(database)
+}
+
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// replicaPolicy load-balances reads round-robin across healthy replicas.
+// Replicas failing a health check are skipped until a later check succeeds.
+type replicaPolicy struct {
+	interval  time.Duration
+	next      uint64
+	once      sync.Once
+	mu        sync.RWMutex
+	unhealthy map[gorm.ConnPool]bool
+}
+
+func newReplicaPolicy(interval time.Duration) *replicaPolicy {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &replicaPolicy{interval: interval, unhealthy: make(map[gorm.ConnPool]bool)}
+}
+
+// Resolve implements dbresolver.Policy. The last pool is the primary fallback.
+func (p *replicaPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	replicas, fallback := pools[:len(pools)-1], pools[len(pools)-1]
+	p.once.Do(func() { go p.monitor(replicas) })
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	start := atomic.AddUint64(&p.next, 1)
+	for i := 0; i < len(replicas); i++ {
+		pool := replicas[(start+uint64(i))%uint64(len(replicas))]
+		if !p.unhealthy[pool] {
+			return pool
+		}
+	}
+	return fallback
+}
+
+func (p *replicaPolicy) monitor(replicas []gorm.ConnPool) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.check(replicas)
+		<-ticker.C
+	}
+}
+
+func (p *replicaPolicy) check(replicas []gorm.ConnPool) {
+	for i, pool := range replicas {
+		target, ok := pool.(pinger)
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.interval/2)
+		err := target.PingContext(ctx)
+		cancel()
+
+		p.mu.Lock()
+		wasUnhealthy := p.unhealthy[pool]
+		p.unhealthy[pool] = err != nil
+		p.mu.Unlock()
+
+		switch {
+		case err != nil && !wasUnhealthy:
+			log.Printf("db: replica %d removed from rotation: %v", i, err)
+		case err == nil && wasUnhealthy:
+			log.Printf("db: replica %d recovered", i)
+		}
+	}
+}
+
+type primaryPinKey struct{}
+
+// WithPrimaryPin returns a context whose reads switch to the primary once a
+// write has been made with it, so a request always reads its own writes.
+func WithPrimaryPin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryPinKey{}, new(atomic.Bool))
+}
+
+// PinnedToPrimary reports whether reads made with ctx must use the primary.
+func PinnedToPrimary(ctx context.Context) bool {
+	pin, ok := ctx.Value(primaryPinKey{}).(*atomic.Bool)
+	return ok && pin.Load()
+}
+
+// registerPrimaryPinCallbacks pins the statement's context after every write.
+// Raw statements (Exec, Raw) pin unless they are plain reads.
+func registerPrimaryPinCallbacks(database *gorm.DB) error {
+	pin := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Context == nil {
+			return
+		}
+		if p, ok := tx.Statement.Context.Value(primaryPinKey{}).(*atomic.Bool); ok {
+			p.Store(true)
+		}
+	}
+
+	callbacks := database.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("app:pin_primary", pin); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("app:pin_primary", pin); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("app:pin_primary", pin); err != nil {
+		return err
+	}
+
+	pinRaw := func(tx *gorm.DB) {
+		if !readOnlySQL(tx.Statement.SQL.String()) {
+			pin(tx)
+		}
+	}
+	if err := callbacks.Raw().After("gorm:raw").Register("app:pin_primary", pinRaw); err != nil {
+		return err
+	}
+	return callbacks.Row().After("gorm:row").Register("app:pin_primary", pinRaw)
+}
+
+// readOnlySQL reports whether a raw statement is a plain read, using the same
+// rule dbresolver uses to send raw statements to a replica.
+func readOnlySQL(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	return len(sql) > 10 && strings.EqualFold(sql[:6], "select") && !strings.EqualFold(sql[len(sql)-10:], "for update")
+}
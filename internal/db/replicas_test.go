@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// fakePool is a replica whose health checks fail while down is set.
+type fakePool struct {
+	gorm.ConnPool
+	down atomic.Bool
+}
+
+func (p *fakePool) PingContext(context.Context) error {
+	if p.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestReplicaPolicy(t *testing.T) {
+	first, second, primary := &fakePool{}, &fakePool{}, &fakePool{}
+	pools := []gorm.ConnPool{first, second, primary}
+	replicas := pools[:2]
+
+	policy := newReplicaPolicy(time.Hour)
+	// Health checks are driven by hand below.
+	policy.once.Do(func() {})
+
+	t.Run("reads rotate across healthy replicas", func(t *testing.T) {
+		seen := map[gorm.ConnPool]int{}
+		for i := 0; i < 4; i++ {
+			seen[policy.Resolve(pools)]++
+		}
+		require.Equal(t, map[gorm.ConnPool]int{first: 2, second: 2}, seen)
+	})
+
+	t.Run("unhealthy replicas are skipped until they recover", func(t *testing.T) {
+		first.down.Store(true)
+		policy.check(replicas)
+		for i := 0; i < 4; i++ {
+			require.Same(t, second, policy.Resolve(pools))
+		}
+
+		first.down.Store(false)
+		policy.check(replicas)
+		require.NotSame(t, policy.Resolve(pools), policy.Resolve(pools))
+	})
+
+	t.Run("the primary serves reads when every replica is down", func(t *testing.T) {
+		first.down.Store(true)
+		second.down.Store(true)
+		policy.check(replicas)
+		require.Same(t, primary, policy.Resolve(pools))
+	})
+}
+
+func TestReplicaHealthMonitor(t *testing.T) {
+	replica, primary := &fakePool{}, &fakePool{}
+	replica.down.Store(true)
+	pools := []gorm.ConnPool{replica, primary}
+
+	// The first Resolve starts the monitor, which checks straight away.
+	policy := newReplicaPolicy(10 * time.Millisecond)
+	require.Eventually(t, func() bool { return policy.Resolve(pools) == primary }, time.Second, 5*time.Millisecond)
+
+	replica.down.Store(false)
+	require.Eventually(t, func() bool { return policy.Resolve(pools) == replica }, time.Second, 5*time.Millisecond)
+}
+
+func TestPrimaryPin(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:primary_pin?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, database.AutoMigrate(&models.User{}))
+	require.NoError(t, registerPrimaryPinCallbacks(database))
+
+	require.False(t, PinnedToPrimary(context.Background()))
+
+	tests := []struct {
+		name   string
+		write  func(ctx context.Context) error
+		pinned bool
+	}{
+		{name: "query", write: func(ctx context.Context) error {
+			var users []models.User
+			return database.WithContext(ctx).Find(&users).Error
+		}},
+		{name: "raw select", write: func(ctx context.Context) error {
+			var count int64
+			return database.WithContext(ctx).Raw("SELECT count(*) FROM users").Scan(&count).Error
+		}},
+		{name: "failed create", write: func(ctx context.Context) error {
+			return database.WithContext(ctx).Exec("INSERT INTO missing_table (id) VALUES (1)").Error
+		}},
+		{name: "create", pinned: true, write: func(ctx context.Context) error {
+			return database.WithContext(ctx).Create(&models.User{Name: "Ada", Email: "ada@example.com"}).Error
+		}},
+		{name: "update", pinned: true, write: func(ctx context.Context) error {
+			return database.WithContext(ctx).Model(&models.User{}).Where("email = ?", "ada@example.com").Update("name", "Ada L").Error
+		}},
+		{name: "exec", pinned: true, write: func(ctx context.Context) error {
+			return database.WithContext(ctx).Exec("UPDATE users SET name = ? WHERE email = ?", "Ada", "ada@example.com").Error
+		}},
+		{name: "raw write", pinned: true, write: func(ctx context.Context) error {
+			var names []string
+			return database.WithContext(ctx).Raw("UPDATE users SET name = ? RETURNING name", "Ada").Scan(&names).Error
+		}},
+		{name: "delete", pinned: true, write: func(ctx context.Context) error {
+			return database.WithContext(ctx).Where("email = ?", "ada@example.com").Delete(&models.User{}).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrimaryPin(context.Background())
+			_ = tt.write(ctx)
+			require.Equal(t, tt.pinned, PinnedToPrimary(ctx))
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrClosed is returned by Close when the bus was already closed.
+var ErrClosed = errors.New("events: bus is closed")
+
+// Event is a domain event. Events that share an aggregate ID are delivered to
+// asynchronous subscribers in the order they were published.
+type Event interface {
+	EventName() string
+	AggregateID() uuid.UUID
+}
+
+// Config configures a Bus.
+type Config struct {
+	// Workers is the number of goroutines running asynchronous subscribers.
+	Workers int
+	// QueueSize is the number of events each worker buffers before publishers wait.
+	QueueSize int
+	// AfterCommit runs fn once the transaction carried by ctx commits, or
+	// right away without one, and drops it if the transaction rolls back.
+	// Without it, asynchronous subscribers are scheduled when an event is
+	// published.
+	AfterCommit func(ctx context.Context, fn func(ctx context.Context))
+}
+
+type handlerFunc func(ctx context.Context, event Event) error
+
+type subscriber struct {
+	name string
+	fn   handlerFunc
+}
+
+type delivery struct {
+	ctx   context.Context
+	event Event
+	subs  []subscriber
+}
+
+// Bus dispatches events to the subscribers registered for their type.
+//
+// Synchronous subscribers run in the publisher's goroutine with its context,
+// so inside a transaction they take part in it, and an error or panic fails
+// the publish. Asynchronous subscribers run on a worker once the publisher's
+// transaction commits, as Config.AfterCommit reports; their errors and panics
+// are logged and do not affect the publisher or other subscribers.
+type Bus struct {
+	mu        sync.RWMutex
+	syncSubs  map[reflect.Type][]subscriber
+	asyncSubs map[reflect.Type][]subscriber
+
+	afterCommit func(ctx context.Context, fn func(ctx context.Context))
+
+	queues  []chan delivery
+	closed  bool
+	stop    chan struct{}
+	sending sync.WaitGroup
+	wg      sync.WaitGroup
+}
+
+type workerKey struct{}
+
+// NewBus constructs a Bus and starts its workers.
+func NewBus(cfg Config) *Bus {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 256
+	}
+	if cfg.AfterCommit == nil {
+		cfg.AfterCommit = func(ctx context.Context, fn func(ctx context.Context)) { fn(ctx) }
+	}
+
+	b := &Bus{
+		syncSubs:    make(map[reflect.Type][]subscriber),
+		asyncSubs:   make(map[reflect.Type][]subscriber),
+		afterCommit: cfg.AfterCommit,
+		queues:      make([]chan delivery, cfg.Workers),
+		stop:        make(chan struct{}),
+	}
+	for i := range b.queues {
+		b.queues[i] = make(chan delivery, cfg.QueueSize)
+		b.wg.Add(1)
+		go b.work(b.queues[i])
+	}
+	return b
+}
+
+// Subscribe registers fn to run synchronously for every published event of type T.
+// name identifies the subscriber in errors and logs.
+func Subscribe[T Event](b *Bus, name string, fn func(ctx context.Context, event T) error) {
+	b.subscribe(b.syncSubs, eventTypeOf[T](), subscriber{name: name, fn: adapt(fn)})
+}
+
+// SubscribeAsync registers fn to run asynchronously for every published event
+// of type T. name identifies the subscriber in logs.
+func SubscribeAsync[T Event](b *Bus, name string, fn func(ctx context.Context, event T) error) {
+	b.subscribe(b.asyncSubs, eventTypeOf[T](), subscriber{name: name, fn: adapt(fn)})
+}
+
+func eventTypeOf[T Event]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func adapt[T Event](fn func(ctx context.Context, event T) error) handlerFunc {
+	return func(ctx context.Context, event Event) error {
+		return fn(ctx, event.(T))
+	}
+}
+
+func (b *Bus) subscribe(subs map[reflect.Type][]subscriber, eventType reflect.Type, sub subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs[eventType] = append(subs[eventType], sub)
+}
+
+// Publish runs the synchronous subscribers for event in registration order,
+// stopping at the first error, and then schedules the asynchronous ones to
+// run after the transaction carried by ctx commits.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	eventType := reflect.TypeOf(event)
+	b.mu.RLock()
+	syncSubs, asyncSubs := b.syncSubs[eventType], b.asyncSubs[eventType]
+	b.mu.RUnlock()
+
+	for _, sub := range syncSubs {
+		if err := call(ctx, sub, event); err != nil {
+			return fmt.Errorf("%s subscriber %s: %w", event.EventName(), sub.name, err)
+		}
+	}
+
+	if len(asyncSubs) > 0 {
+		b.afterCommit(ctx, func(ctx context.Context) {
+			b.enqueue(delivery{ctx: context.WithoutCancel(ctx), event: event, subs: asyncSubs})
+		})
+	}
+	return nil
+}
+
+// enqueue hands d to the worker owning its aggregate, so events for one
+// aggregate are handled in order. It waits while that worker's queue is full,
+// until the bus is closed. Events published by an asynchronous subscriber are
+// queued from a new goroutine instead when the queue is full, because the
+// worker running the subscriber may be the one that has to drain it; such
+// events can overtake earlier ones.
+func (b *Bus) enqueue(d delivery) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		b.drop(d)
+		return
+	}
+	// Close waits for sends started before it, so queues stay open for them.
+	b.sending.Add(1)
+	b.mu.RUnlock()
+
+	id := d.event.AggregateID()
+	h := fnv.New32a()
+	h.Write(id[:])
+	queue := b.queues[h.Sum32()%uint32(len(b.queues))]
+
+	send := func() {
+		defer b.sending.Done()
+		select {
+		case queue <- d:
+		case <-b.stop:
+			b.drop(d)
+		}
+	}
+	if d.ctx.Value(workerKey{}) != nil {
+		select {
+		case queue <- d:
+			b.sending.Done()
+		default:
+			go send()
+		}
+		return
+	}
+	send()
+}
+
+func (b *Bus) drop(d delivery) {
+	log.Printf("events: bus closed, dropping %s for %s", d.event.EventName(), d.event.AggregateID())
+}
+
+func (b *Bus) work(queue <-chan delivery) {
+	defer b.wg.Done()
+	for d := range queue {
+		ctx := context.WithValue(d.ctx, workerKey{}, true)
+		for _, sub := range d.subs {
+			if err := call(ctx, sub, d.event); err != nil {
+				log.Printf("events: %s subscriber %s failed for %s: %v", d.event.EventName(), sub.name, d.event.AggregateID(), err)
+			}
+		}
+	}
+}
+
+// call runs a subscriber, turning a panic into an error.
+func call(ctx context.Context, sub subscriber, event Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return sub.fn(ctx, event)
+}
+
+// Close stops accepting asynchronous work and waits until queued events have
+// been handled or ctx is done. Publishers waiting for room in a full queue
+// give up and drop their event.
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	close(b.stop)
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.sending.Wait()
+		for _, queue := range b.queues {
+			close(queue)
+		}
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
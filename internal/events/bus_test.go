@@ -0,0 +1,137 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+func TestBus(t *testing.T) {
+	bus := events.NewBus(events.Config{Workers: 4, QueueSize: 1, AfterCommit: repository.AfterCommit})
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	var mu sync.Mutex
+	handled := make(map[uuid.UUID][]string)
+	events.SubscribeAsync(bus, "panics", func(context.Context, events.UserUpdated) error {
+		panic("subscriber bug")
+	})
+	events.SubscribeAsync(bus, "recorder", func(_ context.Context, e events.UserUpdated) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[e.User.ID] = append(handled[e.User.ID], e.User.Name)
+		return nil
+	})
+
+	// Asynchronous subscribers see events for one aggregate in publish order,
+	// even after another subscriber panicked.
+	alice, bob := &models.User{ID: uuid.New()}, &models.User{ID: uuid.New()}
+	var want []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		want = append(want, name)
+		for _, user := range []*models.User{alice, bob} {
+			updated := *user
+			updated.Name = name
+			require.NoError(t, bus.Publish(ctx, events.UserUpdated{Before: user, User: &updated}))
+		}
+	}
+
+	// Events from a rolled back transaction never reach asynchronous subscribers.
+	transactor := repository.NewMemoryTransactor()
+	require.ErrorIs(t, transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, bus.Publish(ctx, events.UserUpdated{Before: alice, User: &models.User{ID: alice.ID, Name: "rolled back"}}))
+		return errBoom
+	}), errBoom)
+
+	// Synchronous subscribers fail the publish, whether they return an error or panic.
+	events.Subscribe(bus, "failing", func(context.Context, events.UserDeleted) error { return errBoom })
+	require.ErrorIs(t, bus.Publish(ctx, events.UserDeleted{User: alice}), errBoom)
+	events.Subscribe(bus, "panicking", func(context.Context, events.LoginFailed) error { panic("subscriber bug") })
+	require.ErrorContains(t, bus.Publish(ctx, events.LoginFailed{Email: "x@example.com"}), "panicking")
+
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, bus.Close(closeCtx))
+	require.ErrorIs(t, bus.Close(closeCtx), events.ErrClosed)
+
+	require.Equal(t, want, handled[alice.ID])
+	require.Equal(t, want, handled[bob.ID])
+}
+
+func TestBusSubscriberRepublishes(t *testing.T) {
+	// A single worker with a tiny queue has to drain the events its own
+	// subscriber publishes.
+	bus := events.NewBus(events.Config{Workers: 1, QueueSize: 1})
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var deleted []uuid.UUID
+	events.SubscribeAsync(bus, "republisher", func(ctx context.Context, e events.UserUpdated) error {
+		return bus.Publish(ctx, events.UserDeleted{User: e.User})
+	})
+	events.SubscribeAsync(bus, "recorder", func(_ context.Context, e events.UserDeleted) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, e.User.ID)
+		return nil
+	})
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, bus.Publish(ctx, events.UserUpdated{User: &models.User{ID: uuid.New()}}))
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(deleted) == 20
+	}, 5*time.Second, time.Millisecond)
+
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, bus.Close(closeCtx))
+}
+
+func TestBusCloseReleasesWaitingPublishers(t *testing.T) {
+	bus := events.NewBus(events.Config{Workers: 1, QueueSize: 1})
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	events.SubscribeAsync(bus, "stuck", func(context.Context, events.UserUpdated) error {
+		<-release
+		return nil
+	})
+
+	// The worker holds one event and the queue another; the third publish
+	// waits for room until the bus closes.
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < 3; i++ {
+			_ = bus.Publish(ctx, events.UserUpdated{User: &models.User{ID: uuid.New()}})
+		}
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish did not wait for a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closed := make(chan error)
+	go func() { closed <- bus.Close(ctx) }()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not release the waiting publisher")
+	}
+	close(release)
+	require.NoError(t, <-closed)
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// Events are published by value; subscribers must not modify the users they carry.
+
+// UserRegistered is published when an account is created, by password
+// registration or on first sign-in through a provider.
+type UserRegistered struct {
+	User *models.User
+	// Provider is "local" for password registrations.
+	Provider string
+}
+
+// EventName implements Event.
+func (e UserRegistered) EventName() string { return "user.registered" }
+
+// AggregateID implements Event.
+func (e UserRegistered) AggregateID() uuid.UUID { return e.User.ID }
+
+// UserLoggedIn is published when a user signs in.
+type UserLoggedIn struct {
+	User *models.User
+	// Provider names the OAuth provider used, or is empty for a password login.
+	Provider string
+}
+
+// EventName implements Event.
+func (e UserLoggedIn) EventName() string { return "user.logged_in" }
+
+// AggregateID implements Event.
+func (e UserLoggedIn) AggregateID() uuid.UUID { return e.User.ID }
+
+// LoginFailed is published when a password login is rejected.
+type LoginFailed struct {
+	Email string
+	// UserID is the account registered with Email, or uuid.Nil if there is none.
+	UserID uuid.UUID
+}
+
+// EventName implements Event.
+func (e LoginFailed) EventName() string { return "user.login_failed" }
+
+// AggregateID implements Event.
+func (e LoginFailed) AggregateID() uuid.UUID { return e.UserID }
+
+// UserUpdated is published when a user's profile or email changes.
+type UserUpdated struct {
+	// Before is the user as it was before the change.
+	Before *models.User
+	User   *models.User
+}
+
+// EventName implements Event.
+func (e UserUpdated) EventName() string { return "user.updated" }
+
+// AggregateID implements Event.
+func (e UserUpdated) AggregateID() uuid.UUID { return e.User.ID }
+
+// UserStatusChanged is published when an account is suspended, deactivated,
+// reactivated or otherwise changes status.
+type UserStatusChanged struct {
+	// From is the status before the change.
+	From string
+	User *models.User
+}
+
+// EventName implements Event.
+func (e UserStatusChanged) EventName() string { return "user.status_changed" }
+
+// AggregateID implements Event.
+func (e UserStatusChanged) AggregateID() uuid.UUID { return e.User.ID }
+
+// UserDeleted is published when an account is deleted.
+type UserDeleted struct {
+	// User is the account as it was before deletion.
+	User *models.User
+}
+
+// EventName implements Event.
+func (e UserDeleted) EventName() string { return "user.deleted" }
+
+// AggregateID implements Event.
+func (e UserDeleted) AggregateID() uuid.UUID { return e.User.ID }
+
+// UserErased is published when a user's personal data has been erased. The
+// account remains as a tombstone so references to its ID stay valid.
+type UserErased struct {
+	// User is the tombstone left by the erasure.
+	User *models.User
+	// Email is the address the account had before the erasure, so subscribers
+	// can erase data keyed by it.
+	Email string
+	// RequestID identifies the erasure request, made by RequestedBy.
+	RequestID   uuid.UUID
+	RequestedBy uuid.UUID
+}
+
+// EventName implements Event.
+func (e UserErased) EventName() string { return "user.erased" }
+
+// AggregateID implements Event.
+func (e UserErased) AggregateID() uuid.UUID { return e.User.ID }
+
+// OAuthLinked is published when a provider identity is linked to a user.
+type OAuthLinked struct {
+	UserID   uuid.UUID
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// EventName implements Event.
+func (e OAuthLinked) EventName() string { return "user.oauth_linked" }
+
+// AggregateID implements Event.
+func (e OAuthLinked) AggregateID() uuid.UUID { return e.UserID }
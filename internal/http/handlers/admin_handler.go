@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/response"
+)
+
+// defaultPageSize is the number of results returned when a request sets no limit.
+const defaultPageSize = 50
+
+// maxImportBytes limits the size of a user import upload.
+const maxImportBytes = 1 << 20
+
+// maxImportRows limits the rows of a user import upload. Every row with a
+// password is hashed within the request, so larger files are imported with
+// the users command.
+const maxImportRows = 500
+
+// AdminHandler serves endpoints restricted to administrators.
+type AdminHandler struct {
+	auditService    *service.AuditService
+	webhookService  *service.WebhookService
+	authService     *service.AuthService
+	accountService  *service.AccountService
+	privacyService  *service.PrivacyService
+	transferService *service.UserTransferService
+}
+
+// NewAdminHandler constructs a new AdminHandler.
+func NewAdminHandler(auditService *service.AuditService, webhookService *service.WebhookService, authService *service.AuthService, accountService *service.AccountService, privacyService *service.PrivacyService, transferService *service.UserTransferService) *AdminHandler {
+	return &AdminHandler{auditService: auditService, webhookService: webhookService, authService: authService, accountService: accountService, privacyService: privacyService, transferService: transferService}
+}
+
+type auditEventsQuery struct {
+	ActorID    string    `form:"actor_id" binding:"omitempty,uuid"`
+	TargetType string    `form:"target_type"`
+	TargetID   string    `form:"target_id"`
+	Action     string    `form:"action"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit      int       `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset     int       `form:"offset" binding:"omitempty,min=0"`
+}
+
+// AuditEvents lists audit events, newest first. Results can be filtered by
+// actor, target, action and an RFC 3339 time range, and are paginated with
+// limit and offset.
+func (h *AdminHandler) AuditEvents(c *gin.Context) {
+	var query auditEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+
+	filter := repository.AuditFilter{
+		TargetType: query.TargetType,
+		TargetID:   query.TargetID,
+		Action:     query.Action,
+		From:       query.From,
+		To:         query.To,
+		Limit:      query.Limit,
+		Offset:     query.Offset,
+	}
+	if query.ActorID != "" {
+		actorID := uuid.MustParse(query.ActorID)
+		filter.ActorID = &actorID
+	}
+
+	events, total, err := h.auditService.List(c.Request.Context(), filter)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"events": events, "total": total, "limit": query.Limit, "offset": query.Offset})
+}
+
+// Impersonate issues a short-lived token for the user in the path, letting the
+// administrator see the app as that user does. Logging out with the token ends
+// the impersonation.
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	token, user, err := h.authService.Impersonate(c.Request.Context(), adminID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.Error(c, http.StatusNotFound, "user not found")
+		case errors.Is(err, service.ErrImpersonationNotAllowed), service.IsAccountStatusError(err):
+			response.Error(c, http.StatusForbidden, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.JSON(c, http.StatusCreated, gin.H{"token": token, "user": user})
+}
+
+type userStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// SetUserStatus suspends, deactivates, reactivates or otherwise changes the
+// status of the user in the path. Unless the user becomes active, their
+// sessions are signed out.
+func (h *AdminHandler) SetUserStatus(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var req userStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.accountService.SetStatus(c.Request.Context(), adminID, userID, req.Status, req.Reason)
+	if err != nil {
+		var validationErr *service.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			response.ValidationError(c, validationErr.Fields)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.Error(c, http.StatusNotFound, "user not found")
+		case errors.Is(err, service.ErrOwnStatus):
+			response.Error(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrAccountErased):
+			response.Error(c, http.StatusConflict, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"user": user})
+}
+
+// RequestErasure queues the erasure of the personal data of the user in the
+// path. The request can be followed at /admin/erasure-requests/:id.
+func (h *AdminHandler) RequestErasure(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	request, err := h.privacyService.RequestErasure(c.Request.Context(), adminID, userID)
+	if err != nil {
+		writeErasureError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, gin.H{"erasure_request": request})
+}
+
+// ErasureRequests lists erasure requests, newest first, paginated with limit
+// and offset.
+func (h *AdminHandler) ErasureRequests(c *gin.Context) {
+	var query pageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+
+	requests, total, err := h.privacyService.Erasures(c.Request.Context(), query.Limit, query.Offset)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"erasure_requests": requests, "total": total, "limit": query.Limit, "offset": query.Offset})
+}
+
+// GetErasureRequest returns an erasure request.
+func (h *AdminHandler) GetErasureRequest(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid erasure request id")
+		return
+	}
+
+	request, err := h.privacyService.Erasure(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusNotFound, "erasure request not found")
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"erasure_request": request})
+}
+
+type importUsersQuery struct {
+	Format string `form:"format"`
+	DryRun bool   `form:"dry_run"`
+}
+
+// ImportUsers creates users from the CSV or NDJSON request body and returns a
+// report of every row. The format is taken from the format parameter or the
+// Content-Type. With dry_run=true the rows are only validated.
+func (h *AdminHandler) ImportUsers(c *gin.Context) {
+	var query importUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := query.Format
+	if format == "" {
+		format = transferFormat(c.ContentType())
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	opts := service.ImportOptions{DryRun: query.DryRun, MaxRows: maxImportRows}
+	report, err := h.transferService.Import(c.Request.Context(), format, body, opts)
+	if err != nil {
+		var validationErr *service.ValidationError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			response.Error(c, http.StatusRequestEntityTooLarge, "import is too large")
+		case errors.As(err, &validationErr):
+			response.ValidationError(c, validationErr.Fields)
+		case errors.Is(err, service.ErrTooManyRows):
+			response.Error(c, http.StatusBadRequest, err.Error()+"; import larger files with the users command")
+		case errors.Is(err, service.ErrUnsupportedFormat):
+			response.Error(c, http.StatusBadRequest, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"report": report})
+}
+
+// ExportUsers streams every user as CSV or, with format=ndjson, as one JSON
+// object per line.
+func (h *AdminHandler) ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", service.FormatCSV)
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case service.FormatCSV:
+	case service.FormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		response.Error(c, http.StatusBadRequest, service.ErrUnsupportedFormat.Error())
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="users.`+format+`"`)
+	c.Status(http.StatusOK)
+	if err := h.transferService.Export(c.Request.Context(), format, c.Writer); err != nil {
+		// The status has been sent, so the truncated body is all the client sees.
+		_ = c.Error(err)
+	}
+}
+
+// transferFormat maps a Content-Type to an import format.
+func transferFormat(contentType string) string {
+	switch contentType {
+	case "text/csv":
+		return service.FormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		return service.FormatNDJSON
+	}
+	return ""
+}
+
+// CreateWebhook registers a webhook endpoint. The response includes the
+// endpoint's signing secret, which is not shown again.
+func (h *AdminHandler) CreateWebhook(c *gin.Context) {
+	var req service.WebhookInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	endpoint, secret, err := h.webhookService.Create(c.Request.Context(), req)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusCreated, gin.H{"webhook": endpoint, "secret": secret})
+}
+
+// ListWebhooks returns all webhook endpoints.
+func (h *AdminHandler) ListWebhooks(c *gin.Context) {
+	endpoints, err := h.webhookService.List(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"webhooks": endpoints})
+}
+
+// GetWebhook returns a webhook endpoint.
+func (h *AdminHandler) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.webhookService.Get(c.Request.Context(), id)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"webhook": endpoint})
+}
+
+// UpdateWebhook replaces a webhook endpoint's URL, description and
+// subscriptions, and enables or disables it when active is given.
+func (h *AdminHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req service.WebhookInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	endpoint, err := h.webhookService.Update(c.Request.Context(), id, req)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"webhook": endpoint})
+}
+
+// DeleteWebhook removes a webhook endpoint and its delivery history.
+func (h *AdminHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(c.Request.Context(), id); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type pageQuery struct {
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+}
+
+// WebhookDeliveries lists a webhook endpoint's deliveries, newest first,
+// paginated with limit and offset.
+func (h *AdminHandler) WebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var query pageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+
+	deliveries, total, err := h.webhookService.Deliveries(c.Request.Context(), id, query.Limit, query.Offset)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"deliveries": deliveries, "total": total, "limit": query.Limit, "offset": query.Offset})
+}
+
+// RedeliverWebhook queues a past delivery's event to be sent again.
+func (h *AdminHandler) RedeliverWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid delivery id")
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusNotFound, "delivery not found")
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, gin.H{"delivery": delivery})
+}
+
+func webhookID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid webhook id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ValidationError(c, validationErr.Fields)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "webhook not found")
+	default:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeErasureError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "user not found")
+	case errors.Is(err, service.ErrInvalidCredentials):
+		response.Error(c, http.StatusForbidden, "password is incorrect")
+	case errors.Is(err, service.ErrErasurePending), errors.Is(err, service.ErrAccountErased):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
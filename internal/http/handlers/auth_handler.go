@@ -1,26 +1,55 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/http/middleware"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
 	"github.com/example/golang-rest-boilerplate/internal/service"
 	"github.com/example/golang-rest-boilerplate/pkg/response"
 )
 
 // AuthHandler handles authentication related HTTP requests.
 type AuthHandler struct {
-	authService   *service.AuthService
-	googleService *service.GoogleOAuthService
+	authService       service.Authenticator
+	identityService   service.IdentityLinker
+	invitations       service.InvitationAcceptor
+	providerTokens    *service.ProviderTokenService
+	providers         *oauth.Registry
+	sessionCodec      *oauth.SessionCodec
+	secureCookies     bool
+	redirectURLs      []string
+	accessTokenMaxAge int
 }
 
-const oauthStateCookieName = "oauth_state"
+const oauthSessionCookieName = "oauth_session"
 
 // NewAuthHandler creates a new AuthHandler instance.
-func NewAuthHandler(authService *service.AuthService, googleService *service.GoogleOAuthService) *AuthHandler {
-	return &AuthHandler{authService: authService, googleService: googleService}
+func NewAuthHandler(authService service.Authenticator, identityService service.IdentityLinker, invitations service.InvitationAcceptor, providerTokens *service.ProviderTokenService, providers *oauth.Registry, sessionCodec *oauth.SessionCodec, cfg *config.Config) *AuthHandler {
+	return &AuthHandler{
+		authService:       authService,
+		identityService:   identityService,
+		invitations:       invitations,
+		providerTokens:    providerTokens,
+		providers:         providers,
+		sessionCodec:      sessionCodec,
+		secureCookies:     cfg.CookieSecure,
+		redirectURLs:      cfg.OAuthRedirectURLs,
+		accessTokenMaxAge: cfg.TokenExpireMinutes * 60,
+	}
 }
 
 type registerRequest struct {
@@ -61,6 +90,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	token, user, err := h.authService.Login(c.Request.Context(), req.Email, req.Password)
 	if err != nil {
+		if service.IsAccountStatusError(err) {
+			response.Error(c, http.StatusForbidden, err.Error())
+			return
+		}
 		response.Error(c, http.StatusUnauthorized, err.Error())
 		return
 	}
@@ -68,74 +101,486 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	response.JSON(c, http.StatusOK, gin.H{"token": token, "user": user})
 }
 
-// GoogleLogin initiates the Google OAuth flow.
-func (h *AuthHandler) GoogleLogin(c *gin.Context) {
-	if h.googleService == nil {
-		response.Error(c, http.StatusServiceUnavailable, "google oauth is not configured")
+// OAuthLogin initiates the authorization-code flow for the provider in the path.
+//
+// Without query parameters it returns the authorization URL as JSON for API
+// clients. Browser apps pass a whitelisted redirect_uri and optionally
+// response_mode=code|cookie; the user is then redirected to the provider and,
+// after the callback, back to redirect_uri.
+func (h *AuthHandler) OAuthLogin(c *gin.Context) {
+	h.startOAuth(c, c.Param("provider"), nil)
+}
+
+// OAuthLink initiates the authorization-code flow to link the provider in the
+// path to the authenticated user.
+func (h *AuthHandler) OAuthLink(c *gin.Context) {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		response.Error(c, http.StatusUnauthorized, "missing claims")
+		return
+	}
+	h.startOAuth(c, c.Param("provider"), func(session *oauth.Session) {
+		session.LinkUserID = claims.UserID
+	})
+}
+
+// startOAuth begins a flow with providerName. prepare, if set, marks the
+// session for linking or accepting an invitation instead of signing in.
+func (h *AuthHandler) startOAuth(c *gin.Context, providerName string, prepare func(*oauth.Session)) {
+	provider, err := h.providers.Get(providerName)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "oauth provider is not configured")
+		return
+	}
+
+	session, err := oauth.NewSession(provider.Name())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if prepare != nil {
+		prepare(session)
+	}
+
+	if redirectURI := c.Query("redirect_uri"); redirectURI != "" {
+		if !h.allowedRedirect(redirectURI) {
+			response.Error(c, http.StatusBadRequest, "redirect_uri is not allowed")
+			return
+		}
+		mode := c.DefaultQuery("response_mode", oauth.ResponseModeCode)
+		if mode != oauth.ResponseModeCode && mode != oauth.ResponseModeCookie {
+			response.Error(c, http.StatusBadRequest, "response_mode must be code or cookie")
+			return
+		}
+		session.RedirectURI = redirectURI
+		session.ResponseMode = mode
+	}
+
+	sealed, err := h.sessionCodec.Encode(session)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	state := uuid.NewString()
-	url := h.googleService.AuthCodeURL(state)
-	c.SetCookie(oauthStateCookieName, state, 300, "/", "", false, true)
-	response.JSON(c, http.StatusOK, gin.H{"auth_url": url, "state": state})
+	h.setOAuthCookie(c, sealed, int(oauth.SessionTTL.Seconds()))
+	authURL := provider.AuthCodeURL(session)
+	if session.RedirectURI != "" {
+		c.Redirect(http.StatusFound, authURL)
+		return
+	}
+	response.JSON(c, http.StatusOK, gin.H{"auth_url": authURL, "state": session.State})
 }
 
-// GoogleCallback handles the OAuth callback from Google.
-func (h *AuthHandler) GoogleCallback(c *gin.Context) {
-	if h.googleService == nil {
-		response.Error(c, http.StatusServiceUnavailable, "google oauth is not configured")
+// OAuthCallback completes the authorization-code flow for the provider in the path.
+func (h *AuthHandler) OAuthCallback(c *gin.Context) {
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "oauth provider is not configured")
+		return
+	}
+
+	sealed, err := c.Cookie(oauthSessionCookieName)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "oauth session cookie missing or expired")
+		return
+	}
+	h.setOAuthCookie(c, "", -1)
+
+	session, err := h.sessionCodec.Decode(sealed)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	state := c.Query("state")
-	if state == "" {
-		response.Error(c, http.StatusBadRequest, "state query param missing")
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.oauthError(c, session, http.StatusBadRequest, errors.New("provider returned error: "+providerErr))
 		return
 	}
 
-	cookieState, err := c.Cookie(oauthStateCookieName)
+	identity, token, err := provider.Complete(c.Request.Context(), session, c.Query("state"), c.Query("code"))
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, "oauth state cookie missing or expired")
+		h.oauthError(c, session, http.StatusBadRequest, err)
+		return
+	}
+
+	if session.LinkUserID != "" {
+		h.completeLink(c, session, identity, token)
 		return
 	}
 
-	if cookieState != state {
-		response.Error(c, http.StatusBadRequest, "invalid oauth state")
+	var user *models.User
+	if session.Invitation != "" {
+		user, _, err = h.invitations.AcceptWithIdentity(c.Request.Context(), session.Invitation, identity)
+	} else {
+		user, err = h.authService.FindOrCreateOAuthUser(c.Request.Context(), identity)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrIdentityConflict) || errors.Is(err, service.ErrProviderAlreadyLinked) {
+			h.oauthError(c, session, http.StatusConflict, err)
+			return
+		}
+		if service.IsAccountStatusError(err) {
+			h.oauthError(c, session, http.StatusForbidden, err)
+			return
+		}
+		if status, ok := invitationErrorStatus(err); ok {
+			h.oauthError(c, session, status, err)
+			return
+		}
+		h.oauthError(c, session, http.StatusInternalServerError, err)
 		return
 	}
 
-	c.SetCookie(oauthStateCookieName, "", -1, "/", "", false, true)
+	if err := h.providerTokens.Save(c.Request.Context(), user.ID, identity.Provider, token); err != nil {
+		h.oauthError(c, session, http.StatusInternalServerError, err)
+		return
+	}
 
-	code := c.Query("code")
-	if code == "" {
-		response.Error(c, http.StatusBadRequest, "code query param missing")
+	if session.RedirectURI != "" && session.ResponseMode == oauth.ResponseModeCode {
+		code, err := h.authService.IssueLoginCode(c.Request.Context(), user)
+		if err != nil {
+			h.oauthError(c, session, http.StatusInternalServerError, err)
+			return
+		}
+		redirectWithParams(c, session.RedirectURI, url.Values{"code": {code}})
 		return
 	}
 
-	token, err := h.googleService.Exchange(c.Request.Context(), code)
+	jwtToken, err := h.authService.GenerateToken(c.Request.Context(), user)
 	if err != nil {
+		h.oauthError(c, session, http.StatusInternalServerError, err)
+		return
+	}
+
+	if session.RedirectURI != "" {
+		h.setAccessTokenCookie(c, jwtToken, h.accessTokenMaxAge)
+		redirectWithParams(c, session.RedirectURI, nil)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"token": jwtToken, "user": user})
+}
+
+func (h *AuthHandler) completeLink(c *gin.Context, session *oauth.Session, identity *oauth.Identity, token *oauth2.Token) {
+	id, err := uuid.Parse(session.LinkUserID)
+	if err != nil {
+		h.oauthError(c, session, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+
+	linked, err := h.identityService.Link(c.Request.Context(), id, identity)
+	if err != nil {
+		if errors.Is(err, service.ErrIdentityInUse) || errors.Is(err, service.ErrProviderAlreadyLinked) {
+			h.oauthError(c, session, http.StatusConflict, err)
+			return
+		}
+		h.oauthError(c, session, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.providerTokens.Save(c.Request.Context(), id, identity.Provider, token); err != nil {
+		h.oauthError(c, session, http.StatusInternalServerError, err)
+		return
+	}
+
+	if session.RedirectURI != "" {
+		redirectWithParams(c, session.RedirectURI, url.Values{"linked": {identity.Provider}})
+		return
+	}
+	response.JSON(c, http.StatusOK, gin.H{"identity": linked})
+}
+
+// Error codes passed to the frontend when a browser flow fails.
+const (
+	oauthErrorAccessDenied     = "access_denied"
+	oauthErrorIdentityConflict = "identity_conflict"
+	oauthErrorServer           = "server_error"
+)
+
+// oauthError reports a failed callback as JSON, or for browser flows as an
+// error query parameter on the frontend URL. Browser flows only get a fixed
+// error code, so no internal detail ends up in the browser history or
+// referrers; the detail is logged instead.
+func (h *AuthHandler) oauthError(c *gin.Context, session *oauth.Session, status int, err error) {
+	if session.RedirectURI == "" {
+		response.Error(c, status, err.Error())
+		return
+	}
+
+	code := oauthErrorAccessDenied
+	switch {
+	case status == http.StatusConflict:
+		code = oauthErrorIdentityConflict
+	case status >= http.StatusInternalServerError:
+		code = oauthErrorServer
+	}
+	log.Printf("oauth %s callback failed with %s: %v", session.Provider, code, err)
+	redirectWithParams(c, session.RedirectURI, url.Values{"error": {code}})
+}
+
+type exchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Exchange redeems a one-time login code issued by a browser OAuth flow for an access token.
+func (h *AuthHandler) Exchange(c *gin.Context) {
+	var req exchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	userInfo, err := h.googleService.FetchUserInfo(c.Request.Context(), token)
+	token, user, err := h.authService.ExchangeLoginCode(c.Request.Context(), req.Code)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidLoginCode) {
+			response.Error(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"token": token, "user": user})
+}
+
+// Logout ends the session of the presented token, if any, and clears the
+// access token cookie set by cookie-mode browser sign-ins.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if token, err := middleware.AccessToken(c); err == nil {
+		// Logging out with an expired or already revoked token still succeeds.
+		_ = h.authService.RevokeToken(c.Request.Context(), token)
+	}
+	h.setAccessTokenCookie(c, "", -1)
+	c.Status(http.StatusNoContent)
+}
+
+// Invitation describes the pending invitation for the token in the path, so
+// the invitee can see what they are joining before accepting.
+func (h *AuthHandler) Invitation(c *gin.Context) {
+	invitation, err := h.invitations.Get(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"invitation": invitation})
+}
+
+type acceptInvitationRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Provider string `json:"provider"`
+}
+
+// AcceptInvitation accepts the invitation for the token in the path. Signed-in
+// users accept it for their account, which must have the invited address.
+// Otherwise the body either registers a local account with name and password,
+// or names a provider to sign in with; the latter starts an OAuth flow like
+// OAuthLogin, and the invitation is accepted in the callback.
+func (h *AuthHandler) AcceptInvitation(c *gin.Context) {
+	token := c.Param("token")
+	var req acceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	user, err := h.authService.FindOrCreateOAuthUser(c.Request.Context(), userInfo.Name, userInfo.Email, "google", userInfo.ID)
+	if accessToken, err := middleware.AccessToken(c); err == nil {
+		claims, err := h.authService.ParseToken(c.Request.Context(), accessToken)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		// The route parses its own token, so DenyImpersonation cannot guard it.
+		if claims.Impersonated() {
+			response.Error(c, http.StatusForbidden, "not allowed while impersonating a user")
+			return
+		}
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, "invalid token subject")
+			return
+		}
+		membership, err := h.invitations.AcceptAsUser(c.Request.Context(), token, userID)
+		if err != nil {
+			writeInvitationError(c, err)
+			return
+		}
+		response.JSON(c, http.StatusOK, gin.H{"membership": membership})
+		return
+	}
+
+	if req.Provider != "" {
+		// Report unusable invitations before sending the user to the provider.
+		if _, err := h.invitations.Get(c.Request.Context(), token); err != nil {
+			writeInvitationError(c, err)
+			return
+		}
+		h.startOAuth(c, req.Provider, func(session *oauth.Session) {
+			session.Invitation = token
+		})
+		return
+	}
+
+	fields := make(map[string]string)
+	if strings.TrimSpace(req.Name) == "" {
+		fields["name"] = "is required"
+	}
+	if len(req.Password) < 8 {
+		fields["password"] = "must be at least 8 characters"
+	}
+	if len(fields) > 0 {
+		response.ValidationError(c, fields)
+		return
+	}
+
+	user, membership, err := h.invitations.AcceptWithPassword(c.Request.Context(), token, req.Name, req.Password)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	jwtToken, err := h.authService.GenerateToken(c.Request.Context(), user)
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	jwtToken, err := h.authService.GenerateToken(user)
+	response.JSON(c, http.StatusCreated, gin.H{"token": jwtToken, "user": user, "membership": membership})
+}
+
+type switchOrganizationRequest struct {
+	Organization string `json:"organization" binding:"required"`
+}
+
+// SwitchOrganization re-issues the caller's token with another organization,
+// given by ID or slug, as the active one. Cookie-authenticated requests get
+// the new token in the access token cookie as well.
+func (h *AuthHandler) SwitchOrganization(c *gin.Context) {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		response.Error(c, http.StatusUnauthorized, "missing claims")
+		return
+	}
+
+	var req switchOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, membership, err := h.authService.SwitchOrganization(c.Request.Context(), claims, req.Organization)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusForbidden, "not a member of this organization")
+			return
+		}
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response.JSON(c, http.StatusOK, gin.H{"token": jwtToken, "user": user})
+	if c.GetHeader("Authorization") == "" {
+		h.setAccessTokenCookie(c, token, int(time.Until(claims.ExpiresAt.Time).Seconds()))
+	}
+	response.JSON(c, http.StatusOK, gin.H{"token": token, "membership": membership})
+}
+
+// allowedRedirect reports whether target exactly matches a configured frontend URL,
+// ignoring its query string.
+func (h *AuthHandler) allowedRedirect(target string) bool {
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Fragment != "" {
+		return false
+	}
+	parsed.RawQuery = ""
+	for _, allowed := range h.redirectURLs {
+		if parsed.String() == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func redirectWithParams(c *gin.Context, target string, params url.Values) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, parsed.String())
+}
+
+// ListIdentities returns the providers linked to the authenticated user.
+func (h *AuthHandler) ListIdentities(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	identities, err := h.identityService.List(c.Request.Context(), id)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity removes a linked provider from the authenticated user.
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identityService.Unlink(c.Request.Context(), id, c.Param("provider")); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.Error(c, http.StatusNotFound, "identity not found")
+		case errors.Is(err, service.ErrLastLoginMethod):
+			response.Error(c, http.StatusConflict, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// currentUserID returns the authenticated user's ID, writing an error response if absent.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		response.Error(c, http.StatusUnauthorized, "missing claims")
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "invalid token subject")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// Providers lists the configured OAuth providers.
+func (h *AuthHandler) Providers(c *gin.Context) {
+	response.JSON(c, http.StatusOK, gin.H{"providers": h.providers.Names()})
+}
+
+// setAccessTokenCookie writes the access token as an HttpOnly, SameSite=Lax cookie.
+func (h *AuthHandler) setAccessTokenCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.AccessTokenCookieName, value, maxAge, "/", "", h.secureCookies, true)
+}
+
+// setOAuthCookie writes the sealed OAuth session as an HttpOnly, SameSite=Lax cookie.
+// Lax is required so the cookie survives the top-level redirect back from the provider.
+func (h *AuthHandler) setOAuthCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthSessionCookieName, value, maxAge, "/", "", h.secureCookies, true)
 }
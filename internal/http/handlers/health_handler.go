@@ -4,15 +4,36 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/cache"
 )
 
 // HealthHandler exposes a simple health check endpoint.
-type HealthHandler struct{}
+type HealthHandler struct {
+	userCache   cache.StatsProvider
+	authMetrics *service.AuthMetrics
+}
 
-// NewHealthHandler constructs a HealthHandler.
-func NewHealthHandler() *HealthHandler { return &HealthHandler{} }
+// NewHealthHandler constructs a HealthHandler. userCache may be nil when
+// caching is disabled, and authMetrics when it is not collected.
+func NewHealthHandler(userCache cache.StatsProvider, authMetrics *service.AuthMetrics) *HealthHandler {
+	return &HealthHandler{userCache: userCache, authMetrics: authMetrics}
+}
 
 // Health responds with a status indicator.
 func (h *HealthHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
+
+// Metrics reports cache hit/miss counters and authentication counts.
+func (h *HealthHandler) Metrics(c *gin.Context) {
+	metrics := gin.H{}
+	if h.userCache != nil {
+		metrics["user_cache"] = h.userCache.Stats()
+	}
+	if h.authMetrics != nil {
+		metrics["auth"] = h.authMetrics.Stats()
+	}
+	c.JSON(http.StatusOK, metrics)
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/http/middleware"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/response"
+)
+
+// MeHandler serves the authenticated user's own account. Every endpoint acts
+// on the user in the token, so no user ID is taken from the request.
+type MeHandler struct {
+	userService        service.UserManager
+	accountService     *service.AccountService
+	emailChangeService *service.EmailChangeService
+	privacyService     *service.PrivacyService
+}
+
+// NewMeHandler constructs a new MeHandler.
+func NewMeHandler(userService service.UserManager, accountService *service.AccountService, emailChangeService *service.EmailChangeService, privacyService *service.PrivacyService) *MeHandler {
+	return &MeHandler{userService: userService, accountService: accountService, emailChangeService: emailChangeService, privacyService: privacyService}
+}
+
+// Get returns the authenticated user.
+func (h *MeHandler) Get(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.Get(c.Request.Context(), id)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"user": user})
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to the authenticated user's profile.
+func (h *MeHandler) Patch(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	patch, ok := readPatch(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.Patch(c.Request.Context(), id, patch)
+	if err != nil {
+		writeUpdateError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"user": user})
+}
+
+// Delete removes the authenticated user's account.
+func (h *MeHandler) Delete(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.accountService.Delete(c.Request.Context(), id); err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type deactivateRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// Deactivate deactivates the authenticated user's account and signs out all
+// of its sessions. Signing in again reactivates the account.
+func (h *MeHandler) Deactivate(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req deactivateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := h.accountService.Deactivate(c.Request.Context(), id, req.Reason); err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type exportQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+// Export downloads everything stored about the authenticated user, as a
+// single JSON document or, with format=zip, a zip archive of JSON files.
+func (h *MeHandler) Export(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var query exportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	export, err := h.privacyService.Export(c.Request.Context(), id)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := "export-" + id.String() + "-" + export.ExportedAt.Format("20060102T150405Z")
+	if query.Format == "zip" {
+		var buf bytes.Buffer
+		if err := export.WriteZip(&buf); err != nil {
+			response.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+		return
+	}
+
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+type erasureRequest struct {
+	Password string `json:"password"`
+}
+
+// RequestErasure queues the erasure of the authenticated user's personal
+// data. Accounts with a password must confirm it. The account is erased in
+// the background and signed out everywhere when that happens.
+func (h *MeHandler) RequestErasure(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req erasureRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	request, err := h.privacyService.RequestOwnErasure(c.Request.Context(), id, req.Password)
+	if err != nil {
+		writeErasureError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, gin.H{"erasure_request": request})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// ChangePassword sets a new password after verifying the current one. Other
+// sessions are signed out; the session making the request stays active.
+func (h *MeHandler) ChangePassword(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionID := middleware.GetClaims(c).SessionID()
+	if err := h.accountService.ChangePassword(c.Request.Context(), id, sessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			response.Error(c, http.StatusForbidden, "current password is incorrect")
+		case errors.Is(err, service.ErrPasswordNotSet):
+			response.Error(c, http.StatusConflict, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Sessions lists the devices the authenticated user is signed in on.
+func (h *MeHandler) Sessions(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.accountService.Sessions(c.Request.Context(), id, middleware.GetClaims(c).SessionID())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs out one of the authenticated user's sessions.
+func (h *MeHandler) RevokeSession(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	if err := h.accountService.RevokeSession(c.Request.Context(), id, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusNotFound, "session not found")
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type changeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"`
+}
+
+// ChangeEmail starts changing the authenticated user's email. The change is
+// applied once the link sent to the new address is confirmed.
+func (h *MeHandler) ChangeEmail(c *gin.Context) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req changeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.emailChangeService.Request(c.Request.Context(), id, req.Email, req.Password); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			response.Error(c, http.StatusForbidden, "password is incorrect")
+		case errors.Is(err, service.ErrEmailUnchanged):
+			response.Error(c, http.StatusConflict, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+type emailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ConfirmEmailChange applies a pending email change using the token sent to the new address.
+func (h *MeHandler) ConfirmEmailChange(c *gin.Context) {
+	var req emailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.emailChangeService.Confirm(c.Request.Context(), req.Token)
+	if err != nil {
+		writeEmailChangeError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"user": user})
+}
+
+// CancelEmailChange discards a pending email change using the token sent to the old address.
+func (h *MeHandler) CancelEmailChange(c *gin.Context) {
+	var req emailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.emailChangeService.Cancel(c.Request.Context(), req.Token); err != nil {
+		writeEmailChangeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func writeEmailChangeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmailChangeToken):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrEmailTaken):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/http/middleware"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/response"
+)
+
+// OrganizationHandler serves organizations and their memberships. Endpoints
+// under /org act on the organization resolved by the Tenant middleware.
+type OrganizationHandler struct {
+	orgService  *service.OrganizationService
+	invitations *service.InvitationService
+}
+
+// NewOrganizationHandler constructs a new OrganizationHandler.
+func NewOrganizationHandler(orgService *service.OrganizationService, invitations *service.InvitationService) *OrganizationHandler {
+	return &OrganizationHandler{orgService: orgService, invitations: invitations}
+}
+
+type createOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
+}
+
+// Create creates an organization owned by the authenticated user.
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	membership, err := h.orgService.Create(c.Request.Context(), userID, req.Name, req.Slug)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusCreated, gin.H{"membership": membership})
+}
+
+// List returns the authenticated user's memberships with their organizations.
+func (h *OrganizationHandler) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	memberships, err := h.orgService.ListForUser(c.Request.Context(), userID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"memberships": memberships})
+}
+
+// Current returns the current organization and the user's membership of it.
+func (h *OrganizationHandler) Current(c *gin.Context) {
+	response.JSON(c, http.StatusOK, gin.H{"membership": middleware.GetMembership(c)})
+}
+
+// Members lists the current organization's memberships.
+func (h *OrganizationHandler) Members(c *gin.Context) {
+	memberships, err := h.orgService.Members(c.Request.Context(), middleware.GetMembership(c).OrganizationID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"members": memberships})
+}
+
+type updateMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateMember changes a member's role in the current organization.
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var req updateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	membership, err := h.orgService.UpdateMemberRole(c.Request.Context(), middleware.GetMembership(c), userID, req.Role)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"membership": membership})
+}
+
+// RemoveMember removes a member from the current organization. Members may
+// remove themselves to leave it.
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := h.orgService.RemoveMember(c.Request.Context(), middleware.GetMembership(c), userID); err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type createInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// CreateInvitation invites an email address to the current organization and
+// emails it the invitation link.
+func (h *OrganizationHandler) CreateInvitation(c *gin.Context) {
+	var req createInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invitation, err := h.invitations.Create(c.Request.Context(), middleware.GetMembership(c), req.Email, req.Role)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusCreated, gin.H{"invitation": invitation})
+}
+
+// Invitations lists the current organization's invitations, newest first.
+func (h *OrganizationHandler) Invitations(c *gin.Context) {
+	invitations, err := h.invitations.List(c.Request.Context(), middleware.GetMembership(c).OrganizationID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// RevokeInvitation withdraws an invitation so it can no longer be accepted.
+func (h *OrganizationHandler) RevokeInvitation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid invitation id")
+		return
+	}
+
+	if err := h.invitations.Revoke(c.Request.Context(), middleware.GetMembership(c), id); err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ResendInvitation emails an invitation again with a new link and expiry.
+func (h *OrganizationHandler) ResendInvitation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid invitation id")
+		return
+	}
+
+	invitation, err := h.invitations.Resend(c.Request.Context(), middleware.GetMembership(c), id)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"invitation": invitation})
+}
+
+func writeInvitationError(c *gin.Context, err error) {
+	if status, ok := invitationErrorStatus(err); ok {
+		response.Error(c, status, err.Error())
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Error(c, http.StatusNotFound, "invitation not found")
+		return
+	}
+	writeOrganizationError(c, err)
+}
+
+// invitationErrorStatus maps the errors of invitation lookups and acceptance
+// to a status code.
+func invitationErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, service.ErrInvitationExpired), errors.Is(err, service.ErrInvitationRevoked):
+		return http.StatusGone, true
+	case errors.Is(err, service.ErrInvitationAccepted), errors.Is(err, service.ErrInvitationPending),
+		errors.Is(err, service.ErrInvitationAccountExists), errors.Is(err, service.ErrAlreadyMember):
+		return http.StatusConflict, true
+	case errors.Is(err, service.ErrInvitationEmailMismatch):
+		return http.StatusForbidden, true
+	default:
+		return 0, false
+	}
+}
+
+func writeOrganizationError(c *gin.Context, err error) {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ValidationError(c, validationErr.Fields)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "member not found")
+	case errors.Is(err, service.ErrOrganizationRole):
+		response.Error(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrSlugTaken), errors.Is(err, service.ErrLastOwner):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
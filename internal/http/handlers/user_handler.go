@@ -1,23 +1,30 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
+	"github.com/example/golang-rest-boilerplate/internal/http/middleware"
 	"github.com/example/golang-rest-boilerplate/internal/service"
 	"github.com/example/golang-rest-boilerplate/pkg/response"
 )
 
-// UserHandler manages user CRUD endpoints.
+// UserHandler manages user CRUD endpoints. Inside an organization, changes
+// are limited to the members its managers may manage.
 type UserHandler struct {
-	userService *service.UserService
+	userService   service.UserManager
+	searchService *service.UserSearchService
+	members       service.MemberManager
 }
 
 // NewUserHandler constructs a new UserHandler.
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService service.UserManager, searchService *service.UserSearchService, members service.MemberManager) *UserHandler {
+	return &UserHandler{userService: userService, searchService: searchService, members: members}
 }
 
 // List returns all users.
@@ -31,6 +38,39 @@ func (h *UserHandler) List(c *gin.Context) {
 	response.JSON(c, http.StatusOK, gin.H{"users": users})
 }
 
+type searchUsersQuery struct {
+	Q      string `form:"q"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// Search finds users by partial name, display name or email, best match
+// first, with the matching words highlighted. Results are paginated with
+// limit and offset.
+func (h *UserHandler) Search(c *gin.Context) {
+	var query searchUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+
+	results, total, err := h.searchService.Search(c.Request.Context(), query.Q, query.Limit, query.Offset)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			response.ValidationError(c, validationErr.Fields)
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"results": results, "total": total, "limit": query.Limit, "offset": query.Offset})
+}
+
 // Get retrieves a single user by ID.
 func (h *UserHandler) Get(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -65,17 +105,100 @@ func (h *UserHandler) Update(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !h.authorizeEdit(c, id) {
+		return
+	}
 
 	user, err := h.userService.Update(c.Request.Context(), id, req.Name)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, err.Error())
+		writeUpdateError(c, err)
+		return
+	}
+
+	response.JSON(c, http.StatusOK, gin.H{"user": user})
+}
+
+// maxPatchBytes bounds the size of a profile patch document.
+const maxPatchBytes = 16 << 10
+
+// Patch applies a JSON Merge Patch (RFC 7396) to the user's profile.
+func (h *UserHandler) Patch(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	patch, ok := readPatch(c)
+	if !ok || !h.authorizeEdit(c, id) {
+		return
+	}
+
+	user, err := h.userService.Patch(c.Request.Context(), id, patch)
+	if err != nil {
+		writeUpdateError(c, err)
 		return
 	}
 
 	response.JSON(c, http.StatusOK, gin.H{"user": user})
 }
 
-// Delete removes a user account.
+// authorizeEdit checks that the requester may edit the profile of user id in
+// the current organization, writing an error response and returning false
+// when they may not. Outside an organization there is nothing to check.
+func (h *UserHandler) authorizeEdit(c *gin.Context, id uuid.UUID) bool {
+	actor := middleware.GetMembership(c)
+	if actor == nil {
+		return true
+	}
+	if err := h.members.AuthorizeProfileEdit(c.Request.Context(), actor, id); err != nil {
+		writeUpdateError(c, err)
+		return false
+	}
+	return true
+}
+
+// readPatch reads a merge patch document from the request body, writing an
+// error response and returning false when the request is unacceptable.
+func readPatch(c *gin.Context) ([]byte, bool) {
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+	default:
+		response.Error(c, http.StatusUnsupportedMediaType, "content type must be application/merge-patch+json")
+		return nil, false
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchBytes+1))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if len(patch) > maxPatchBytes {
+		response.Error(c, http.StatusRequestEntityTooLarge, "patch too large")
+		return nil, false
+	}
+	return patch, true
+}
+
+func writeUpdateError(c *gin.Context, err error) {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ValidationError(c, validationErr.Fields)
+	case errors.Is(err, service.ErrInvalidPatch):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrOrganizationRole), errors.Is(err, service.ErrSharedMember):
+		response.Error(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "user not found")
+	default:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Delete removes a user. Inside an organization only the membership is
+// removed, leaving the account and its other memberships alone; outside one,
+// as under /admin, the account is deleted.
 func (h *UserHandler) Delete(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -83,6 +206,15 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	if actor := middleware.GetMembership(c); actor != nil {
+		if err := h.members.RemoveMember(c.Request.Context(), actor, id); err != nil {
+			writeOrganizationError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+
 	if err := h.userService.Delete(c.Request.Context(), id); err != nil {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
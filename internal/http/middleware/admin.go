@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/response"
+)
+
+// RequireAdmin rejects requests from users without the admin role. It must run
+// after AuthMiddleware. The role is read from the user record rather than the
+// token, so demoting an admin takes effect immediately.
+func RequireAdmin(users service.UserManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetClaims(c)
+		if claims == nil {
+			response.Error(c, http.StatusUnauthorized, "missing claims")
+			return
+		}
+		id, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		user, err := users.Get(c.Request.Context(), id)
+		if err != nil || user.Role != models.RoleAdmin {
+			response.Error(c, http.StatusForbidden, "admin access required")
+			return
+		}
+		c.Next()
+	}
+}
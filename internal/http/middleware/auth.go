@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"github.com/example/golang-rest-boilerplate/internal/service"
 	"github.com/example/golang-rest-boilerplate/pkg/response"
@@ -12,28 +14,75 @@ import (
 
 const userClaimsKey = "userClaims"
 
-// AuthMiddleware validates JWT tokens and attaches claims to the request context.
-func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			response.Error(c, http.StatusUnauthorized, "authorization header missing")
-			return
-		}
+// AccessTokenCookieName is the cookie holding the access token for browser sessions.
+const AccessTokenCookieName = "access_token"
 
+var (
+	errAuthorizationMissing = errors.New("authorization header missing")
+	errAuthorizationInvalid = errors.New("invalid authorization header")
+)
+
+// AccessToken returns the token presented with the request. The token is read
+// from the Authorization header, falling back to the access token cookie set by
+// browser sign-ins.
+func AccessToken(c *gin.Context) (string, error) {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			response.Error(c, http.StatusUnauthorized, "invalid authorization header")
+			return "", errAuthorizationInvalid
+		}
+		return parts[1], nil
+	}
+	if cookie, err := c.Cookie(AccessTokenCookieName); err == nil && cookie != "" {
+		return cookie, nil
+	}
+	return "", errAuthorizationMissing
+}
+
+// AuthMiddleware validates JWT tokens and attaches claims to the request
+// context. Tokens of users who are not active are rejected with 403. The
+// token's user becomes the actor of audited actions, unless an administrator
+// is impersonating them.
+func AuthMiddleware(tokens service.TokenIssuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := AccessToken(c)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, err.Error())
 			return
 		}
 
-		claims, err := authService.ParseToken(parts[1])
+		claims, err := tokens.ParseToken(c.Request.Context(), tokenString)
 		if err != nil {
+			if service.IsAccountStatusError(err) {
+				response.Error(c, http.StatusForbidden, err.Error())
+				return
+			}
 			response.Error(c, http.StatusUnauthorized, "invalid token")
 			return
 		}
 
 		c.Set(userClaimsKey, claims)
+		actorID := claims.ImpersonatorID()
+		if actorID == uuid.Nil {
+			actorID, _ = uuid.Parse(claims.UserID)
+		}
+		if actorID != uuid.Nil {
+			c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), actorID))
+		}
+		c.Next()
+	}
+}
+
+// DenyImpersonation rejects requests made with an impersonated token. It
+// guards operations an administrator must not perform as another user, such
+// as changing their credentials or deleting accounts. It must run after
+// AuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := GetClaims(c); claims != nil && claims.Impersonated() {
+			response.Error(c, http.StatusForbidden, "not allowed while impersonating a user")
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+// ClientInfo records the caller's user agent and IP address in the request
+// context so sessions started by the request can show which device they belong to.
+func ClientInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := service.ClientInfo{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()}
+		c.Request = c.Request.WithContext(service.WithClientInfo(c.Request.Context(), info))
+		c.Next()
+	}
+}
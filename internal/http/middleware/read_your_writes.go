@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/example/golang-rest-boilerplate/internal/db"
+)
+
+// ReadYourWrites pins the rest of a request to the primary database once it
+// has written, so reads never observe replica lag for the request's own changes.
+func ReadYourWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(db.WithPrimaryPin(c.Request.Context()))
+		c.Next()
+	}
+}
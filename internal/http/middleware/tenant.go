@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+	"github.com/example/golang-rest-boilerplate/pkg/response"
+)
+
+// OrganizationHeader selects the organization a request acts in.
+const OrganizationHeader = "X-Organization"
+
+const membershipKey = "membership"
+
+// Tenant resolves the organization a request acts in and scopes the request's
+// user queries to it. It must run after AuthMiddleware. The organization is
+// taken, in order, from the X-Organization header (an ID or slug), the
+// subdomain of baseDomain, and the token's active organization. Requests from
+// users who are not members of the organization are rejected.
+func Tenant(orgs service.TenantResolver, baseDomain string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetClaims(c)
+		if claims == nil {
+			response.Error(c, http.StatusUnauthorized, "missing claims")
+			return
+		}
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		ref := c.GetHeader(OrganizationHeader)
+		if ref == "" {
+			ref = subdomain(c.Request.Host, baseDomain)
+		}
+		if ref == "" {
+			ref = claims.OrgID
+		}
+		if ref == "" {
+			response.Error(c, http.StatusBadRequest, "no organization selected")
+			return
+		}
+
+		ctx := c.Request.Context()
+		org, err := orgs.Resolve(ctx, ref)
+		if err != nil {
+			response.Error(c, http.StatusForbidden, "not a member of this organization")
+			return
+		}
+		membership, err := orgs.Membership(ctx, org.ID, userID)
+		if err != nil {
+			response.Error(c, http.StatusForbidden, "not a member of this organization")
+			return
+		}
+
+		c.Set(membershipKey, membership)
+		c.Request = c.Request.WithContext(repository.WithTenant(ctx, org.ID))
+		c.Next()
+	}
+}
+
+// RequireOrgRole rejects requests whose membership of the current organization
+// has none of roles. It must run after Tenant.
+func RequireOrgRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		membership := GetMembership(c)
+		if membership == nil || !membership.HasRole(roles...) {
+			response.Error(c, http.StatusForbidden, "organization role required: "+strings.Join(roles, " or "))
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetMembership returns the requesting user's membership of the current organization.
+func GetMembership(c *gin.Context) *models.Membership {
+	value, exists := c.Get(membershipKey)
+	if !exists {
+		return nil
+	}
+	if membership, ok := value.(*models.Membership); ok {
+		return membership
+	}
+	return nil
+}
+
+// subdomain returns the single label host has in front of baseDomain, if any.
+func subdomain(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(baseDomain))
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
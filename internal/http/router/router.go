@@ -7,41 +7,120 @@ import (
 	"github.com/example/golang-rest-boilerplate/internal/config"
 	"github.com/example/golang-rest-boilerplate/internal/http/handlers"
 	"github.com/example/golang-rest-boilerplate/internal/http/middleware"
+	"github.com/example/golang-rest-boilerplate/internal/models"
 	"github.com/example/golang-rest-boilerplate/internal/service"
 )
 
 // SetupRouter configures the gin router and routes.
-func SetupRouter(authHandler *handlers.AuthHandler, userHandler *handlers.UserHandler, healthHandler *handlers.HealthHandler, authService *service.AuthService, cfg *config.Config) *gin.Engine {
+func SetupRouter(authHandler *handlers.AuthHandler, userHandler *handlers.UserHandler, meHandler *handlers.MeHandler, orgHandler *handlers.OrganizationHandler, adminHandler *handlers.AdminHandler, healthHandler *handlers.HealthHandler, tokens service.TokenIssuer, userManager service.UserManager, tenants service.TenantResolver, cfg *config.Config) *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.ClientInfo())
 
 	if len(cfg.AllowedOrigins) == 0 || (len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*") {
 		r.Use(cors.Default())
 	} else {
 		corsConfig := cors.DefaultConfig()
 		corsConfig.AllowOrigins = cfg.AllowedOrigins
-		corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
-		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+		corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader, middleware.OrganizationHeader}
+		corsConfig.ExposeHeaders = []string{middleware.RequestIDHeader}
+		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+		corsConfig.AllowCredentials = true
 		r.Use(cors.New(corsConfig))
 	}
 
+	if len(cfg.DBReplicaURLs) > 0 && cfg.DBReadYourWrites {
+		r.Use(middleware.ReadYourWrites())
+	}
+
 	r.GET("/health", healthHandler.Health)
+	r.GET("/metrics", healthHandler.Metrics)
 
 	api := r.Group("/api/v1")
 
+	denyImpersonation := middleware.DenyImpersonation()
+
 	auth := api.Group("/auth")
 	auth.POST("/register", authHandler.Register)
 	auth.POST("/login", authHandler.Login)
-	auth.GET("/google/login", authHandler.GoogleLogin)
-	auth.GET("/google/callback", authHandler.GoogleCallback)
+	auth.POST("/exchange", authHandler.Exchange)
+	auth.POST("/logout", authHandler.Logout)
+	auth.GET("/providers", authHandler.Providers)
+	auth.POST("/email-change/confirm", meHandler.ConfirmEmailChange)
+	auth.POST("/email-change/cancel", meHandler.CancelEmailChange)
+	auth.GET("/:provider/login", authHandler.OAuthLogin)
+	auth.GET("/:provider/callback", authHandler.OAuthCallback)
+	auth.GET("/:provider/link", middleware.AuthMiddleware(tokens), denyImpersonation, authHandler.OAuthLink)
+	auth.POST("/switch-org", middleware.AuthMiddleware(tokens), authHandler.SwitchOrganization)
+	auth.GET("/invitations/:token", authHandler.Invitation)
+	auth.POST("/invitations/:token/accept", authHandler.AcceptInvitation)
+
+	me := api.Group("/me")
+	me.Use(middleware.AuthMiddleware(tokens))
+	me.GET("", meHandler.Get)
+	me.PATCH("", meHandler.Patch)
+	me.DELETE("", denyImpersonation, meHandler.Delete)
+	me.POST("/deactivate", denyImpersonation, meHandler.Deactivate)
+	me.PUT("/password", denyImpersonation, meHandler.ChangePassword)
+	me.POST("/email", denyImpersonation, meHandler.ChangeEmail)
+	me.GET("/export", denyImpersonation, meHandler.Export)
+	me.POST("/erasure", denyImpersonation, meHandler.RequestErasure)
+	me.GET("/sessions", meHandler.Sessions)
+	me.DELETE("/sessions/:id", denyImpersonation, meHandler.RevokeSession)
+
+	identities := api.Group("/identities")
+	identities.Use(middleware.AuthMiddleware(tokens))
+	identities.GET("", authHandler.ListIdentities)
+	identities.DELETE("/:provider", denyImpersonation, authHandler.UnlinkIdentity)
+
+	orgs := api.Group("/orgs")
+	orgs.Use(middleware.AuthMiddleware(tokens))
+	orgs.GET("", orgHandler.List)
+	orgs.POST("", denyImpersonation, orgHandler.Create)
+
+	tenant := middleware.Tenant(tenants, cfg.TenantDomain)
+	orgManagers := middleware.RequireOrgRole(models.OrgRoleOwner, models.OrgRoleAdmin)
+
+	org := api.Group("/org")
+	org.Use(middleware.AuthMiddleware(tokens), tenant)
+	org.GET("", orgHandler.Current)
+	org.GET("/members", orgHandler.Members)
+	org.PUT("/members/:user_id", denyImpersonation, orgManagers, orgHandler.UpdateMember)
+	org.DELETE("/members/:user_id", denyImpersonation, orgHandler.RemoveMember)
+	org.GET("/invitations", orgManagers, orgHandler.Invitations)
+	org.POST("/invitations", denyImpersonation, orgManagers, orgHandler.CreateInvitation)
+	org.DELETE("/invitations/:id", denyImpersonation, orgManagers, orgHandler.RevokeInvitation)
+	org.POST("/invitations/:id/resend", denyImpersonation, orgManagers, orgHandler.ResendInvitation)
 
 	users := api.Group("/users")
-	users.Use(middleware.AuthMiddleware(authService))
+	users.Use(middleware.AuthMiddleware(tokens), tenant)
 	users.GET("", userHandler.List)
+	users.GET("/search", userHandler.Search)
 	users.GET("/:id", userHandler.Get)
-	users.PUT("/:id", userHandler.Update)
-	users.DELETE("/:id", userHandler.Delete)
+	users.PUT("/:id", denyImpersonation, orgManagers, userHandler.Update)
+	users.PATCH("/:id", denyImpersonation, orgManagers, userHandler.Patch)
+	users.DELETE("/:id", denyImpersonation, orgManagers, userHandler.Delete)
+
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(tokens), middleware.RequireAdmin(userManager))
+	admin.GET("/audit-events", adminHandler.AuditEvents)
+	admin.POST("/users/import", adminHandler.ImportUsers)
+	admin.GET("/users/export", adminHandler.ExportUsers)
+	admin.DELETE("/users/:id", denyImpersonation, userHandler.Delete)
+	admin.POST("/users/:id/impersonate", adminHandler.Impersonate)
+	admin.PUT("/users/:id/status", adminHandler.SetUserStatus)
+	admin.POST("/users/:id/erasure", adminHandler.RequestErasure)
+	admin.GET("/erasure-requests", adminHandler.ErasureRequests)
+	admin.GET("/erasure-requests/:id", adminHandler.GetErasureRequest)
+	admin.GET("/webhooks", adminHandler.ListWebhooks)
+	admin.POST("/webhooks", adminHandler.CreateWebhook)
+	admin.GET("/webhooks/:id", adminHandler.GetWebhook)
+	admin.PUT("/webhooks/:id", adminHandler.UpdateWebhook)
+	admin.DELETE("/webhooks/:id", adminHandler.DeleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", adminHandler.WebhookDeliveries)
+	admin.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", adminHandler.RedeliverWebhook)
 
 	return r
 }
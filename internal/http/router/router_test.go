@@ -0,0 +1,631 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/http/handlers"
+	"github.com/example/golang-rest-boilerplate/internal/http/router"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/repository/memorystore"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func setupRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	r, _ := setupRouterWithUsers(t)
+	return r
+}
+
+// setupRouterWithUsers also returns the user store, for tests that change users directly.
+func setupRouterWithUsers(t *testing.T) (*gin.Engine, *memorystore.UserStore) {
+	t.Helper()
+	r, users, _ := setupRouterWithStores(t)
+	return r, users
+}
+
+// setupRouterWithStores also returns the user and organization stores.
+func setupRouterWithStores(t *testing.T) (*gin.Engine, *memorystore.UserStore, *memorystore.OrganizationStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{JWTSecret: "secret", JWTIssuer: "test", TokenExpireMinutes: 60, ImpersonationTTLMinutes: 15, InvitationTTLHours: 168, AllowedOrigins: []string{"*"}}
+	orgs := memorystore.NewOrganizationStore()
+	users := memorystore.NewUserStore().ScopeTo(orgs)
+	identities := memorystore.NewIdentityStore()
+
+	sessions := memorystore.NewSessionStore()
+	transactor := repository.NewMemoryTransactor()
+	audit := service.NewAuditService(memorystore.NewAuditStore())
+	queue := jobs.NewQueue(memorystore.NewJobStore())
+	webhooks, err := service.NewWebhookService(memorystore.NewWebhookStore(), queue, transactor, cfg)
+	require.NoError(t, err)
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	webhooks.Subscribe(bus)
+	orgService := service.NewOrganizationService(orgs, transactor, audit)
+	orgService.Subscribe(bus)
+
+	loginCodes := memorystore.NewLoginCodeStore()
+	authService := service.NewAuthService(users, identities, loginCodes, sessions, orgs, transactor, audit, bus, cfg)
+	providers := oauth.NewRegistry()
+	providerTokens, err := service.NewProviderTokenService(identities, providers, cfg)
+	require.NoError(t, err)
+	sessionCodec, err := oauth.NewSessionCodec(cfg.JWTSecret)
+	require.NoError(t, err)
+
+	templates, err := mailer.NewTemplates()
+	require.NoError(t, err)
+	mail := mailer.NewMemoryMailer()
+	invitations := service.NewInvitationService(memorystore.NewInvitationStore(orgs), orgs, users, authService, transactor, mail, templates, audit, cfg)
+	invitations.Subscribe(bus)
+
+	authHandler := handlers.NewAuthHandler(authService, service.NewIdentityService(users, identities, transactor, audit, bus), invitations, providerTokens, providers, sessionCodec, cfg)
+	userService := service.NewUserService(users, transactor, bus)
+	userHandler := handlers.NewUserHandler(userService, service.NewUserSearchService(users), orgService)
+	emailChangeStore := memorystore.NewEmailChangeStore()
+	emailChanges := service.NewEmailChangeService(users, emailChangeStore, transactor, mail, templates, audit, bus, cfg)
+	accountService := service.NewAccountService(users, identities, sessions, loginCodes, emailChangeStore, transactor, audit, bus)
+	accountService.Subscribe(bus)
+	privacy := service.NewPrivacyService(users, identities, sessions, loginCodes, emailChangeStore, orgs, memorystore.NewErasureStore(), queue, transactor, audit, bus)
+	meHandler := handlers.NewMeHandler(userService, accountService, emailChanges, privacy)
+	return router.SetupRouter(authHandler, userHandler, meHandler, handlers.NewOrganizationHandler(orgService, invitations), handlers.NewAdminHandler(audit, webhooks, authService, accountService, privacy, service.NewUserTransferService(users, transactor, audit, bus)), handlers.NewHealthHandler(nil, nil), authService, userService, orgService, cfg), users, orgs
+}
+
+func doJSON(r http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegisterLoginAndListUsers(t *testing.T) {
+	r := setupRouter(t)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{"name": "Alice", "email": "alice@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "alice@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var login struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	require.NotEmpty(t, login.Data.Token)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/users", "", nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token := createOrganization(t, r, login.Data.Token, "acme")
+	w = doJSON(r, http.MethodGet, "/api/v1/users", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "alice@example.com")
+}
+
+func TestUnknownOAuthProvider(t *testing.T) {
+	r := setupRouter(t)
+
+	w := doJSON(r, http.MethodGet, "/api/v1/auth/unknown/login", "", nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func login(t *testing.T, r http.Handler, name, email string) (token, userID string) {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{"name": name, "email": email, "password": "Password123"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": email, "password": "Password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Data struct {
+			Token string `json:"token"`
+			User  struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Data.Token, body.Data.User.ID
+}
+
+// createOrganization creates an organization owned by the token's user and
+// returns a token with it as the active organization.
+func createOrganization(t *testing.T, r http.Handler, token, slug string) string {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/orgs", token, gin.H{"name": slug, "slug": slug})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	return switchOrganization(t, r, token, slug)
+}
+
+// switchOrganization returns a token with slug as the active organization.
+func switchOrganization(t *testing.T, r http.Handler, token, slug string) string {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/switch-org", token, gin.H{"organization": slug})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var body struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Data.Token
+}
+
+func TestPatchUserProfile(t *testing.T) {
+	r := setupRouter(t)
+	token, id := login(t, r, "Bob", "bob@example.com")
+	token = createOrganization(t, r, token, "bobs")
+	path := "/api/v1/users/" + id
+
+	w := doJSON(r, http.MethodPatch, path, token, gin.H{
+		"display_name": "Bobby",
+		"locale":       "en-gb",
+		"timezone":     "Europe/London",
+		"metadata":     gin.H{"theme": "dark", "beta": true},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doJSON(r, http.MethodPatch, path, token, gin.H{"metadata": gin.H{"beta": nil}, "timezone": nil})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var body struct {
+		Data struct {
+			User struct {
+				Name        string                 `json:"name"`
+				DisplayName string                 `json:"display_name"`
+				Locale      string                 `json:"locale"`
+				Timezone    string                 `json:"timezone"`
+				Metadata    map[string]interface{} `json:"metadata"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Bob", body.Data.User.Name)
+	require.Equal(t, "Bobby", body.Data.User.DisplayName)
+	require.Equal(t, "en-GB", body.Data.User.Locale)
+	require.Empty(t, body.Data.User.Timezone)
+	require.Equal(t, map[string]interface{}{"theme": "dark"}, body.Data.User.Metadata)
+
+	w = doJSON(r, http.MethodPatch, path, token, gin.H{
+		"email":      "mallory@example.com",
+		"avatar_url": "javascript:alert(1)",
+		"timezone":   "Mars/Olympus",
+		"name":       "",
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var invalid struct {
+		Fields map[string]string `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invalid))
+	require.Len(t, invalid.Fields, 4)
+	require.Contains(t, invalid.Fields, "email")
+
+	w = doJSON(r, http.MethodGet, path, token, nil)
+	require.Contains(t, w.Body.String(), "bob@example.com")
+	require.Contains(t, w.Body.String(), `"display_name":"Bobby"`)
+}
+
+func TestMeEndpoints(t *testing.T) {
+	r := setupRouter(t)
+	first, _ := login(t, r, "Carol", "carol@example.com")
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "carol@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	second := body.Data.Token
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me", first, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "carol@example.com")
+
+	w = doJSON(r, http.MethodPatch, "/api/v1/me", first, gin.H{"display_name": "Caz"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"display_name":"Caz"`)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me/sessions", first, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var sessions struct {
+		Data struct {
+			Sessions []struct {
+				ID      string `json:"id"`
+				Current bool   `json:"current"`
+			} `json:"sessions"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	require.Len(t, sessions.Data.Sessions, 2)
+
+	w = doJSON(r, http.MethodPut, "/api/v1/me/password", first, gin.H{"current_password": "wrong-password", "new_password": "NewPassword123"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, http.MethodPut, "/api/v1/me/password", first, gin.H{"current_password": "Password123", "new_password": "NewPassword123"})
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// Changing the password signs out every other session.
+	w = doJSON(r, http.MethodGet, "/api/v1/me", second, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "carol@example.com", "password": "NewPassword123"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, http.MethodDelete, "/api/v1/me", first, nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me", first, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuditLog(t *testing.T) {
+	r, users := setupRouterWithUsers(t)
+	token, id := login(t, r, "Erin", "erin@example.com")
+	token = createOrganization(t, r, token, "erins")
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "erin@example.com", "password": "wrong-password"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+id, bytes.NewBufferString(`{"name":"Erin B"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "req-123")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "req-123", w.Header().Get("X-Request-ID"))
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events", token, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	user, err := users.GetByID(context.Background(), uuid.MustParse(id))
+	require.NoError(t, err)
+	user.Role = models.RoleAdmin
+	require.NoError(t, users.Update(context.Background(), user))
+
+	type auditPage struct {
+		Data struct {
+			Events []models.AuditEvent `json:"events"`
+			Total  int64               `json:"total"`
+		} `json:"data"`
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?action=user.updated&target_id="+id, token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page auditPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.EqualValues(t, 1, page.Data.Total)
+	event := page.Data.Events[0]
+	require.Equal(t, id, event.ActorID.String())
+	require.Equal(t, "req-123", event.RequestID)
+	require.Equal(t, models.AuditChange{From: "Erin", To: "Erin B"}, event.Changes["name"])
+	require.NotContains(t, event.Changes, "updated_at")
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?limit=1", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	page = auditPage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.EqualValues(t, 5, page.Data.Total, "registration, login, organization, failed login and update")
+	require.Len(t, page.Data.Events, 1)
+	require.Equal(t, "user.updated", page.Data.Events[0].Action)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?action=auth.login_failed", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	page = auditPage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data.Events, 1)
+	require.Nil(t, page.Data.Events[0].ActorID)
+	require.Equal(t, id, page.Data.Events[0].TargetID)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?actor_id=not-a-uuid", token, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOrganizations(t *testing.T) {
+	r := setupRouter(t)
+	alice, aliceID := login(t, r, "Alice", "alice@example.com")
+	bob, bobID := login(t, r, "Bob", "bob@example.com")
+
+	w := doJSON(r, http.MethodGet, "/api/v1/users", alice, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code, "no organization yet")
+
+	alice = createOrganization(t, r, alice, "acme")
+	bob = createOrganization(t, r, bob, "globex")
+
+	w = doJSON(r, http.MethodPost, "/api/v1/orgs", alice, gin.H{"name": "Acme Again", "slug": "acme"})
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	// User queries only see the members of the active organization.
+	w = doJSON(r, http.MethodGet, "/api/v1/users", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), aliceID)
+	require.NotContains(t, w.Body.String(), bobID)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/users/"+bobID, alice, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(r, http.MethodPut, "/api/v1/users/"+bobID, alice, gin.H{"name": "Mallory"})
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// Selecting another organization requires membership, by header or by switching.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("X-Organization", "globex")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/switch-org", alice, gin.H{"organization": "globex"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/org", bob, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"slug":"globex"`)
+	require.Contains(t, w.Body.String(), `"role":"owner"`)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/orgs", bob, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "acme")
+
+	// The last owner cannot leave.
+	w = doJSON(r, http.MethodDelete, "/api/v1/org/members/"+bobID, bob, nil)
+	require.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestOrganizationUserManagement(t *testing.T) {
+	r, users, orgs := setupRouterWithStores(t)
+	ctx := context.Background()
+	alice, aliceID := login(t, r, "Alice", "alice@example.com")
+	bob, bobID := login(t, r, "Bob", "bob@example.com")
+	carol, carolID := login(t, r, "Carol", "carol@example.com")
+	alice = createOrganization(t, r, alice, "acme")
+	createOrganization(t, r, carol, "globex")
+
+	acme, err := orgs.GetBySlug(ctx, "acme")
+	require.NoError(t, err)
+	require.NoError(t, orgs.AddMember(ctx, &models.Membership{OrganizationID: acme.ID, UserID: uuid.MustParse(bobID), Role: models.OrgRoleMember}))
+	require.NoError(t, orgs.AddMember(ctx, &models.Membership{OrganizationID: acme.ID, UserID: uuid.MustParse(carolID), Role: models.OrgRoleAdmin}))
+	carol = switchOrganization(t, r, carol, "acme")
+
+	// Profile edits are limited to members the requester may manage who
+	// belong to no other organization.
+	w := doJSON(r, http.MethodPut, "/api/v1/users/"+bobID, carol, gin.H{"name": "Robert"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doJSON(r, http.MethodPut, "/api/v1/users/"+aliceID, carol, gin.H{"name": "Mallory"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, http.MethodPatch, "/api/v1/users/"+carolID, alice, gin.H{"display_name": "Mallory"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "other organizations")
+
+	// Deleting inside an organization only removes the membership.
+	w = doJSON(r, http.MethodDelete, "/api/v1/users/"+aliceID, carol, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, http.MethodDelete, "/api/v1/users/"+bobID, carol, nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(r, http.MethodGet, "/api/v1/users/"+bobID, alice, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(r, http.MethodGet, "/api/v1/me", bob, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Deleting accounts is reserved to administrators.
+	w = doJSON(r, http.MethodDelete, "/api/v1/admin/users/"+bobID, alice, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	admin, err := users.GetByID(ctx, uuid.MustParse(aliceID))
+	require.NoError(t, err)
+	admin.Role = models.RoleAdmin
+	require.NoError(t, users.Update(ctx, admin))
+	w = doJSON(r, http.MethodDelete, "/api/v1/admin/users/"+bobID, alice, nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(r, http.MethodGet, "/api/v1/me", bob, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestImpersonation(t *testing.T) {
+	r, users := setupRouterWithUsers(t)
+	adminToken, adminID := login(t, r, "Grace", "grace@example.com")
+	userToken, userID := login(t, r, "Heidi", "heidi@example.com")
+	createOrganization(t, r, userToken, "heidis")
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/users/"+userID+"/impersonate", adminToken, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	admin, err := users.GetByID(context.Background(), uuid.MustParse(adminID))
+	require.NoError(t, err)
+	admin.Role = models.RoleAdmin
+	require.NoError(t, users.Update(context.Background(), admin))
+
+	w = doJSON(r, http.MethodPost, "/api/v1/admin/users/"+adminID+"/impersonate", adminToken, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/admin/users/"+userID+"/impersonate", adminToken, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var body struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	token := body.Data.Token
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "heidi@example.com")
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me/sessions", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"impersonator_id":"`+adminID+`"`)
+
+	w = doJSON(r, http.MethodPut, "/api/v1/me/password", token, gin.H{"current_password": "Password123", "new_password": "Password456"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, http.MethodDelete, "/api/v1/me", token, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Organization, membership, profile and session changes are refused too.
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/orgs"},
+		{http.MethodPost, "/api/v1/auth/invitations/" + uuid.NewString() + "/accept"},
+		{http.MethodPut, "/api/v1/users/" + userID},
+		{http.MethodPatch, "/api/v1/users/" + userID},
+		{http.MethodPut, "/api/v1/org/members/" + userID},
+		{http.MethodDelete, "/api/v1/org/members/" + userID},
+		{http.MethodPost, "/api/v1/org/invitations"},
+		{http.MethodDelete, "/api/v1/org/invitations/" + uuid.NewString()},
+		{http.MethodPost, "/api/v1/org/invitations/" + uuid.NewString() + "/resend"},
+		{http.MethodDelete, "/api/v1/me/sessions/" + uuid.NewString()},
+	} {
+		w = doJSON(r, route.method, route.path, token, gin.H{"name": "Evil Corp", "role": "owner", "email": "eve@example.com"})
+		require.Equal(t, http.StatusForbidden, w.Code, route.method+" "+route.path)
+		require.Contains(t, w.Body.String(), "impersonat", route.method+" "+route.path)
+	}
+
+	w = doJSON(r, http.MethodPatch, "/api/v1/me", token, gin.H{"name": "Heidi K"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/logout", token, nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(r, http.MethodGet, "/api/v1/me", token, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	type auditPage struct {
+		Data struct {
+			Events []models.AuditEvent `json:"events"`
+		} `json:"data"`
+	}
+	for _, action := range []string{"auth.impersonation_started", "user.updated", "auth.impersonation_ended"} {
+		w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?action="+action+"&target_id="+userID, adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var page auditPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Data.Events, 1, action)
+		require.Equal(t, adminID, page.Data.Events[0].ActorID.String(), action)
+	}
+}
+
+func TestUserStatus(t *testing.T) {
+	r, users := setupRouterWithUsers(t)
+	adminToken, adminID := login(t, r, "Ivan", "ivan@example.com")
+	token, userID := login(t, r, "Judy", "judy@example.com")
+
+	admin, err := users.GetByID(context.Background(), uuid.MustParse(adminID))
+	require.NoError(t, err)
+	admin.Role = models.RoleAdmin
+	require.NoError(t, users.Update(context.Background(), admin))
+
+	w := doJSON(r, http.MethodPut, "/api/v1/admin/users/"+userID+"/status", adminToken, gin.H{"status": "banned"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	// Sign-in reactivates deactivated accounts, so only their owners deactivate them.
+	w = doJSON(r, http.MethodPut, "/api/v1/admin/users/"+userID+"/status", adminToken, gin.H{"status": "deactivated"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = doJSON(r, http.MethodPut, "/api/v1/admin/users/"+adminID+"/status", adminToken, gin.H{"status": "suspended"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, http.MethodPut, "/api/v1/admin/users/"+userID+"/status", adminToken, gin.H{"status": "suspended", "reason": "chargeback"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"status_reason":"chargeback"`)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/me", token, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code, "sessions are signed out")
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "judy@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "account is suspended")
+
+	w = doJSON(r, http.MethodPut, "/api/v1/admin/users/"+userID+"/status", adminToken, gin.H{"status": "active"})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "judy@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	token = body.Data.Token
+
+	w = doJSON(r, http.MethodPost, "/api/v1/me/deactivate", token, gin.H{"reason": "taking a break"})
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(r, http.MethodGet, "/api/v1/me", token, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": "judy@example.com", "password": "Password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"status":"active"`)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/audit-events?action=user.status_changed&target_id="+userID, adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Data struct {
+			Events []models.AuditEvent `json:"events"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data.Events, 4)
+	require.Equal(t, userID, page.Data.Events[0].ActorID.String(), "signing in reactivates the account")
+	require.Equal(t, "deactivated", page.Data.Events[0].Details["from"])
+}
+
+func TestSearchUsers(t *testing.T) {
+	r := setupRouter(t)
+	alice, aliceID := login(t, r, "Alice <Liddell>", "alice@example.com")
+	bob, _ := login(t, r, "Bob", "bob@example.com")
+	alice = createOrganization(t, r, alice, "wonderland")
+	createOrganization(t, r, bob, "builders")
+
+	w := doJSON(r, http.MethodGet, "/api/v1/users/search?q=a", alice, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/users/search?q=LI", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Data struct {
+			Results []struct {
+				User       struct{ ID string } `json:"user"`
+				Highlights map[string]string   `json:"highlights"`
+			} `json:"results"`
+			Total int `json:"total"`
+			Limit int `json:"limit"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Equal(t, 1, page.Data.Total)
+	require.Equal(t, 50, page.Data.Limit)
+	require.Equal(t, aliceID, page.Data.Results[0].User.ID)
+	require.Equal(t, "A<mark>li</mark>ce &lt;<mark>Li</mark>ddell&gt;", page.Data.Results[0].Highlights["name"])
+	require.Equal(t, "a<mark>li</mark>ce@example.com", page.Data.Results[0].Highlights["email"])
+
+	// Only members of the active organization are found.
+	w = doJSON(r, http.MethodGet, "/api/v1/users/search?q=bob", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"total":0`)
+}
@@ -0,0 +1,122 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestRunner(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:jobs?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := repository.NewJobRepository(database)
+	queue := jobs.NewQueue(store)
+	runner := jobs.NewRunner(store, jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond, RetryBaseDelay: 10 * time.Millisecond})
+
+	greeted := make(chan string, 1)
+	jobs.Handle(runner, "greet", func(ctx context.Context, g greeting) error {
+		greeted <- g.Name
+		return nil
+	})
+	var flakyCalls int32
+	jobs.Handle(runner, "flaky", func(ctx context.Context, _ struct{}) error {
+		if atomic.AddInt32(&flakyCalls, 1) == 1 {
+			return errors.New("temporarily unavailable")
+		}
+		return nil
+	})
+	jobs.Handle(runner, "broken", func(ctx context.Context, _ struct{}) error {
+		return errors.New("always fails")
+	})
+	jobs.Handle(runner, "invalid", func(ctx context.Context, _ struct{}) error {
+		return jobs.Permanent(errors.New("bad input"))
+	})
+
+	require.NoError(t, queue.Enqueue(ctx, "greet", greeting{Name: "Ada"}, jobs.UniqueKey("greet:ada")))
+	require.NoError(t, queue.Enqueue(ctx, "greet", greeting{Name: "Ada"}, jobs.UniqueKey("greet:ada")))
+	require.NoError(t, queue.Enqueue(ctx, "flaky", struct{}{}))
+	require.NoError(t, queue.Enqueue(ctx, "broken", struct{}{}, jobs.MaxAttempts(3)))
+	require.NoError(t, queue.Enqueue(ctx, "invalid", struct{}{}))
+	require.NoError(t, queue.Enqueue(ctx, "later", struct{}{}, jobs.RunAt(time.Now().Add(time.Hour))))
+
+	var count int64
+	require.NoError(t, database.Model(&models.Job{}).Where("type = ?", "greet").Count(&count).Error)
+	require.EqualValues(t, 1, count, "unique key deduplicates jobs")
+
+	runner.Start()
+	select {
+	case name := <-greeted:
+		require.Equal(t, "Ada", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("greet job did not run")
+	}
+
+	status := func(jobType string) models.Job {
+		var job models.Job
+		require.NoError(t, database.Where("type = ?", jobType).Take(&job).Error)
+		return job
+	}
+	require.Eventually(t, func() bool {
+		return status("flaky").Status == models.JobDone &&
+			status("broken").Status == models.JobDead &&
+			status("invalid").Status == models.JobDead
+	}, 5*time.Second, 20*time.Millisecond)
+
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, runner.Stop(stopCtx))
+
+	require.Equal(t, 2, status("flaky").Attempts)
+	broken := status("broken")
+	require.Equal(t, 3, broken.Attempts)
+	require.Equal(t, "always fails", broken.LastError)
+	require.Equal(t, 1, status("invalid").Attempts)
+	require.Equal(t, models.JobPending, status("later").Status)
+}
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 0", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := jobs.ParseSchedule(tt.spec)
+		require.NoError(t, err, tt.spec)
+		require.Equal(t, tt.want, schedule.Next(from), tt.spec)
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *"} {
+		_, err := jobs.ParseSchedule(spec)
+		require.Error(t, err, spec)
+	}
+}
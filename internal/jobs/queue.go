@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// DefaultMaxAttempts is used for jobs enqueued without MaxAttempts.
+const DefaultMaxAttempts = 10
+
+// Queue adds jobs to the job store. Enqueueing inside
+// repository.Transactor.WithinTransaction commits the job with the rest of the
+// transaction, so work is never scheduled for changes that rolled back.
+type Queue struct {
+	store repository.JobStore
+}
+
+// NewQueue constructs a Queue.
+func NewQueue(store repository.JobStore) *Queue {
+	return &Queue{store: store}
+}
+
+// Option customizes an enqueued job.
+type Option func(*models.Job)
+
+// RunAt delays a job until t.
+func RunAt(t time.Time) Option {
+	return func(j *models.Job) { j.RunAt = t }
+}
+
+// MaxAttempts sets how many times a job runs before it is dead-lettered.
+func MaxAttempts(n int) Option {
+	return func(j *models.Job) {
+		if n > 0 {
+			j.MaxAttempts = n
+		}
+	}
+}
+
+// UniqueKey skips the job if a job with the same key was ever enqueued.
+func UniqueKey(key string) Option {
+	return func(j *models.Job) { j.UniqueKey = &key }
+}
+
+// Enqueue adds a job of jobType whose payload is the JSON encoding of payload.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	job := &models.Job{
+		Type:        jobType,
+		Payload:     string(encoded),
+		Status:      models.JobPending,
+		RunAt:       time.Now(),
+		MaxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	_, err = q.store.Enqueue(ctx, job)
+	return err
+}
+
+// DeleteContaining removes the jobs whose payload contains text, pending,
+// finished or dead-lettered, such as the mail of a user whose personal data
+// is erased.
+func (q *Queue) DeleteContaining(ctx context.Context, text string) error {
+	return q.store.DeleteContaining(ctx, text)
+}
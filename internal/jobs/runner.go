@@ -0,0 +1,306 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// PruneJob is the built-in job that deletes completed jobs past their retention.
+const PruneJob = "jobs.prune"
+
+// Config configures a Runner.
+type Config struct {
+	// Workers is the number of goroutines running jobs.
+	Workers int
+	// PollInterval is how long an idle worker waits before checking for jobs again.
+	PollInterval time.Duration
+	// LockTimeout is how long a job may run before another worker may claim it,
+	// on the assumption that its worker died.
+	LockTimeout time.Duration
+	// RetryBaseDelay is the delay before the first retry; it doubles per attempt up to an hour.
+	RetryBaseDelay time.Duration
+	// Retention is how long completed jobs are kept before PruneJob deletes them.
+	Retention time.Duration
+}
+
+const maxRetryDelay = time.Hour
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; the job is dead-lettered immediately.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+type handlerFunc func(ctx context.Context, payload []byte) error
+
+type cronEntry struct {
+	spec     string
+	schedule *Schedule
+	jobType  string
+	payload  interface{}
+}
+
+// Runner claims jobs from the store and runs the handler registered for their type.
+type Runner struct {
+	store    repository.JobStore
+	queue    *Queue
+	cfg      Config
+	id       string
+	handlers map[string]handlerFunc
+	cron     []cronEntry
+
+	stop   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRunner constructs a Runner. Register handlers and schedules before calling Start.
+func NewRunner(store repository.JobStore, cfg Config) *Runner {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = 5 * time.Minute
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = 10 * time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+
+	host, _ := os.Hostname()
+	r := &Runner{
+		store:    store,
+		queue:    NewQueue(store),
+		cfg:      cfg,
+		id:       host + ":" + strconv.Itoa(os.Getpid()),
+		handlers: make(map[string]handlerFunc),
+		stop:     make(chan struct{}),
+	}
+	Handle(r, PruneJob, func(ctx context.Context, _ struct{}) error {
+		return store.DeleteCompleted(ctx, time.Now().Add(-r.cfg.Retention))
+	})
+	r.cron = append(r.cron, cronEntry{spec: "@hourly", schedule: mustParseSchedule("@hourly"), jobType: PruneJob, payload: struct{}{}})
+	return r
+}
+
+func mustParseSchedule(spec string) *Schedule {
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Handle registers fn to run jobs of jobType. Payloads are decoded from JSON
+// into T; payloads that fail to decode are dead-lettered without retrying.
+func Handle[T any](r *Runner, jobType string, fn func(ctx context.Context, payload T) error) {
+	r.handlers[jobType] = func(ctx context.Context, raw []byte) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return Permanent(fmt.Errorf("decode payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// Schedule enqueues a job of jobType with payload at every time matching the
+// cron spec, evaluated in UTC. Every instance may run the scheduler; each
+// occurrence is enqueued once because its unique key names the scheduled time.
+func (r *Runner) Schedule(spec, jobType string, payload interface{}) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	r.cron = append(r.cron, cronEntry{spec: spec, schedule: schedule, jobType: jobType, payload: payload})
+	return nil
+}
+
+// Start launches the workers and the scheduler.
+func (r *Runner) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	types := make([]string, 0, len(r.handlers))
+	for jobType := range r.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+
+	for i := 0; i < r.cfg.Workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx, fmt.Sprintf("%s/%d", r.id, i), types)
+	}
+	r.wg.Add(1)
+	go r.schedule()
+}
+
+// Stop stops claiming jobs and waits for running ones to finish. If ctx ends
+// first, running jobs are cancelled; they are retried once their lock times out.
+func (r *Runner) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	close(r.stop)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) work(ctx context.Context, worker string, types []string) {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		job, err := r.store.Claim(ctx, worker, types, time.Now().Add(-r.cfg.LockTimeout))
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("jobs: claim failed: %v", err)
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(r.cfg.PollInterval):
+			}
+			continue
+		}
+		r.run(ctx, job)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job *models.Job) {
+	err := r.call(ctx, job)
+	// Record the outcome even if the runner is being stopped.
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if err := r.store.Complete(ctx, job.ID); err != nil {
+			log.Printf("jobs: failed to complete %s %s: %v", job.Type, job.ID, err)
+		}
+		return
+	}
+
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		log.Printf("jobs: %s %s dead-lettered after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+		if err := r.store.Bury(ctx, job.ID, err.Error()); err != nil {
+			log.Printf("jobs: failed to bury %s %s: %v", job.Type, job.ID, err)
+		}
+		return
+	}
+
+	delay := r.backoff(job.Attempts)
+	log.Printf("jobs: %s %s attempt %d failed: %v; retrying in %s", job.Type, job.ID, job.Attempts, err, delay)
+	if err := r.store.Retry(ctx, job.ID, time.Now().Add(delay), err.Error()); err != nil {
+		log.Printf("jobs: failed to reschedule %s %s: %v", job.Type, job.ID, err)
+	}
+}
+
+// call runs the job's handler, turning a panic into an error.
+func (r *Runner) call(ctx context.Context, job *models.Job) (err error) {
+	handler, ok := r.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %q", job.Type))
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, []byte(job.Payload))
+}
+
+// backoff returns the delay before retrying after attempt, with ±20% jitter so
+// jobs that failed together do not retry in lockstep.
+func (r *Runner) backoff(attempt int) time.Duration {
+	delay := r.cfg.RetryBaseDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5*2+1)) - delay/5
+	return delay + jitter
+}
+
+func (r *Runner) schedule() {
+	defer r.wg.Done()
+
+	next := make([]time.Time, len(r.cron))
+	now := time.Now().UTC()
+	for i, entry := range r.cron {
+		next[i] = entry.schedule.Next(now)
+	}
+
+	for {
+		wait := r.cfg.PollInterval * 60
+		now := time.Now().UTC()
+		for i, entry := range r.cron {
+			if next[i].IsZero() {
+				continue
+			}
+			if !next[i].After(now) {
+				key := fmt.Sprintf("cron:%s:%s:%d", entry.jobType, entry.spec, next[i].Unix())
+				if err := r.queue.Enqueue(context.Background(), entry.jobType, entry.payload, RunAt(next[i]), UniqueKey(key)); err != nil {
+					log.Printf("jobs: failed to schedule %s: %v", entry.jobType, err)
+					continue
+				}
+				next[i] = entry.schedule.Next(now)
+			}
+			if d := next[i].Sub(now); d < wait {
+				wait = d
+			}
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file that mail clients can open.
+type FileMailer struct {
+	dir  string
+	from string
+	seq  uint64
+}
+
+// NewFileMailer constructs a FileMailer writing to dir, creating it if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes msg to a new file in the mail directory.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	body, err := encode(msg, m.from)
+	if err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + strconv.FormatUint(atomic.AddUint64(&m.seq, 1), 10) + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o644)
+}
+
+// WriterMailer prints a readable copy of each message, for local development.
+type WriterMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterMailer constructs a WriterMailer printing to w.
+func NewWriterMailer(w io.Writer) *WriterMailer {
+	return &WriterMailer{w: w}
+}
+
+// Send prints the recipient, subject and text body of msg.
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "---- mail to %s ----\nSubject: %s\n\n%s\n---- end of mail ----\n", msg.To, msg.Subject, msg.Text)
+	return err
+}
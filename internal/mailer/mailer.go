@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+)
+
+// Mail transports selectable with MAIL_TRANSPORT.
+const (
+	TransportSMTP   = "smtp"
+	TransportFile   = "file"
+	TransportStdout = "stdout"
+)
+
+// Message is an outbound email. HTML is optional; Text is always sent.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromConfig returns the transport selected by MAIL_TRANSPORT. Sends are
+// synchronous; wrap the result with NewQueued to send in the background.
+func NewFromConfig(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailTransport {
+	case TransportSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, errors.New("SMTP_HOST is required for the smtp mail transport")
+		}
+		return NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}), nil
+	case TransportFile:
+		return NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	case TransportStdout, "":
+		return NewWriterMailer(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail transport %q", cfg.MailTransport)
+	}
+}
@@ -0,0 +1,48 @@
+package mailer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+)
+
+func TestTemplatesFallBackToBaseLanguage(t *testing.T) {
+	templates, err := mailer.NewTemplates()
+	require.NoError(t, err)
+
+	data := map[string]interface{}{"NewEmail": "new@example.com", "CancelURL": "https://app.example.com/cancel?token=abc&x=1"}
+
+	msg, err := templates.Render("old@example.com", "de-AT", "email_change_notice", data)
+	require.NoError(t, err)
+	require.Equal(t, "Ihre E-Mail-Adresse wird geändert", msg.Subject)
+	require.Contains(t, msg.HTML, `href="https://app.example.com/cancel?token=abc&amp;x=1"`)
+
+	msg, err = templates.Render("old@example.com", "fr", "email_change_notice", data)
+	require.NoError(t, err)
+	require.Equal(t, "Your email address is being changed", msg.Subject)
+
+	_, err = templates.Render("old@example.com", "en", "missing", data)
+	require.Error(t, err)
+}
+
+func TestFileMailerWritesMultipartMessage(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mailer.NewFileMailer(dir, "no-reply@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(context.Background(), mailer.Message{To: "a@example.com", Subject: "Grüße", Text: "plain", HTML: "<p>html</p>"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(raw), "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=")
+	require.Contains(t, string(raw), "multipart/alternative")
+	require.Contains(t, string(raw), "<p>html</p>")
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+)
+
+// SendJob is the job type that delivers a queued Message.
+const SendJob = "mail.send"
+
+// sendTimeout bounds a single delivery attempt.
+const sendTimeout = 30 * time.Second
+
+// QueuedMailer enqueues messages as SendJob jobs, so callers never wait on the
+// transport and messages survive restarts. Sends made inside a transaction are
+// only delivered if it commits.
+type QueuedMailer struct {
+	queue       *jobs.Queue
+	maxAttempts int
+}
+
+// NewQueued returns a Mailer that enqueues messages on queue. Each message is
+// attempted up to maxAttempts times before it is dead-lettered.
+func NewQueued(queue *jobs.Queue, maxAttempts int) *QueuedMailer {
+	return &QueuedMailer{queue: queue, maxAttempts: maxAttempts}
+}
+
+// Send enqueues msg for delivery.
+func (m *QueuedMailer) Send(ctx context.Context, msg Message) error {
+	return m.queue.Enqueue(ctx, SendJob, msg, jobs.MaxAttempts(m.maxAttempts))
+}
+
+// RegisterSendJob makes runner deliver SendJob jobs through transport.
+func RegisterSendJob(runner *jobs.Runner, transport Mailer) {
+	jobs.Handle(runner, SendJob, func(ctx context.Context, msg Message) error {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+		return transport.Send(ctx, msg)
+	})
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when no template exists for the requested locale.
+const DefaultLocale = "en"
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders messages from the embedded templates. Each message is a set
+// of files under templates/<locale>/: <name>.subject.txt, <name>.txt and an
+// optional <name>.html, which is rendered inside templates/layout.html.
+type Templates struct {
+	sets map[string]*templateSet
+}
+
+type templateSet struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// NewTemplates parses every embedded template.
+func NewTemplates() (*Templates, error) {
+	root, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{sets: make(map[string]*templateSet)}
+	subjects, err := fs.Glob(root, "*/*.subject.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, subjectPath := range subjects {
+		key := strings.TrimSuffix(subjectPath, ".subject.txt")
+		set, err := parseSet(root, key)
+		if err != nil {
+			return nil, fmt.Errorf("mail template %s: %w", key, err)
+		}
+		t.sets[key] = set
+	}
+	return t, nil
+}
+
+func parseSet(root fs.FS, key string) (*templateSet, error) {
+	subject, err := texttemplate.ParseFS(root, key+".subject.txt")
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFS(root, key+".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	set := &templateSet{subject: subject, text: text}
+	if _, err := fs.Stat(root, key+".html"); err == nil {
+		if set.html, err = htmltemplate.ParseFS(root, "layout.html", key+".html"); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Render builds the message name addressed to to. The template for locale is
+// used if there is one, then the one for its base language, then DefaultLocale.
+func (t *Templates) Render(to, locale, name string, data interface{}) (Message, error) {
+	set, err := t.lookup(locale, name)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := set.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if set.html != nil {
+		if err := set.html.ExecuteTemplate(&html, "layout", data); err != nil {
+			return Message{}, err
+		}
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (t *Templates) lookup(locale, name string) (*templateSet, error) {
+	var candidates []string
+	if tag, err := language.Parse(locale); err == nil {
+		base, _ := tag.Base()
+		candidates = append(candidates, tag.String(), base.String())
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, candidate := range candidates {
+		if set, ok := t.sets[path.Join(candidate, name)]; ok {
+			return set, nil
+		}
+	}
+	return nil, fmt.Errorf("no mail template named %q", name)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditEvent records a security-relevant or administrative action. Events are
+// append-only: they are never deleted, and only updated to anonymize them when
+// a user's personal data is erased.
+type AuditEvent struct {
+	ID         uuid.UUID              `gorm:"type:uuid;primaryKey" json:"id"`
+	Action     string                 `gorm:"size:64;not null;index" json:"action"`
+	ActorID    *uuid.UUID             `gorm:"type:uuid;index" json:"actor_id"`
+	TargetType string                 `gorm:"size:32;index:idx_audit_events_target" json:"target_type,omitempty"`
+	TargetID   string                 `gorm:"size:64;index:idx_audit_events_target" json:"target_id,omitempty"`
+	IPAddress  string                 `gorm:"size:64" json:"ip_address,omitempty"`
+	UserAgent  string                 `gorm:"size:512" json:"user_agent,omitempty"`
+	RequestID  string                 `gorm:"size:128" json:"request_id,omitempty"`
+	Changes    map[string]AuditChange `gorm:"type:text;serializer:json" json:"changes,omitempty"`
+	Details    map[string]interface{} `gorm:"type:text;serializer:json" json:"details,omitempty"`
+	CreatedAt  time.Time              `gorm:"index" json:"created_at"`
+}
+
+// AuditChange is the value of a field before and after an audited change.
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailChange is a pending change of a user's email address. A user has at
+// most one pending change. Only hashes of the confirm and cancel tokens are stored.
+type EmailChange struct {
+	UserID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OldEmail         string    `gorm:"size:255;not null"`
+	NewEmail         string    `gorm:"size:255;not null"`
+	ConfirmTokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+	CancelTokenHash  string    `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt        time.Time `gorm:"not null;index"`
+	CreatedAt        time.Time
+}
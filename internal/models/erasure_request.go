@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Erasure request statuses.
+const (
+	ErasurePending   = "pending"
+	ErasureCompleted = "completed"
+)
+
+// ErasureRequest records a request to erase a user's personal data and when it
+// was carried out. It holds no personal data itself, so it outlives the
+// erasure as evidence that the request was answered.
+type ErasureRequest struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	RequestedBy uuid.UUID  `gorm:"type:uuid;not null" json:"requested_by"`
+	Status      string     `gorm:"size:16;not null;index" json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (r *ErasureRequest) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
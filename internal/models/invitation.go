@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invitation statuses, as reported by Invitation.Status.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation invites an email address to join an organization with a role.
+// Only a hash of the invitation token is stored.
+type Invitation struct {
+	ID             uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
+	OrganizationID uuid.UUID     `gorm:"type:uuid;not null;index" json:"organization_id"`
+	Organization   *Organization `json:"organization,omitempty"`
+	Email          string        `gorm:"size:255;not null;index" json:"email"`
+	Role           string        `gorm:"size:20;not null" json:"role"`
+	TokenHash      string        `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	InvitedBy      uuid.UUID     `gorm:"type:uuid;not null" json:"invited_by"`
+	ExpiresAt      time.Time     `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time    `json:"accepted_at,omitempty"`
+	AcceptedBy     *uuid.UUID    `gorm:"type:uuid" json:"accepted_by,omitempty"`
+	RevokedAt      *time.Time    `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (i *Invitation) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// Status reports whether the invitation is pending, accepted, revoked or expired.
+func (i Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !time.Now().Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// MarshalJSON adds the invitation's status to its JSON form.
+func (i Invitation) MarshalJSON() ([]byte, error) {
+	type invitation Invitation
+	return json.Marshal(struct {
+		invitation
+		Status string `json:"status"`
+	}{invitation(i), i.Status()})
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Job statuses.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+// Job is a unit of background work. Jobs that exhaust their attempts are kept
+// with status JobDead for inspection rather than deleted.
+type Job struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Type        string     `gorm:"size:100;not null;index" json:"type"`
+	Payload     string     `gorm:"type:text" json:"payload"`
+	Status      string     `gorm:"size:16;not null;index:idx_jobs_status_run_at" json:"status"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_status_run_at" json:"run_at"`
+	Attempts    int        `gorm:"not null" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"max_attempts"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LockedBy    string     `gorm:"size:100" json:"locked_by,omitempty"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	UniqueKey   *string    `gorm:"size:255;uniqueIndex" json:"unique_key,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (j *Job) BeforeCreate(tx *gorm.DB) (err error) {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginCode is a single-use code a browser client exchanges for an access token
+// after a redirect-based OAuth sign-in. Only the hash of the code is stored.
+type LoginCode struct {
+	CodeHash  string    `gorm:"size:64;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Organization roles, from most to least privileged.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant. Users belong to organizations through memberships.
+type Organization struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Slug      string    `gorm:"size:63;not null;uniqueIndex" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (o *Organization) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// Membership grants a user a role in an organization.
+type Membership struct {
+	ID             uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
+	OrganizationID uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex:idx_memberships_organization_user" json:"organization_id"`
+	UserID         uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex:idx_memberships_organization_user;index" json:"user_id"`
+	Role           string        `gorm:"size:20;not null" json:"role"`
+	Organization   *Organization `json:"organization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (m *Membership) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// HasRole reports whether the membership's role is one of roles.
+func (m *Membership) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if m.Role == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session records a signed-in device. Its ID is carried in the access token,
+// so deleting a session revokes the tokens issued for it. Sessions started by
+// an administrator impersonating the user record the administrator.
+type Session struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;index" json:"impersonator_id,omitempty"`
+	UserAgent      string     `gorm:"size:512" json:"user_agent"`
+	IPAddress      string     `gorm:"size:64" json:"ip_address"`
+	ExpiresAt      time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Current        bool       `gorm:"-" json:"current"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (s *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,22 +1,56 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// User roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses. Only active users can sign in and use their tokens.
+// Deactivated accounts are reactivated by signing in again; suspended and
+// pending accounts wait for an administrator. Erased accounts are tombstones
+// whose personal data has been removed.
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusDeactivated = "deactivated"
+	StatusPending     = "pending"
+	StatusErased      = "erased"
+)
+
 // User represents an application user.
 type User struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `gorm:"uniqueIndex" json:"email"`
-	PasswordHash string    `json:"-"`
-	Provider     string    `json:"provider"`
-	ProviderID   string    `json:"provider_id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              uuid.UUID              `gorm:"type:uuid;primaryKey" json:"id"`
+	Name            string                 `json:"name"`
+	Email           string                 `gorm:"size:255;uniqueIndex" json:"email"`
+	PasswordHash    string                 `json:"-"`
+	Provider        string                 `json:"provider"`
+	ProviderID      string                 `json:"provider_id"`
+	Role            string                 `gorm:"size:20;not null;default:user" json:"role"`
+	DisplayName     string                 `gorm:"size:100" json:"display_name"`
+	AvatarURL       string                 `gorm:"size:2048" json:"avatar_url"`
+	Locale          string                 `gorm:"size:35" json:"locale"`
+	Timezone        string                 `gorm:"size:64" json:"timezone"`
+	Metadata        map[string]interface{} `gorm:"type:text;serializer:json" json:"metadata"`
+	Status          string                 `gorm:"size:20;not null;default:active;index" json:"status"`
+	StatusReason    string                 `gorm:"size:500" json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time             `json:"status_changed_at,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// NormalizeEmail returns the form in which email addresses are stored and
+// compared: trimmed and lower-cased.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // BeforeCreate is a GORM hook that sets the UUID before inserting a record.
@@ -24,5 +58,11 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	if u.Status == "" {
+		u.Status = StatusActive
+	}
 	return nil
 }
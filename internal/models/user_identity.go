@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_user_identities_user_provider" json:"user_id"`
+	Provider string    `gorm:"size:64;not null;uniqueIndex:idx_user_identities_provider_subject;uniqueIndex:idx_user_identities_user_provider" json:"provider"`
+	Subject  string    `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject" json:"subject"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+	// Provider tokens are sealed before storage and never serialized.
+	EncryptedAccessToken  string     `json:"-"`
+	EncryptedRefreshToken string     `json:"-"`
+	TokenExpiresAt        *time.Time `json:"token_expires_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID and link time before inserting a record.
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	if i.LinkedAt.IsZero() {
+		i.LinkedAt = time.Now()
+	}
+	return nil
+}
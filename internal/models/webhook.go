@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL that receives the event types it subscribes to.
+// The signing secret is stored encrypted and never returned after creation.
+type WebhookEndpoint struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	URL             string    `gorm:"size:2048;not null" json:"url"`
+	Description     string    `gorm:"size:255" json:"description"`
+	Events          []string  `gorm:"type:text;serializer:json" json:"events"`
+	EncryptedSecret string    `gorm:"type:text;not null" json:"-"`
+	Active          bool      `gorm:"not null" json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (e *WebhookEndpoint) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// Subscribes reports whether the endpoint receives events of eventType.
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, event := range e.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one endpoint, along with the outcome of
+// its latest attempt. Deliveries are written in the same transaction as the
+// change that raised the event, so they act as the outbox for webhooks.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	EndpointID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"endpoint_id"`
+	EventID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"event_id"`
+	EventType      string     `gorm:"size:64;not null" json:"event_type"`
+	Payload        string     `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"size:16;not null" json:"status"`
+	Attempts       int        `gorm:"not null" json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `gorm:"type:text" json:"response_body,omitempty"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate is a GORM hook that sets the UUID before inserting a record.
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
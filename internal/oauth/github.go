@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GitHubProvider signs users in with GitHub, which speaks OAuth 2.0 but not OIDC.
+type GitHubProvider struct {
+	baseProvider
+	apiURL string
+}
+
+// NewGitHubProvider constructs a GitHubProvider.
+func NewGitHubProvider(clientID, clientSecret, redirectURL string) *GitHubProvider {
+	return &GitHubProvider{
+		baseProvider: baseProvider{
+			name: "github",
+			config: &oauth2.Config{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				RedirectURL:  redirectURL,
+				Scopes:       []string{"read:user", "user:email"},
+				Endpoint:     github.Endpoint,
+			},
+		},
+		apiURL: "https://api.github.com",
+	}
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// Complete implements Provider.
+func (p *GitHubProvider) Complete(ctx context.Context, session *Session, state, code string) (*Identity, *oauth2.Token, error) {
+	token, err := p.exchange(ctx, session, state, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := p.Client(ctx, token)
+
+	var user githubUser
+	if err := getJSON(client, p.apiURL+"/user", &user); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch github user: %w", err)
+	}
+
+	// The profile email is optional and unverified; use the primary address instead.
+	var emails []githubEmail
+	if err := getJSON(client, p.apiURL+"/user/emails", &emails); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch github emails: %w", err)
+	}
+
+	identity := &Identity{
+		Provider:  p.name,
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+			break
+		}
+	}
+	if identity.Email == "" {
+		return nil, nil, ErrEmailMissing
+	}
+
+	return identity, token, nil
+}
@@ -0,0 +1,235 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidIDToken is returned when the provider's ID token fails validation.
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// OIDCConfig describes an OpenID Connect provider.
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Endpoint     oauth2.Endpoint
+	UserInfoURL  string
+	// IssuerMatch overrides the exact issuer comparison, for multi-tenant
+	// providers whose tokens carry a tenant-specific issuer.
+	IssuerMatch func(issuer string) bool
+}
+
+// OIDCProvider signs users in through any OpenID Connect compliant provider.
+type OIDCProvider struct {
+	baseProvider
+	issuer      string
+	issuerMatch func(string) bool
+	userInfoURL string
+}
+
+// NewOIDCProvider constructs a provider from a fully specified configuration.
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		baseProvider: baseProvider{
+			name: cfg.Name,
+			config: &oauth2.Config{
+				ClientID:     cfg.ClientID,
+				ClientSecret: cfg.ClientSecret,
+				RedirectURL:  cfg.RedirectURL,
+				Scopes:       scopes,
+				Endpoint:     cfg.Endpoint,
+			},
+		},
+		issuer:      cfg.Issuer,
+		issuerMatch: cfg.IssuerMatch,
+		userInfoURL: cfg.UserInfoURL,
+	}
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// DiscoverOIDCProvider fills the endpoints of cfg from the issuer's
+// /.well-known/openid-configuration document.
+func DiscoverOIDCProvider(ctx context.Context, cfg OIDCConfig) (*OIDCProvider, error) {
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery returned status %s", resp.Status)
+	}
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode oidc discovery document: %w", err)
+	}
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: %s", doc.Issuer)
+	}
+
+	cfg.Endpoint = oauth2.Endpoint{AuthURL: doc.AuthorizationEndpoint, TokenURL: doc.TokenEndpoint}
+	cfg.UserInfoURL = doc.UserInfoEndpoint
+	return NewOIDCProvider(cfg), nil
+}
+
+type idTokenClaims struct {
+	Nonce string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// flexBool decodes booleans that some providers send as strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type userInfoClaims struct {
+	Subject           string   `json:"sub"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Picture           string   `json:"picture"`
+}
+
+// Complete implements Provider.
+func (p *OIDCProvider) Complete(ctx context.Context, session *Session, state, code string) (*Identity, *oauth2.Token, error) {
+	token, err := p.exchange(ctx, session, state, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subject, err := p.verifyIDToken(token, session.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := p.fetchUserInfo(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Subject != subject {
+		return nil, nil, ErrInvalidIDToken
+	}
+	if info.Email == "" {
+		return nil, nil, ErrEmailMissing
+	}
+
+	name := info.Name
+	if name == "" {
+		name = info.PreferredUsername
+	}
+
+	return &Identity{
+		Provider:      p.name,
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: bool(info.EmailVerified),
+		Name:          name,
+		AvatarURL:     info.Picture,
+	}, token, nil
+}
+
+// verifyIDToken checks the claims of the ID token returned with the access token
+// and returns its subject. The token comes straight from the provider's token
+// endpoint over TLS, so per OIDC Core 3.1.3.7 the signature check may be skipped
+// in favour of TLS server validation.
+func (p *OIDCProvider) verifyIDToken(token *oauth2.Token, nonce string) (string, error) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return "", ErrInvalidIDToken
+	}
+
+	// The signature is not verified. That is only safe because raw was read
+	// from the direct TLS token exchange; an ID token from anywhere else, such
+	// as a redirect or a client, must be verified against the provider's keys.
+	var claims idTokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, &claims); err != nil {
+		return "", ErrInvalidIDToken
+	}
+
+	if p.issuerMatch != nil {
+		if !p.issuerMatch(claims.Issuer) {
+			return "", ErrInvalidIDToken
+		}
+	} else if claims.Issuer != p.issuer {
+		return "", ErrInvalidIDToken
+	}
+	if !containsString(claims.Audience, p.config.ClientID) {
+		return "", ErrInvalidIDToken
+	}
+	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time) {
+		return "", ErrInvalidIDToken
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return "", ErrInvalidIDToken
+	}
+	return claims.Subject, nil
+}
+
+func (p *OIDCProvider) fetchUserInfo(ctx context.Context, token *oauth2.Token) (*userInfoClaims, error) {
+	var info userInfoClaims
+	if err := getJSON(p.Client(ctx, token), p.userInfoURL, &info); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s user info: %w", p.name, err)
+	}
+	return &info, nil
+}
+
+// getJSON performs an authorized GET request and decodes the JSON response into v.
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("api returned status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrUnknownProvider is returned when a provider name is not registered.
+var ErrUnknownProvider = errors.New("unknown oauth provider")
+
+// ErrEmailMissing is returned when a provider does not disclose the user's email.
+var ErrEmailMissing = errors.New("provider did not return an email address")
+
+// Identity is the provider-agnostic profile returned after a successful login.
+type Identity struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	AvatarURL     string `json:"avatar_url"`
+}
+
+// Provider is implemented by every external identity provider.
+type Provider interface {
+	// Name is the identifier used in routes and stored with linked accounts.
+	Name() string
+	// AuthCodeURL returns the URL the user is sent to in order to sign in.
+	AuthCodeURL(session *Session) string
+	// Complete validates the callback against session, exchanges the code and
+	// maps the provider profile to an Identity.
+	Complete(ctx context.Context, session *Session, state, code string) (*Identity, *oauth2.Token, error)
+	// Client returns an HTTP client authorized with token.
+	Client(ctx context.Context, token *oauth2.Token) *http.Client
+	// TokenSource returns a source that refreshes token when it expires.
+	TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource
+}
+
+// baseProvider implements the parts of the authorization-code flow shared by all providers.
+type baseProvider struct {
+	name   string
+	config *oauth2.Config
+}
+
+func (p *baseProvider) Name() string { return p.name }
+
+func (p *baseProvider) AuthCodeURL(session *Session) string {
+	return p.config.AuthCodeURL(session.State,
+		oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(session.CodeVerifier),
+		oauth2.SetAuthURLParam("nonce", session.Nonce),
+	)
+}
+
+func (p *baseProvider) Client(ctx context.Context, token *oauth2.Token) *http.Client {
+	return p.config.Client(ctx, token)
+}
+
+func (p *baseProvider) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return p.config.TokenSource(ctx, token)
+}
+
+// exchange validates the session and trades the code for a token using the PKCE verifier.
+func (p *baseProvider) exchange(ctx context.Context, session *Session, state, code string) (*oauth2.Token, error) {
+	if err := session.Validate(p.name, state); err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, errors.New("code query param missing")
+	}
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(session.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	return token, nil
+}
+
+// Registry holds the configured providers keyed by name.
+type Registry struct {
+	providers map[string]Provider
+	order     []string
+}
+
+// NewRegistry constructs an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds a provider, replacing any existing provider with the same name.
+func (r *Registry) Register(p Provider) {
+	if _, exists := r.providers[p.Name()]; !exists {
+		r.order = append(r.order, p.Name())
+	}
+	r.providers[p.Name()] = p
+}
+
+// Get returns the provider registered under name.
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names lists registered providers in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.order))
+	copy(names, r.order)
+	return names
+}
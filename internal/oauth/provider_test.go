@@ -0,0 +1,282 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+)
+
+// fakeIdP is an OpenID Connect provider and GitHub API served by httptest.
+type fakeIdP struct {
+	*httptest.Server
+	idToken  jwt.MapClaims
+	userInfo map[string]interface{}
+	emails   []githubEmail
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	idp := &fakeIdP{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"userinfo_endpoint":      idp.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.idToken).SignedString([]byte("unused"))
+		require.NoError(t, err)
+		writeTestJSON(w, map[string]interface{}{"access_token": "access", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, idp.userInfo)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, githubUser{ID: 42, Login: "octocat", AvatarURL: "https://example.com/octocat.png"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, idp.emails)
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func writeTestJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCProviderComplete(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider, err := DiscoverOIDCProvider(context.Background(), OIDCConfig{Name: "custom", Issuer: idp.URL, ClientID: "client", ClientSecret: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, idp.URL+"/token", provider.config.Endpoint.TokenURL)
+
+	validIDToken := func(session *Session) jwt.MapClaims {
+		return jwt.MapClaims{"iss": idp.URL, "aud": "client", "sub": "user-1", "nonce": session.Nonce, "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	tests := []struct {
+		name     string
+		idToken  func(claims jwt.MapClaims)
+		userInfo map[string]interface{}
+		state    string
+		code     string
+		want     *Identity
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			userInfo: map[string]interface{}{"sub": "user-1", "email": "ada@example.com", "email_verified": true, "name": "Ada"},
+			want:     &Identity{Provider: "custom", Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"},
+		},
+		{
+			name:     "email_verified as a string",
+			userInfo: map[string]interface{}{"sub": "user-1", "email": "ada@example.com", "email_verified": "true", "preferred_username": "ada"},
+			want:     &Identity{Provider: "custom", Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "ada"},
+		},
+		{
+			name:     "email_verified false as a string",
+			userInfo: map[string]interface{}{"sub": "user-1", "email": "ada@example.com", "email_verified": "false"},
+			want:     &Identity{Provider: "custom", Subject: "user-1", Email: "ada@example.com"},
+		},
+		{
+			name:    "wrong nonce",
+			idToken: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong issuer",
+			idToken: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong audience",
+			idToken: func(claims jwt.MapClaims) { claims["aud"] = "other-client" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "expired",
+			idToken: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:     "user info of another subject",
+			userInfo: map[string]interface{}{"sub": "user-2", "email": "eve@example.com"},
+			wantErr:  ErrInvalidIDToken,
+		},
+		{
+			name:     "no email",
+			userInfo: map[string]interface{}{"sub": "user-1"},
+			wantErr:  ErrEmailMissing,
+		},
+		{
+			name:    "wrong state",
+			state:   "forged",
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "rejected code",
+			code: "bad-code",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession("custom")
+			require.NoError(t, err)
+			idp.idToken = validIDToken(session)
+			if tt.idToken != nil {
+				tt.idToken(idp.idToken)
+			}
+			idp.userInfo = tt.userInfo
+			if idp.userInfo == nil {
+				idp.userInfo = map[string]interface{}{"sub": "user-1", "email": "ada@example.com"}
+			}
+			state, code := session.State, "good-code"
+			if tt.state != "" {
+				state = tt.state
+			}
+			if tt.code != "" {
+				code = tt.code
+			}
+
+			identity, token, err := provider.Complete(context.Background(), session, state, code)
+			if tt.want == nil {
+				require.Error(t, err)
+				if tt.wantErr != nil {
+					require.ErrorIs(t, err, tt.wantErr)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, identity)
+			require.Equal(t, "access", token.AccessToken)
+		})
+	}
+}
+
+func TestOIDCIssuerMatch(t *testing.T) {
+	google := NewGoogleProvider("client", "secret", "")
+	require.True(t, google.issuerMatch("accounts.google.com"))
+	require.False(t, google.issuerMatch("https://accounts.google.com.evil.example"))
+
+	common := NewMicrosoftProvider("common", "client", "secret", "")
+	require.True(t, common.issuerMatch("https://login.microsoftonline.com/9188040d/v2.0"))
+	require.False(t, common.issuerMatch("https://login.example.com/9188040d/v2.0"))
+
+	tenant := NewMicrosoftProvider("contoso", "client", "secret", "")
+	require.True(t, tenant.issuerMatch("https://login.microsoftonline.com/contoso/v2.0"))
+	require.False(t, tenant.issuerMatch("https://login.microsoftonline.com/fabrikam/v2.0"))
+}
+
+func TestGitHubProviderComplete(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := NewGitHubProvider("client", "secret", "")
+	provider.config.Endpoint = oauth2.Endpoint{AuthURL: idp.URL + "/authorize", TokenURL: idp.URL + "/token"}
+	provider.apiURL = idp.URL
+
+	tests := []struct {
+		name    string
+		emails  []githubEmail
+		want    *Identity
+		wantErr error
+	}{
+		{
+			name: "verified primary",
+			emails: []githubEmail{
+				{Email: "old@example.com", Verified: true},
+				{Email: "octo@example.com", Primary: true, Verified: true},
+			},
+			want: &Identity{Provider: "github", Subject: "42", Email: "octo@example.com", EmailVerified: true, Name: "octocat", AvatarURL: "https://example.com/octocat.png"},
+		},
+		{
+			name:   "unverified primary",
+			emails: []githubEmail{{Email: "octo@example.com", Primary: true}, {Email: "other@example.com", Verified: true}},
+			want:   &Identity{Provider: "github", Subject: "42", Email: "octo@example.com", Name: "octocat", AvatarURL: "https://example.com/octocat.png"},
+		},
+		{
+			name:    "no primary",
+			emails:  []githubEmail{{Email: "octo@example.com", Verified: true}},
+			wantErr: ErrEmailMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession("github")
+			require.NoError(t, err)
+			idp.idToken = jwt.MapClaims{}
+			idp.emails = tt.emails
+
+			identity, _, err := provider.Complete(context.Background(), session, session.State, "good-code")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, identity)
+		})
+	}
+}
+
+func TestNewRegistryFromConfig(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "nothing configured",
+			want: []string{},
+		},
+		{
+			name: "providers with credentials",
+			cfg: config.Config{
+				GoogleClientID: "google", GoogleClientSecret: "secret",
+				GitHubClientID: "github",
+				GitLabClientID: "gitlab", GitLabClientSecret: "secret", GitLabBaseURL: "https://gitlab.example.com/",
+				OIDCProviderName: "custom", OIDCIssuerURL: idp.URL, OIDCClientID: "client",
+			},
+			want: []string{"google", "gitlab", "custom"},
+		},
+		{
+			name:    "discovery issuer mismatch",
+			cfg:     config.Config{OIDCProviderName: "custom", OIDCIssuerURL: idp.URL + "/", OIDCClientID: "client"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := NewRegistryFromConfig(context.Background(), &tt.cfg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, registry.Names())
+		})
+	}
+
+	_, err := NewRegistry().Get("google")
+	require.ErrorIs(t, err, ErrUnknownProvider)
+}
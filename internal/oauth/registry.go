@@ -0,0 +1,107 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/microsoft"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+)
+
+// NewGoogleProvider constructs the Google OIDC provider.
+func NewGoogleProvider(clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "google",
+		Issuer:       "https://accounts.google.com",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     google.Endpoint,
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		IssuerMatch: func(issuer string) bool {
+			return issuer == "https://accounts.google.com" || issuer == "accounts.google.com"
+		},
+	})
+}
+
+// NewMicrosoftProvider constructs the Microsoft identity platform provider for tenant.
+// Tenants such as "common" issue tokens whose issuer names the user's home tenant,
+// so only the issuer host is checked for those.
+func NewMicrosoftProvider(tenant, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	issuerPrefix := "https://login.microsoftonline.com/"
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "microsoft",
+		Issuer:       issuerPrefix + tenant + "/v2.0",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     microsoft.AzureADEndpoint(tenant),
+		UserInfoURL:  "https://graph.microsoft.com/oidc/userinfo",
+		IssuerMatch: func(issuer string) bool {
+			switch tenant {
+			case "common", "organizations", "consumers":
+				return strings.HasPrefix(issuer, issuerPrefix) && strings.HasSuffix(issuer, "/v2.0")
+			default:
+				return issuer == issuerPrefix+tenant+"/v2.0"
+			}
+		},
+	})
+}
+
+// NewGitLabProvider constructs a provider for gitlab.com or a self-managed instance at baseURL.
+func NewGitLabProvider(baseURL, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "gitlab",
+		Issuer:       baseURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  baseURL + "/oauth/authorize",
+			TokenURL: baseURL + "/oauth/token",
+		},
+		UserInfoURL: baseURL + "/oauth/userinfo",
+	})
+}
+
+// NewRegistryFromConfig registers every provider that has client credentials configured.
+func NewRegistryFromConfig(ctx context.Context, cfg *config.Config) (*Registry, error) {
+	registry := NewRegistry()
+
+	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
+		registry.Register(NewGoogleProvider(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL))
+	}
+	if cfg.GitHubClientID != "" && cfg.GitHubClientSecret != "" {
+		registry.Register(NewGitHubProvider(cfg.GitHubClientID, cfg.GitHubClientSecret, cfg.GitHubRedirectURL))
+	}
+	if cfg.MicrosoftClientID != "" && cfg.MicrosoftClientSecret != "" {
+		registry.Register(NewMicrosoftProvider(cfg.MicrosoftTenant, cfg.MicrosoftClientID, cfg.MicrosoftClientSecret, cfg.MicrosoftRedirectURL))
+	}
+	if cfg.GitLabClientID != "" && cfg.GitLabClientSecret != "" {
+		registry.Register(NewGitLabProvider(cfg.GitLabBaseURL, cfg.GitLabClientID, cfg.GitLabClientSecret, cfg.GitLabRedirectURL))
+	}
+	if cfg.OIDCIssuerURL != "" && cfg.OIDCClientID != "" {
+		discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		provider, err := DiscoverOIDCProvider(discoverCtx, OIDCConfig{
+			Name:         cfg.OIDCProviderName,
+			Issuer:       cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure %s provider: %w", cfg.OIDCProviderName, err)
+		}
+		registry.Register(provider)
+	}
+
+	return registry, nil
+}
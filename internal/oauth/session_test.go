@@ -0,0 +1,64 @@
+package oauth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+)
+
+func TestSessionCodec(t *testing.T) {
+	codec, err := oauth.NewSessionCodec("secret")
+	require.NoError(t, err)
+
+	session, err := oauth.NewSession("google")
+	require.NoError(t, err)
+	require.NotEmpty(t, session.State)
+	require.NotEmpty(t, session.CodeVerifier)
+	require.NotEmpty(t, session.Nonce)
+	session.RedirectURI = "https://app.example.com/callback"
+
+	value, err := codec.Encode(session)
+	require.NoError(t, err)
+	require.NotContains(t, value, session.State)
+
+	decoded, err := codec.Decode(value)
+	require.NoError(t, err)
+	require.Equal(t, session.State, decoded.State)
+	require.Equal(t, session.CodeVerifier, decoded.CodeVerifier)
+	require.Equal(t, session.RedirectURI, decoded.RedirectURI)
+	require.NoError(t, decoded.Validate("google", session.State))
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := []byte(value)
+		tampered[len(tampered)/2] ^= 1
+		_, err := codec.Decode(string(tampered))
+		require.ErrorIs(t, err, oauth.ErrInvalidState)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := oauth.NewSessionCodec("other secret")
+		require.NoError(t, err)
+		_, err = other.Decode(value)
+		require.ErrorIs(t, err, oauth.ErrInvalidState)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		require.ErrorIs(t, decoded.Validate("google", ""), oauth.ErrInvalidState)
+		require.ErrorIs(t, decoded.Validate("google", "other state"), oauth.ErrInvalidState)
+		require.ErrorIs(t, decoded.Validate("github", session.State), oauth.ErrInvalidState)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := *decoded
+		expired.ExpiresAt = time.Now().Add(-time.Second)
+		value, err := codec.Encode(&expired)
+		require.NoError(t, err)
+		decoded, err := codec.Decode(value)
+		require.NoError(t, err)
+		require.ErrorIs(t, decoded.Validate("google", session.State), oauth.ErrInvalidState)
+		require.WithinDuration(t, time.Now().Add(oauth.SessionTTL), session.ExpiresAt, time.Second)
+	})
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// AuditRepository stores audit events. Events are only modified to anonymize
+// them when a user's personal data is erased.
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository creates a new repository instance.
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Create appends an event.
+func (r *AuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	return conn(ctx, r.db).Create(event).Error
+}
+
+// List returns the events matching filter, newest first, along with the total
+// number of matches ignoring Limit and Offset.
+func (r *AuditRepository) List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, int64, error) {
+	query := conn(ctx, r.db).Model(&models.AuditEvent{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("created_at desc, id desc").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// ListBySubject returns the events the user performed or was the target of,
+// oldest first. userType is the target type of users.
+func (r *AuditRepository) ListBySubject(ctx context.Context, userType string, userID uuid.UUID) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := conn(ctx, r.db).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userID, userType, userID.String()).
+		Order("created_at, id").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// AnonymizeSubject removes the user's personal data from the events about
+// them. The client details of events they performed are cleared, as are the
+// changes and details of events targeting them. Actions, IDs and times are
+// kept. userType is the target type of users.
+func (r *AuditRepository) AnonymizeSubject(ctx context.Context, userType string, userID uuid.UUID) error {
+	db := conn(ctx, r.db)
+	err := db.Model(&models.AuditEvent{}).
+		Where("actor_id = ? OR (actor_id IS NULL AND target_type = ? AND target_id = ?)", userID, userType, userID.String()).
+		Updates(map[string]interface{}{"ip_address": "", "user_agent": ""}).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.AuditEvent{}).
+		Where("target_type = ? AND target_id = ?", userType, userID.String()).
+		Updates(map[string]interface{}{"changes": gorm.Expr("NULL"), "details": gorm.Expr("NULL")}).Error
+}
+
+// AnonymizeContaining clears the details, changes and client details of the
+// events whose details contain text, ignoring case. It reaches personal data
+// recorded on events that are not about a user, such as the address of a
+// failed sign-in.
+func (r *AuditRepository) AnonymizeContaining(ctx context.Context, text string) error {
+	return conn(ctx, r.db).Model(&models.AuditEvent{}).
+		Where("lower(details) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(text))+"%").
+		Updates(map[string]interface{}{"changes": gorm.Expr("NULL"), "details": gorm.Expr("NULL"), "ip_address": "", "user_agent": ""}).Error
+}
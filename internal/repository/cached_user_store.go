@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/pkg/cache"
+)
+
+// CachedUserStore decorates a UserStore with a read-through cache for lookups
+// by ID and email. Concurrent misses for the same key share one load, and
+// writes invalidate the affected keys once they commit. Loads that were in
+// flight during an invalidation are not cached. Reads inside a transaction
+// bypass the cache so they observe the transaction's own changes, and reads
+// scoped to a tenant bypass it so the scope is enforced.
+type CachedUserStore struct {
+	next   UserStore
+	cache  cache.Cache
+	ttl    time.Duration
+	group  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	// generation counts invalidations; a load only stores its result if none
+	// happened while it ran. mu orders those stores against invalidations.
+	mu         sync.Mutex
+	generation uint64
+}
+
+// NewCachedUserStore wraps next with c, caching entries for ttl.
+func NewCachedUserStore(next UserStore, c cache.Cache, ttl time.Duration) *CachedUserStore {
+	return &CachedUserStore{next: next, cache: c, ttl: ttl}
+}
+
+func userIDKey(id uuid.UUID) string { return "user:id:" + id.String() }
+
+func userEmailKey(email string) string { return "user:email:" + models.NormalizeEmail(email) }
+
+// Create implements UserStore.
+func (s *CachedUserStore) Create(ctx context.Context, user *models.User) error {
+	return s.next.Create(ctx, user)
+}
+
+// GetByID implements UserStore.
+func (s *CachedUserStore) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if _, scoped := TenantFromContext(ctx); scoped || inTransaction(ctx) {
+		return s.next.GetByID(ctx, id)
+	}
+	return s.load(ctx, userIDKey(id), func(ctx context.Context) (*models.User, error) {
+		return s.next.GetByID(ctx, id)
+	})
+}
+
+// GetByEmail implements UserStore.
+func (s *CachedUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if _, scoped := TenantFromContext(ctx); scoped || inTransaction(ctx) {
+		return s.next.GetByEmail(ctx, email)
+	}
+	return s.load(ctx, userEmailKey(email), func(ctx context.Context) (*models.User, error) {
+		return s.next.GetByEmail(ctx, email)
+	})
+}
+
+// GetByIDForUpdate implements UserStore. Locked reads always go to the store.
+func (s *CachedUserStore) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return s.next.GetByIDForUpdate(ctx, id)
+}
+
+// List implements UserStore. Listings are not cached.
+func (s *CachedUserStore) List(ctx context.Context) ([]models.User, error) {
+	return s.next.List(ctx)
+}
+
+// Each implements UserStore. Iterations are not cached.
+func (s *CachedUserStore) Each(ctx context.Context, fn func(*models.User) error) error {
+	return s.next.Each(ctx, fn)
+}
+
+// Update implements UserStore.
+func (s *CachedUserStore) Update(ctx context.Context, user *models.User) error {
+	keys := []string{userIDKey(user.ID), userEmailKey(user.Email)}
+	if previous, err := s.next.GetByID(ctx, user.ID); err == nil && previous.Email != user.Email {
+		keys = append(keys, userEmailKey(previous.Email))
+	}
+
+	if err := s.next.Update(ctx, user); err != nil {
+		return err
+	}
+	AfterCommit(ctx, func(ctx context.Context) { s.invalidate(ctx, keys...) })
+	return nil
+}
+
+// Delete implements UserStore.
+func (s *CachedUserStore) Delete(ctx context.Context, id uuid.UUID) error {
+	keys := []string{userIDKey(id)}
+	if previous, err := s.next.GetByID(ctx, id); err == nil {
+		keys = append(keys, userEmailKey(previous.Email))
+	}
+
+	if err := s.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	AfterCommit(ctx, func(ctx context.Context) { s.invalidate(ctx, keys...) })
+	return nil
+}
+
+// invalidate removes keys from the cache and stops loads already in flight
+// from storing what they read before the change.
+func (s *CachedUserStore) invalidate(ctx context.Context, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	for _, key := range keys {
+		s.group.Forget(key)
+	}
+	if err := s.cache.Delete(ctx, keys...); err != nil {
+		log.Printf("user cache: invalidating %v: %v", keys, err)
+	}
+}
+
+// Stats implements cache.StatsProvider.
+func (s *CachedUserStore) Stats() cache.Stats {
+	stats := cache.Stats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+	if provider, ok := s.cache.(cache.StatsProvider); ok {
+		backend := provider.Stats()
+		stats.Evictions = backend.Evictions
+		stats.Size = backend.Size
+	}
+	return stats
+}
+
+func (s *CachedUserStore) load(ctx context.Context, key string, fetch func(context.Context) (*models.User, error)) (*models.User, error) {
+	if raw, ok, err := s.cache.Get(ctx, key); err == nil && ok {
+		if user, err := decodeUser(raw); err == nil {
+			s.hits.Add(1)
+			return user, nil
+		}
+	}
+	s.misses.Add(1)
+
+	// The shared load must not be cancelled by whichever caller happened to start it.
+	value, err, _ := s.group.Do(key, func() (interface{}, error) {
+		s.mu.Lock()
+		generation := s.generation
+		s.mu.Unlock()
+
+		user, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if raw, err := encodeUser(user); err == nil {
+			s.mu.Lock()
+			if s.generation == generation {
+				_ = s.cache.Set(ctx, key, raw, s.ttl)
+			}
+			s.mu.Unlock()
+		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hand each caller its own copy so callers can mutate the result.
+	user := *value.(*models.User)
+	return &user, nil
+}
+
+func init() {
+	// Nested profile metadata decodes into these types.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// Users are gob-encoded rather than JSON-encoded because the JSON form omits
+// fields such as the password hash.
+func encodeUser(user *models.User) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(user); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeUser(raw []byte) (*models.User, error) {
+	var user models.User
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+var (
+	_ UserStore           = (*CachedUserStore)(nil)
+	_ cache.StatsProvider = (*CachedUserStore)(nil)
+)
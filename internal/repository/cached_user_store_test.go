@@ -0,0 +1,150 @@
+package repository_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/repository/memorystore"
+	"github.com/example/golang-rest-boilerplate/pkg/cache"
+)
+
+// pausingUserStore counts lookups by ID and can hold one of them after it has
+// read the user, to simulate a slow load.
+type pausingUserStore struct {
+	*memorystore.UserStore
+	loads  atomic.Int32
+	mu     sync.Mutex
+	loaded chan struct{}
+	resume chan struct{}
+}
+
+// pauseNextLoad makes the next GetByID signal loaded and wait for resume.
+func (s *pausingUserStore) pauseNextLoad() (loaded, resume chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded, s.resume = make(chan struct{}), make(chan struct{})
+	return s.loaded, s.resume
+}
+
+func (s *pausingUserStore) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, err := s.UserStore.GetByID(ctx, id)
+	s.loads.Add(1)
+
+	s.mu.Lock()
+	loaded, resume := s.loaded, s.resume
+	s.loaded, s.resume = nil, nil
+	s.mu.Unlock()
+	if resume != nil {
+		close(loaded)
+		<-resume
+	}
+	return user, err
+}
+
+func newCachedUsers(t *testing.T) (*pausingUserStore, *repository.CachedUserStore, *models.User) {
+	t.Helper()
+	store := &pausingUserStore{UserStore: memorystore.NewUserStore()}
+	user := &models.User{Name: "Ada", Email: "ada@example.com"}
+	require.NoError(t, store.Create(context.Background(), user))
+	return store, repository.NewCachedUserStore(store, cache.NewLRU(10), time.Minute), user
+}
+
+func TestCachedUserStoreSharesConcurrentLoads(t *testing.T) {
+	store, cached, user := newCachedUsers(t)
+	ctx := context.Background()
+
+	loaded, resume := store.pauseNextLoad()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cached.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			require.Equal(t, "Ada", got.Name)
+		}()
+	}
+	<-loaded
+	// Give the other callers time to pile up behind the load.
+	time.Sleep(20 * time.Millisecond)
+	close(resume)
+	wg.Wait()
+
+	require.Equal(t, int32(1), store.loads.Load())
+	stats := cached.Stats()
+	require.Equal(t, uint64(10), stats.Hits+stats.Misses)
+}
+
+func TestCachedUserStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+	tx := repository.NewMemoryTransactor()
+
+	t.Run("writes invalidate once they commit", func(t *testing.T) {
+		_, cached, user := newCachedUsers(t)
+		_, err := cached.GetByEmail(ctx, "ada@example.com")
+		require.NoError(t, err)
+		// Lookups in another case share the entry that writes invalidate.
+		_, err = cached.GetByEmail(ctx, "ADA@example.com")
+		require.NoError(t, err)
+		_, err = cached.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+
+		err = tx.WithinTransaction(ctx, func(ctx context.Context) error {
+			changed := *user
+			changed.Name, changed.Email = "Ada L", "ada.l@example.com"
+			require.NoError(t, cached.Update(ctx, &changed))
+
+			// Until the commit, other readers keep seeing the committed row.
+			got, err := cached.GetByID(context.Background(), user.ID)
+			require.NoError(t, err)
+			require.Equal(t, "Ada", got.Name)
+			return nil
+		})
+		require.NoError(t, err)
+
+		got, err := cached.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Ada L", got.Name)
+		_, err = cached.GetByEmail(ctx, "ada@example.com")
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		_, err = cached.GetByEmail(ctx, "ADA@example.com")
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		require.NoError(t, cached.Delete(ctx, user.ID))
+		_, err = cached.GetByID(ctx, user.ID)
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		require.Equal(t, 0, cached.Stats().Size)
+	})
+
+	t.Run("a load in flight during a write is not cached", func(t *testing.T) {
+		store, cached, user := newCachedUsers(t)
+
+		loaded, resume := store.pauseNextLoad()
+		stale := make(chan *models.User)
+		go func() {
+			got, err := cached.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			stale <- got
+		}()
+		<-loaded
+
+		changed := *user
+		changed.Name = "Ada L"
+		require.NoError(t, cached.Update(ctx, &changed))
+		close(resume)
+		require.Equal(t, "Ada", (<-stale).Name)
+
+		got, err := cached.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Ada L", got.Name)
+	})
+}
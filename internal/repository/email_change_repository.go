@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// EmailChangeRepository defines database operations for pending email changes.
+type EmailChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewEmailChangeRepository creates a new repository instance.
+func NewEmailChangeRepository(db *gorm.DB) *EmailChangeRepository {
+	return &EmailChangeRepository{db: db}
+}
+
+// Replace stores change, discarding any change the user already has pending.
+func (r *EmailChangeRepository) Replace(ctx context.Context, change *models.EmailChange) error {
+	db := conn(ctx, r.db)
+	if err := db.Where("user_id = ?", change.UserID).Delete(&models.EmailChange{}).Error; err != nil {
+		return err
+	}
+	return db.Create(change).Error
+}
+
+// GetByConfirmHash returns the unexpired change with the given confirm token hash.
+func (r *EmailChangeRepository) GetByConfirmHash(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return r.getActive(ctx, "confirm_token_hash = ?", hash)
+}
+
+// GetByCancelHash returns the unexpired change with the given cancel token hash.
+func (r *EmailChangeRepository) GetByCancelHash(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return r.getActive(ctx, "cancel_token_hash = ?", hash)
+}
+
+// GetByUser returns the user's unexpired change.
+func (r *EmailChangeRepository) GetByUser(ctx context.Context, userID uuid.UUID) (*models.EmailChange, error) {
+	return r.getActive(ctx, "user_id = ?", userID)
+}
+
+func (r *EmailChangeRepository) getActive(ctx context.Context, query string, arg interface{}) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := conn(ctx, r.db).Where(query, arg).Where("expires_at > ?", time.Now()).First(&change).Error; err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// Delete removes the user's pending change.
+func (r *EmailChangeRepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	return conn(ctx, r.db).Where("user_id = ?", userID).Delete(&models.EmailChange{}).Error
+}
+
+// DeleteExpired removes changes that can no longer be confirmed.
+func (r *EmailChangeRepository) DeleteExpired(ctx context.Context) error {
+	return conn(ctx, r.db).Where("expires_at <= ?", time.Now()).Delete(&models.EmailChange{}).Error
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// ErasureRepository stores erasure requests.
+type ErasureRepository struct {
+	db *gorm.DB
+}
+
+// NewErasureRepository creates a new repository instance.
+func NewErasureRepository(db *gorm.DB) *ErasureRepository {
+	return &ErasureRepository{db: db}
+}
+
+// Create inserts a new erasure request.
+func (r *ErasureRepository) Create(ctx context.Context, request *models.ErasureRequest) error {
+	return conn(ctx, r.db).Create(request).Error
+}
+
+// Get finds an erasure request by ID.
+func (r *ErasureRepository) Get(ctx context.Context, id uuid.UUID) (*models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	if err := conn(ctx, r.db).First(&request, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetPendingByUser finds the user's erasure request that has not been carried out yet.
+func (r *ErasureRepository) GetPendingByUser(ctx context.Context, userID uuid.UUID) (*models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	if err := conn(ctx, r.db).First(&request, "user_id = ? AND status = ?", userID, models.ErasurePending).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// List returns erasure requests, newest first, and their total number.
+func (r *ErasureRepository) List(ctx context.Context, limit, offset int) ([]models.ErasureRequest, int64, error) {
+	query := conn(ctx, r.db).Model(&models.ErasureRequest{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("created_at desc, id desc").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var requests []models.ErasureRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
+
+// Update saves an erasure request.
+func (r *ErasureRepository) Update(ctx context.Context, request *models.ErasureRequest) error {
+	return conn(ctx, r.db).Save(request).Error
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// IdentityRepository defines database operations for linked identities.
+type IdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewIdentityRepository creates a new repository instance.
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// Create inserts a new identity.
+func (r *IdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	return conn(ctx, r.db).Create(identity).Error
+}
+
+// GetByProviderSubject finds the identity for a provider account.
+func (r *IdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := conn(ctx, r.db).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetByUserProvider finds the identity a user has linked for provider.
+func (r *IdentityRepository) GetByUserProvider(ctx context.Context, userID uuid.UUID, provider string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := conn(ctx, r.db).Where("user_id = ? AND provider = ?", userID, provider).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListByUser returns all identities linked to a user.
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).Order("linked_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Update updates identity fields.
+func (r *IdentityRepository) Update(ctx context.Context, identity *models.UserIdentity) error {
+	return conn(ctx, r.db).Save(identity).Error
+}
+
+// DeleteByUserProvider removes the identity a user has linked for provider.
+func (r *IdentityRepository) DeleteByUserProvider(ctx context.Context, userID uuid.UUID, provider string) error {
+	result := conn(ctx, r.db).Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteByUser removes every identity linked to a user.
+func (r *IdentityRepository) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	return conn(ctx, r.db).Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
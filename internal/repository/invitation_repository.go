@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// InvitationRepository stores organization invitations.
+type InvitationRepository struct {
+	db *gorm.DB
+}
+
+// NewInvitationRepository creates a new repository instance.
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+// Create inserts a new invitation.
+func (r *InvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	return conn(ctx, r.db).Create(invitation).Error
+}
+
+// GetByID finds one of an organization's invitations.
+func (r *InvitationRepository) GetByID(ctx context.Context, orgID, id uuid.UUID) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := conn(ctx, r.db).First(&invitation, "id = ? AND organization_id = ?", id, orgID).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetByTokenHash finds an invitation by the hash of its token, with the organization loaded.
+func (r *InvitationRepository) GetByTokenHash(ctx context.Context, hash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := conn(ctx, r.db).Preload("Organization").First(&invitation, "token_hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetPending finds the organization's pending invitation for email.
+func (r *InvitationRepository) GetPending(ctx context.Context, orgID uuid.UUID, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := conn(ctx, r.db).
+		Where("organization_id = ? AND email = ?", orgID, email).
+		Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now()).
+		First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// List returns an organization's invitations, newest first.
+func (r *InvitationRepository) List(ctx context.Context, orgID uuid.UUID) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	if err := conn(ctx, r.db).Where("organization_id = ?", orgID).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// Update saves changes to an invitation.
+func (r *InvitationRepository) Update(ctx context.Context, invitation *models.Invitation) error {
+	return conn(ctx, r.db).Omit("Organization").Save(invitation).Error
+}
+
+// AnonymizeEmail replaces email with replacement on the invitations sent to
+// it, revoking those that are still open.
+func (r *InvitationRepository) AnonymizeEmail(ctx context.Context, email, replacement string) error {
+	db := conn(ctx, r.db)
+	err := db.Model(&models.Invitation{}).
+		Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL", email).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.Invitation{}).Where("email = ?", email).Update("email", replacement).Error
+}
+
+// MarkAccepted records that userID accepted the invitation. It returns
+// gorm.ErrRecordNotFound if the invitation was accepted or revoked meanwhile,
+// so concurrent acceptances cannot both succeed.
+func (r *InvitationRepository) MarkAccepted(ctx context.Context, id, userID uuid.UUID) error {
+	result := conn(ctx, r.db).Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"accepted_at": time.Now(), "accepted_by": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
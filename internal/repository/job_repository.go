@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// JobRepository stores background jobs in the application database.
+type JobRepository struct {
+	db *gorm.DB
+}
+
+// NewJobRepository creates a new repository instance.
+func NewJobRepository(db *gorm.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Enqueue inserts job. It reports false without error when a job with the same
+// UniqueKey already exists.
+func (r *JobRepository) Enqueue(ctx context.Context, job *models.Job) (bool, error) {
+	result := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Claim locks the next due job of one of types for worker. Running jobs locked
+// before staleBefore are assumed abandoned and claimed again. Rows locked by
+// other workers are skipped, so concurrent workers never claim the same job.
+func (r *JobRepository) Claim(ctx context.Context, worker string, types []string, staleBefore time.Time) (*models.Job, error) {
+	var job models.Job
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type IN ?", types).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?)", models.JobPending, now, models.JobRunning, staleBefore).
+			Order("run_at").
+			Limit(1).
+			Take(&job).Error; err != nil {
+			return err
+		}
+
+		job.Status = models.JobRunning
+		job.LockedAt = &now
+		job.LockedBy = worker
+		job.Attempts++
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":    job.Status,
+			"locked_at": job.LockedAt,
+			"locked_by": job.LockedBy,
+			"attempts":  job.Attempts,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Complete marks a job as done.
+func (r *JobRepository) Complete(ctx context.Context, id uuid.UUID) error {
+	return conn(ctx, r.db).Model(&models.Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       models.JobDone,
+		"completed_at": time.Now(),
+		"locked_at":    nil,
+		"locked_by":    "",
+	}).Error
+}
+
+// Retry returns a failed job to the queue to run again at runAt.
+func (r *JobRepository) Retry(ctx context.Context, id uuid.UUID, runAt time.Time, lastError string) error {
+	return conn(ctx, r.db).Model(&models.Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.JobPending,
+		"run_at":     runAt,
+		"last_error": lastError,
+		"locked_at":  nil,
+		"locked_by":  "",
+	}).Error
+}
+
+// Bury moves a job to the dead-letter state.
+func (r *JobRepository) Bury(ctx context.Context, id uuid.UUID, lastError string) error {
+	return conn(ctx, r.db).Model(&models.Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.JobDead,
+		"last_error": lastError,
+		"locked_at":  nil,
+		"locked_by":  "",
+	}).Error
+}
+
+// DeleteCompleted removes jobs that finished before before.
+func (r *JobRepository) DeleteCompleted(ctx context.Context, before time.Time) error {
+	return conn(ctx, r.db).Where("status = ? AND completed_at < ?", models.JobDone, before).Delete(&models.Job{}).Error
+}
+
+// DeleteContaining removes the jobs whose payload contains text, whatever
+// their status, dead-lettered jobs included.
+func (r *JobRepository) DeleteContaining(ctx context.Context, text string) error {
+	return conn(ctx, r.db).Where("payload LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(text)+"%").Delete(&models.Job{}).Error
+}
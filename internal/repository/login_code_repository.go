@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// LoginCodeRepository defines database operations for one-time login codes.
+type LoginCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginCodeRepository creates a new repository instance.
+func NewLoginCodeRepository(db *gorm.DB) *LoginCodeRepository {
+	return &LoginCodeRepository{db: db}
+}
+
+// Create inserts a new login code.
+func (r *LoginCodeRepository) Create(ctx context.Context, code *models.LoginCode) error {
+	return conn(ctx, r.db).Create(code).Error
+}
+
+// Consume deletes an unexpired code and returns it. Deleting before returning
+// guarantees a code can be redeemed at most once, even under concurrent requests.
+func (r *LoginCodeRepository) Consume(ctx context.Context, codeHash string) (*models.LoginCode, error) {
+	var code models.LoginCode
+	if err := conn(ctx, r.db).Where("code_hash = ? AND expires_at > ?", codeHash, time.Now()).First(&code).Error; err != nil {
+		return nil, err
+	}
+
+	result := conn(ctx, r.db).Where("code_hash = ?", codeHash).Delete(&models.LoginCode{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &code, nil
+}
+
+// DeleteByUser removes every code issued to a user.
+func (r *LoginCodeRepository) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	return conn(ctx, r.db).Where("user_id = ?", userID).Delete(&models.LoginCode{}).Error
+}
+
+// DeleteExpired removes codes that can no longer be redeemed.
+func (r *LoginCodeRepository) DeleteExpired(ctx context.Context) error {
+	return conn(ctx, r.db).Where("expires_at <= ?", time.Now()).Delete(&models.LoginCode{}).Error
+}
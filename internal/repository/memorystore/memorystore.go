@@ -0,0 +1,1437 @@
+package memorystore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// UserStore is an in-memory repository.UserStore.
+// Queries with a tenant context only see members according to the
+// organization store set with ScopeTo, and see no users without one.
+type UserStore struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]models.User
+	orgs  *OrganizationStore
+}
+
+// NewUserStore creates an empty UserStore.
+func NewUserStore() *UserStore {
+	return &UserStore{users: make(map[uuid.UUID]models.User)}
+}
+
+// ScopeTo makes tenant-scoped queries consult the memberships in orgs.
+func (s *UserStore) ScopeTo(orgs *OrganizationStore) *UserStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs = orgs
+	return s
+}
+
+// visible reports whether userID is in scope for ctx. Callers hold s.mu.
+func (s *UserStore) visible(ctx context.Context, userID uuid.UUID) bool {
+	orgID, ok := repository.TenantFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return s.orgs != nil && s.orgs.isMember(orgID, userID)
+}
+
+// Create inserts a new user, enforcing the unique email constraint.
+func (s *UserStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if err := user.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	s.users[user.ID] = *user
+	return nil
+}
+
+// GetByEmail finds a user by email, ignoring case.
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, strings.TrimSpace(email)) && s.visible(ctx, user.ID) {
+			u := user
+			return &u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// GetByID finds a user by ID.
+func (s *UserStore) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok || !s.visible(ctx, id) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// GetByIDForUpdate finds a user by ID. The memory store has no transactions
+// to hold a lock for.
+func (s *UserStore) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return s.GetByID(ctx, id)
+}
+
+// List returns all users ordered by creation time.
+func (s *UserStore) List(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		if s.visible(ctx, user.ID) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return users, nil
+}
+
+// Each calls fn for every user in creation order.
+func (s *UserStore) Each(ctx context.Context, fn func(*models.User) error) error {
+	users, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search implements UserSearcher like UserRepository does on databases other
+// than PostgreSQL: users must contain every word, and words that start a
+// field or a name part rank higher.
+func (s *UserStore) Search(ctx context.Context, query repository.UserSearchQuery) ([]repository.UserSearchHit, int64, error) {
+	terms := repository.SearchTerms(query.Text)
+	users, err := s.List(ctx)
+	if err != nil || len(terms) == 0 {
+		return []repository.UserSearchHit{}, 0, err
+	}
+
+	var hits []repository.UserSearchHit
+	for _, user := range users {
+		if user.Status == models.StatusErased {
+			continue
+		}
+		name, displayName, email := strings.ToLower(user.Name), strings.ToLower(user.DisplayName), strings.ToLower(user.Email)
+		score := 0.0
+		for _, term := range terms {
+			if !strings.Contains(name, term) && !strings.Contains(displayName, term) && !strings.Contains(email, term) {
+				score = 0
+				break
+			}
+			score++
+			if strings.HasPrefix(name, term) || strings.Contains(name, " "+term) || strings.HasPrefix(displayName, term) || strings.HasPrefix(email, term) {
+				score++
+			}
+		}
+		if score == 0 {
+			continue
+		}
+		if email == strings.Join(terms, " ") {
+			score += 4
+		}
+		hits = append(hits, repository.UserSearchHit{User: user, Score: score})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].User.ID.String() < hits[j].User.ID.String()
+	})
+
+	total := int64(len(hits))
+	if query.Offset >= len(hits) {
+		return []repository.UserSearchHit{}, total, nil
+	}
+	hits = hits[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(hits) {
+		hits = hits[:query.Limit]
+	}
+	return hits, total, nil
+}
+
+// Update replaces a stored user.
+func (s *UserStore) Update(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; !ok || !s.visible(ctx, user.ID) {
+		return gorm.ErrRecordNotFound
+	}
+	for id, existing := range s.users {
+		if id != user.ID && existing.Email == user.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	user.UpdatedAt = time.Now()
+	s.users[user.ID] = *user
+	return nil
+}
+
+// Delete removes a user by ID.
+func (s *UserStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.visible(ctx, id) {
+		delete(s.users, id)
+	}
+	return nil
+}
+
+// IdentityStore is an in-memory repository.IdentityStore.
+type IdentityStore struct {
+	mu         sync.RWMutex
+	identities map[uuid.UUID]models.UserIdentity
+}
+
+// NewIdentityStore creates an empty IdentityStore.
+func NewIdentityStore() *IdentityStore {
+	return &IdentityStore{identities: make(map[uuid.UUID]models.UserIdentity)}
+}
+
+// Create inserts a new identity, enforcing the unique indexes.
+func (s *IdentityStore) Create(ctx context.Context, identity *models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.identities {
+		if existing.Provider == identity.Provider &&
+			(existing.Subject == identity.Subject || existing.UserID == identity.UserID) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if err := identity.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	identity.CreatedAt = now
+	identity.UpdatedAt = now
+	s.identities[identity.ID] = *identity
+	return nil
+}
+
+// GetByProviderSubject finds the identity for a provider account.
+func (s *IdentityStore) GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	return s.find(func(i models.UserIdentity) bool { return i.Provider == provider && i.Subject == subject })
+}
+
+// GetByUserProvider finds the identity a user has linked for provider.
+func (s *IdentityStore) GetByUserProvider(ctx context.Context, userID uuid.UUID, provider string) (*models.UserIdentity, error) {
+	return s.find(func(i models.UserIdentity) bool { return i.UserID == userID && i.Provider == provider })
+}
+
+// ListByUser returns all identities linked to a user.
+func (s *IdentityStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var identities []models.UserIdentity
+	for _, identity := range s.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].LinkedAt.Before(identities[j].LinkedAt) })
+	return identities, nil
+}
+
+// Update replaces a stored identity.
+func (s *IdentityStore) Update(ctx context.Context, identity *models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.identities[identity.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	identity.UpdatedAt = time.Now()
+	s.identities[identity.ID] = *identity
+	return nil
+}
+
+// DeleteByUserProvider removes the identity a user has linked for provider.
+func (s *IdentityStore) DeleteByUserProvider(ctx context.Context, userID uuid.UUID, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, identity := range s.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			delete(s.identities, id)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (s *IdentityStore) find(match func(models.UserIdentity) bool) (*models.UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.identities {
+		if match(identity) {
+			i := identity
+			return &i, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// DeleteByUser removes every identity linked to a user.
+func (s *IdentityStore) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, identity := range s.identities {
+		if identity.UserID == userID {
+			delete(s.identities, id)
+		}
+	}
+	return nil
+}
+
+// LoginCodeStore is an in-memory repository.LoginCodeStore.
+type LoginCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]models.LoginCode
+}
+
+// NewLoginCodeStore creates an empty LoginCodeStore.
+func NewLoginCodeStore() *LoginCodeStore {
+	return &LoginCodeStore{codes: make(map[string]models.LoginCode)}
+}
+
+// Create inserts a new login code.
+func (s *LoginCodeStore) Create(ctx context.Context, code *models.LoginCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code.CreatedAt = time.Now()
+	s.codes[code.CodeHash] = *code
+	return nil
+}
+
+// Consume deletes an unexpired code and returns it.
+func (s *LoginCodeStore) Consume(ctx context.Context, codeHash string) (*models.LoginCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok || !code.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(s.codes, codeHash)
+	return &code, nil
+}
+
+// DeleteByUser removes every code issued to a user.
+func (s *LoginCodeStore) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, code := range s.codes {
+		if code.UserID == userID {
+			delete(s.codes, hash)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes codes that can no longer be redeemed.
+func (s *LoginCodeStore) DeleteExpired(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, code := range s.codes {
+		if !code.ExpiresAt.After(now) {
+			delete(s.codes, hash)
+		}
+	}
+	return nil
+}
+
+// SessionStore is an in-memory repository.SessionStore.
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions map[uuid.UUID]models.Session
+}
+
+// NewSessionStore creates an empty SessionStore.
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[uuid.UUID]models.Session)}
+}
+
+// Create inserts a new session.
+func (s *SessionStore) Create(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := session.BeforeCreate(nil); err != nil {
+		return err
+	}
+	session.CreatedAt = time.Now()
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+// GetActive returns an unexpired session by ID.
+func (s *SessionStore) GetActive(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+// ListActiveByUser returns a user's unexpired sessions, newest first.
+func (s *SessionStore) ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// Delete removes one of a user's sessions.
+func (s *SessionStore) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// DeleteByUser removes all of a user's sessions except keep.
+func (s *SessionStore) DeleteByUser(ctx context.Context, userID, keep uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != keep {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// ListExpiredImpersonations returns expired impersonation sessions.
+func (s *SessionStore) ListExpiredImpersonations(ctx context.Context) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.ImpersonatorID != nil && !session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteExpired removes sessions whose tokens have expired, except
+// impersonation sessions.
+func (s *SessionStore) DeleteExpired(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.ImpersonatorID == nil && !session.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// EmailChangeStore is an in-memory repository.EmailChangeStore.
+type EmailChangeStore struct {
+	mu      sync.Mutex
+	changes map[uuid.UUID]models.EmailChange
+}
+
+// NewEmailChangeStore creates an empty EmailChangeStore.
+func NewEmailChangeStore() *EmailChangeStore {
+	return &EmailChangeStore{changes: make(map[uuid.UUID]models.EmailChange)}
+}
+
+// Replace stores change, discarding any change the user already has pending.
+func (s *EmailChangeStore) Replace(ctx context.Context, change *models.EmailChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change.CreatedAt = time.Now()
+	s.changes[change.UserID] = *change
+	return nil
+}
+
+// GetByConfirmHash returns the unexpired change with the given confirm token hash.
+func (s *EmailChangeStore) GetByConfirmHash(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return s.find(func(c models.EmailChange) bool { return c.ConfirmTokenHash == hash })
+}
+
+// GetByCancelHash returns the unexpired change with the given cancel token hash.
+func (s *EmailChangeStore) GetByCancelHash(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return s.find(func(c models.EmailChange) bool { return c.CancelTokenHash == hash })
+}
+
+// GetByUser returns the user's unexpired change.
+func (s *EmailChangeStore) GetByUser(ctx context.Context, userID uuid.UUID) (*models.EmailChange, error) {
+	return s.find(func(c models.EmailChange) bool { return c.UserID == userID })
+}
+
+func (s *EmailChangeStore) find(match func(models.EmailChange) bool) (*models.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, change := range s.changes {
+		if match(change) && change.ExpiresAt.After(now) {
+			return &change, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// Delete removes the user's pending change.
+func (s *EmailChangeStore) Delete(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.changes, userID)
+	return nil
+}
+
+// DeleteExpired removes changes that can no longer be confirmed.
+func (s *EmailChangeStore) DeleteExpired(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for userID, change := range s.changes {
+		if !change.ExpiresAt.After(now) {
+			delete(s.changes, userID)
+		}
+	}
+	return nil
+}
+
+// AuditStore is an in-memory repository.AuditStore.
+type AuditStore struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+// NewAuditStore creates an empty AuditStore.
+func NewAuditStore() *AuditStore {
+	return &AuditStore{}
+}
+
+// Create appends an event.
+func (s *AuditStore) Create(ctx context.Context, event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	event.CreatedAt = time.Now()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// List returns the events matching filter, newest first, along with the total number of matches.
+func (s *AuditStore) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEvent, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []models.AuditEvent
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		switch {
+		case filter.ActorID != nil && (event.ActorID == nil || *event.ActorID != *filter.ActorID),
+			filter.TargetType != "" && event.TargetType != filter.TargetType,
+			filter.TargetID != "" && event.TargetID != filter.TargetID,
+			filter.Action != "" && event.Action != filter.Action,
+			!filter.From.IsZero() && event.CreatedAt.Before(filter.From),
+			!filter.To.IsZero() && !event.CreatedAt.Before(filter.To):
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	total := int64(len(matched))
+	if filter.Offset >= len(matched) {
+		return []models.AuditEvent{}, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+// ListBySubject returns the events the user performed or was the target of, oldest first.
+func (s *AuditStore) ListBySubject(ctx context.Context, userType string, userID uuid.UUID) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.AuditEvent
+	for _, event := range s.events {
+		if (event.ActorID != nil && *event.ActorID == userID) || (event.TargetType == userType && event.TargetID == userID.String()) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// AnonymizeSubject removes the user's personal data from the events about them.
+func (s *AuditStore) AnonymizeSubject(ctx context.Context, userType string, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.events {
+		event := &s.events[i]
+		target := event.TargetType == userType && event.TargetID == userID.String()
+		if (event.ActorID != nil && *event.ActorID == userID) || (event.ActorID == nil && target) {
+			event.IPAddress, event.UserAgent = "", ""
+		}
+		if target {
+			event.Changes, event.Details = nil, nil
+		}
+	}
+	return nil
+}
+
+// AnonymizeContaining clears the details, changes and client details of the
+// events whose details contain text, ignoring case.
+func (s *AuditStore) AnonymizeContaining(ctx context.Context, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text = strings.ToLower(text)
+	for i := range s.events {
+		event := &s.events[i]
+		if event.Details == nil {
+			continue
+		}
+		details, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(strings.ToLower(string(details)), text) {
+			event.Changes, event.Details = nil, nil
+			event.IPAddress, event.UserAgent = "", ""
+		}
+	}
+	return nil
+}
+
+// WebhookStore is an in-memory repository.WebhookStore.
+type WebhookStore struct {
+	mu         sync.Mutex
+	endpoints  []models.WebhookEndpoint
+	deliveries []models.WebhookDelivery
+}
+
+// NewWebhookStore creates an empty WebhookStore.
+func NewWebhookStore() *WebhookStore {
+	return &WebhookStore{}
+}
+
+// CreateEndpoint inserts a new endpoint.
+func (s *WebhookStore) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := endpoint.BeforeCreate(nil); err != nil {
+		return err
+	}
+	endpoint.CreatedAt = time.Now()
+	endpoint.UpdatedAt = endpoint.CreatedAt
+	s.endpoints = append(s.endpoints, *endpoint)
+	return nil
+}
+
+// GetEndpoint finds an endpoint by ID.
+func (s *WebhookStore) GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, endpoint := range s.endpoints {
+		if endpoint.ID == id {
+			return &endpoint, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListEndpoints returns all endpoints ordered by creation time.
+func (s *WebhookStore) ListEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.WebhookEndpoint{}, s.endpoints...), nil
+}
+
+// ListActiveEndpoints returns the endpoints that are currently receiving events.
+func (s *WebhookStore) ListActiveEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var endpoints []models.WebhookEndpoint
+	for _, endpoint := range s.endpoints {
+		if endpoint.Active {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints, nil
+}
+
+// UpdateEndpoint replaces a stored endpoint.
+func (s *WebhookStore) UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.endpoints {
+		if s.endpoints[i].ID == endpoint.ID {
+			endpoint.UpdatedAt = time.Now()
+			s.endpoints[i] = *endpoint
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// DeleteEndpoint removes an endpoint and its delivery history.
+func (s *WebhookStore) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.endpoints {
+		if s.endpoints[i].ID == id {
+			s.endpoints = append(s.endpoints[:i], s.endpoints[i+1:]...)
+			deliveries := s.deliveries[:0]
+			for _, delivery := range s.deliveries {
+				if delivery.EndpointID != id {
+					deliveries = append(deliveries, delivery)
+				}
+			}
+			s.deliveries = deliveries
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// CreateDelivery inserts a new delivery.
+func (s *WebhookStore) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := delivery.BeforeCreate(nil); err != nil {
+		return err
+	}
+	delivery.CreatedAt = time.Now()
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+// GetDelivery finds a delivery by ID.
+func (s *WebhookStore) GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, delivery := range s.deliveries {
+		if delivery.ID == id {
+			return &delivery, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// UpdateDelivery replaces a stored delivery.
+func (s *WebhookStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == delivery.ID {
+			s.deliveries[i] = *delivery
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// ListDeliveriesContaining returns the deliveries whose payload contains text.
+func (s *WebhookStore) ListDeliveriesContaining(ctx context.Context, text string) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if strings.Contains(delivery.Payload, text) {
+			matched = append(matched, delivery)
+		}
+	}
+	return matched, nil
+}
+
+// ListDeliveries returns an endpoint's deliveries, newest first, and their total number.
+func (s *WebhookStore) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []models.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if s.deliveries[i].EndpointID == endpointID {
+			matched = append(matched, s.deliveries[i])
+		}
+	}
+	total := int64(len(matched))
+	if offset >= len(matched) {
+		return []models.WebhookDelivery{}, total, nil
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
+
+// OrganizationStore is an in-memory repository.OrganizationStore.
+type OrganizationStore struct {
+	mu          sync.RWMutex
+	orgs        map[uuid.UUID]models.Organization
+	memberships map[uuid.UUID]models.Membership
+}
+
+// NewOrganizationStore creates an empty OrganizationStore.
+func NewOrganizationStore() *OrganizationStore {
+	return &OrganizationStore{
+		orgs:        make(map[uuid.UUID]models.Organization),
+		memberships: make(map[uuid.UUID]models.Membership),
+	}
+}
+
+// Create inserts a new organization, enforcing the unique slug constraint.
+func (s *OrganizationStore) Create(ctx context.Context, org *models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.orgs {
+		if existing.Slug == org.Slug {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if err := org.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	org.CreatedAt, org.UpdatedAt = now, now
+	s.orgs[org.ID] = *org
+	return nil
+}
+
+// GetByID finds an organization by ID.
+func (s *OrganizationStore) GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	org, ok := s.orgs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &org, nil
+}
+
+// GetBySlug finds an organization by slug.
+func (s *OrganizationStore) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, org := range s.orgs {
+		if org.Slug == slug {
+			o := org
+			return &o, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// AddMember inserts a membership, enforcing one membership per user and organization.
+func (s *OrganizationStore) AddMember(ctx context.Context, membership *models.Membership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isMemberLocked(membership.OrganizationID, membership.UserID) {
+		return gorm.ErrDuplicatedKey
+	}
+	if err := membership.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	membership.CreatedAt, membership.UpdatedAt = now, now
+	stored := *membership
+	stored.Organization = nil
+	s.memberships[membership.ID] = stored
+	return nil
+}
+
+// GetMembership finds a user's membership of an organization, with the organization loaded.
+func (s *OrganizationStore) GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			return s.withOrganization(membership), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListMemberships returns a user's memberships, oldest first, with their organizations loaded.
+func (s *OrganizationStore) ListMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []models.Membership
+	for _, membership := range s.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, *s.withOrganization(membership))
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].CreatedAt.Before(memberships[j].CreatedAt) })
+	return memberships, nil
+}
+
+// ListMembers returns an organization's memberships, oldest first.
+func (s *OrganizationStore) ListMembers(ctx context.Context, orgID uuid.UUID) ([]models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []models.Membership
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID {
+			memberships = append(memberships, membership)
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].CreatedAt.Before(memberships[j].CreatedAt) })
+	return memberships, nil
+}
+
+// CountMembers returns the number of an organization's members with role.
+func (s *OrganizationStore) CountMembers(ctx context.Context, orgID uuid.UUID, role string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID && membership.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateMembership replaces a stored membership.
+func (s *OrganizationStore) UpdateMembership(ctx context.Context, membership *models.Membership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.memberships[membership.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	membership.UpdatedAt = time.Now()
+	stored := *membership
+	stored.Organization = nil
+	s.memberships[membership.ID] = stored
+	return nil
+}
+
+// DeleteMembership removes a user from an organization.
+func (s *OrganizationStore) DeleteMembership(ctx context.Context, orgID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, membership := range s.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			delete(s.memberships, id)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// DeleteMembershipsByUser removes a user from every organization.
+func (s *OrganizationStore) DeleteMembershipsByUser(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, membership := range s.memberships {
+		if membership.UserID == userID {
+			delete(s.memberships, id)
+		}
+	}
+	return nil
+}
+
+func (s *OrganizationStore) isMember(orgID, userID uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isMemberLocked(orgID, userID)
+}
+
+func (s *OrganizationStore) isMemberLocked(orgID, userID uuid.UUID) bool {
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OrganizationStore) withOrganization(membership models.Membership) *models.Membership {
+	if org, ok := s.orgs[membership.OrganizationID]; ok {
+		membership.Organization = &org
+	}
+	return &membership
+}
+
+// InvitationStore is an in-memory repository.InvitationStore. Organizations are
+// loaded from orgs, if set.
+type InvitationStore struct {
+	mu          sync.RWMutex
+	invitations map[uuid.UUID]models.Invitation
+	orgs        *OrganizationStore
+}
+
+// NewInvitationStore creates an empty InvitationStore.
+func NewInvitationStore(orgs *OrganizationStore) *InvitationStore {
+	return &InvitationStore{invitations: make(map[uuid.UUID]models.Invitation), orgs: orgs}
+}
+
+// Create inserts a new invitation, enforcing the unique token hash constraint.
+func (s *InvitationStore) Create(ctx context.Context, invitation *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.invitations {
+		if existing.TokenHash == invitation.TokenHash {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if err := invitation.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	invitation.CreatedAt, invitation.UpdatedAt = now, now
+	stored := *invitation
+	stored.Organization = nil
+	s.invitations[invitation.ID] = stored
+	return nil
+}
+
+// GetByID finds one of an organization's invitations.
+func (s *InvitationStore) GetByID(ctx context.Context, orgID, id uuid.UUID) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok || invitation.OrganizationID != orgID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &invitation, nil
+}
+
+// GetByTokenHash finds an invitation by the hash of its token, with the organization loaded.
+func (s *InvitationStore) GetByTokenHash(ctx context.Context, hash string) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, invitation := range s.invitations {
+		if invitation.TokenHash == hash {
+			if s.orgs != nil {
+				invitation.Organization, _ = s.orgs.GetByID(ctx, invitation.OrganizationID)
+			}
+			return &invitation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// GetPending finds the organization's pending invitation for email.
+func (s *InvitationStore) GetPending(ctx context.Context, orgID uuid.UUID, email string) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, invitation := range s.invitations {
+		if invitation.OrganizationID == orgID && invitation.Email == email && invitation.Status() == models.InvitationPending {
+			return &invitation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// List returns an organization's invitations, newest first.
+func (s *InvitationStore) List(ctx context.Context, orgID uuid.UUID) ([]models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invitations []models.Invitation
+	for _, invitation := range s.invitations {
+		if invitation.OrganizationID == orgID {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].CreatedAt.After(invitations[j].CreatedAt) })
+	return invitations, nil
+}
+
+// Update replaces a stored invitation.
+func (s *InvitationStore) Update(ctx context.Context, invitation *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invitations[invitation.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	invitation.UpdatedAt = time.Now()
+	stored := *invitation
+	stored.Organization = nil
+	s.invitations[invitation.ID] = stored
+	return nil
+}
+
+// MarkAccepted records that userID accepted a pending or expired invitation.
+func (s *InvitationStore) MarkAccepted(ctx context.Context, id, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	invitation.AcceptedAt, invitation.AcceptedBy, invitation.UpdatedAt = &now, &userID, now
+	s.invitations[id] = invitation
+	return nil
+}
+
+// AnonymizeEmail replaces email with replacement on the invitations sent to
+// it, revoking those that are still open.
+func (s *InvitationStore) AnonymizeEmail(ctx context.Context, email, replacement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, invitation := range s.invitations {
+		if invitation.Email != email {
+			continue
+		}
+		if invitation.AcceptedAt == nil && invitation.RevokedAt == nil {
+			invitation.RevokedAt = &now
+		}
+		invitation.Email, invitation.UpdatedAt = replacement, now
+		s.invitations[id] = invitation
+	}
+	return nil
+}
+
+// ErasureStore is an in-memory repository.ErasureStore.
+type ErasureStore struct {
+	mu       sync.Mutex
+	requests []models.ErasureRequest
+}
+
+// NewErasureStore creates an empty ErasureStore.
+func NewErasureStore() *ErasureStore {
+	return &ErasureStore{}
+}
+
+// Create inserts a new erasure request.
+func (s *ErasureStore) Create(ctx context.Context, request *models.ErasureRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := request.BeforeCreate(nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	request.CreatedAt, request.UpdatedAt = now, now
+	s.requests = append(s.requests, *request)
+	return nil
+}
+
+// Get finds an erasure request by ID.
+func (s *ErasureStore) Get(ctx context.Context, id uuid.UUID) (*models.ErasureRequest, error) {
+	return s.find(func(r models.ErasureRequest) bool { return r.ID == id })
+}
+
+// GetPendingByUser finds the user's erasure request that has not been carried out yet.
+func (s *ErasureStore) GetPendingByUser(ctx context.Context, userID uuid.UUID) (*models.ErasureRequest, error) {
+	return s.find(func(r models.ErasureRequest) bool { return r.UserID == userID && r.Status == models.ErasurePending })
+}
+
+func (s *ErasureStore) find(match func(models.ErasureRequest) bool) (*models.ErasureRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, request := range s.requests {
+		if match(request) {
+			return &request, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// List returns erasure requests, newest first, and their total number.
+func (s *ErasureStore) List(ctx context.Context, limit, offset int) ([]models.ErasureRequest, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []models.ErasureRequest
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		matched = append(matched, s.requests[i])
+	}
+	total := int64(len(matched))
+	if offset >= len(matched) {
+		return []models.ErasureRequest{}, total, nil
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
+
+// Update replaces a stored erasure request.
+func (s *ErasureStore) Update(ctx context.Context, request *models.ErasureRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.requests {
+		if s.requests[i].ID == request.ID {
+			request.UpdatedAt = time.Now()
+			s.requests[i] = *request
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// JobStore is an in-memory repository.JobStore. Jobs are only visible to the process
+// that enqueued them, so it suits tests and single-instance experiments.
+type JobStore struct {
+	mu   sync.Mutex
+	jobs []models.Job
+}
+
+// NewJobStore creates an empty JobStore.
+func NewJobStore() *JobStore {
+	return &JobStore{}
+}
+
+// Enqueue inserts job. It reports false without error when a job with the same
+// UniqueKey already exists.
+func (s *JobStore) Enqueue(ctx context.Context, job *models.Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.UniqueKey != nil {
+		for _, existing := range s.jobs {
+			if existing.UniqueKey != nil && *existing.UniqueKey == *job.UniqueKey {
+				return false, nil
+			}
+		}
+	}
+	if err := job.BeforeCreate(nil); err != nil {
+		return false, err
+	}
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	s.jobs = append(s.jobs, *job)
+	return true, nil
+}
+
+// Claim locks the next due job of one of types for worker.
+func (s *JobStore) Claim(ctx context.Context, worker string, types []string, staleBefore time.Time) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	next := -1
+	for i, job := range s.jobs {
+		if !containsString(types, job.Type) {
+			continue
+		}
+		due := job.Status == models.JobPending && !job.RunAt.After(now)
+		stale := job.Status == models.JobRunning && job.LockedAt != nil && job.LockedAt.Before(staleBefore)
+		if (due || stale) && (next < 0 || job.RunAt.Before(s.jobs[next].RunAt)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	job := &s.jobs[next]
+	job.Status = models.JobRunning
+	job.LockedAt = &now
+	job.LockedBy = worker
+	job.Attempts++
+	claimed := *job
+	return &claimed, nil
+}
+
+// Complete marks a job as done.
+func (s *JobStore) Complete(ctx context.Context, id uuid.UUID) error {
+	return s.update(id, func(job *models.Job) {
+		now := time.Now()
+		job.Status = models.JobDone
+		job.CompletedAt = &now
+	})
+}
+
+// Retry returns a failed job to the queue to run again at runAt.
+func (s *JobStore) Retry(ctx context.Context, id uuid.UUID, runAt time.Time, lastError string) error {
+	return s.update(id, func(job *models.Job) {
+		job.Status = models.JobPending
+		job.RunAt = runAt
+		job.LastError = lastError
+	})
+}
+
+// Bury moves a job to the dead-letter state.
+func (s *JobStore) Bury(ctx context.Context, id uuid.UUID, lastError string) error {
+	return s.update(id, func(job *models.Job) {
+		job.Status = models.JobDead
+		job.LastError = lastError
+	})
+}
+
+func (s *JobStore) update(id uuid.UUID, apply func(*models.Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.jobs {
+		if s.jobs[i].ID == id {
+			apply(&s.jobs[i])
+			s.jobs[i].LockedAt = nil
+			s.jobs[i].LockedBy = ""
+			s.jobs[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// DeleteCompleted removes jobs that finished before before.
+func (s *JobStore) DeleteCompleted(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := s.jobs[:0]
+	for _, job := range s.jobs {
+		if job.Status != models.JobDone || job.CompletedAt == nil || !job.CompletedAt.Before(before) {
+			jobs = append(jobs, job)
+		}
+	}
+	s.jobs = jobs
+	return nil
+}
+
+// DeleteContaining removes the jobs whose payload contains text.
+func (s *JobStore) DeleteContaining(ctx context.Context, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := s.jobs[:0]
+	for _, job := range s.jobs {
+		if !strings.Contains(job.Payload, text) {
+			jobs = append(jobs, job)
+		}
+	}
+	s.jobs = jobs
+	return nil
+}
+
+// Jobs returns a copy of every stored job.
+func (s *JobStore) Jobs() []models.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.Job{}, s.jobs...)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_ repository.UserStore         = (*UserStore)(nil)
+	_ repository.UserSearcher      = (*UserStore)(nil)
+	_ repository.IdentityStore     = (*IdentityStore)(nil)
+	_ repository.LoginCodeStore    = (*LoginCodeStore)(nil)
+	_ repository.SessionStore      = (*SessionStore)(nil)
+	_ repository.EmailChangeStore  = (*EmailChangeStore)(nil)
+	_ repository.AuditStore        = (*AuditStore)(nil)
+	_ repository.WebhookStore      = (*WebhookStore)(nil)
+	_ repository.OrganizationStore = (*OrganizationStore)(nil)
+	_ repository.InvitationStore   = (*InvitationStore)(nil)
+	_ repository.ErasureStore      = (*ErasureStore)(nil)
+	_ repository.JobStore          = (*JobStore)(nil)
+)
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// OrganizationRepository stores organizations and their memberships.
+type OrganizationRepository struct {
+	db *gorm.DB
+}
+
+// NewOrganizationRepository creates a new repository instance.
+func NewOrganizationRepository(db *gorm.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// Create inserts a new organization.
+func (r *OrganizationRepository) Create(ctx context.Context, org *models.Organization) error {
+	return conn(ctx, r.db).Create(org).Error
+}
+
+// GetByID finds an organization by ID.
+func (r *OrganizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	if err := conn(ctx, r.db).First(&org, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetBySlug finds an organization by slug.
+func (r *OrganizationRepository) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	var org models.Organization
+	if err := conn(ctx, r.db).First(&org, "slug = ?", slug).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// AddMember inserts a membership.
+func (r *OrganizationRepository) AddMember(ctx context.Context, membership *models.Membership) error {
+	return conn(ctx, r.db).Create(membership).Error
+}
+
+// GetMembership finds a user's membership of an organization, with the organization loaded.
+func (r *OrganizationRepository) GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*models.Membership, error) {
+	var membership models.Membership
+	err := conn(ctx, r.db).Preload("Organization").
+		First(&membership, "organization_id = ? AND user_id = ?", orgID, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListMemberships returns a user's memberships, oldest first, with their organizations loaded.
+func (r *OrganizationRepository) ListMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := conn(ctx, r.db).Preload("Organization").
+		Where("user_id = ?", userID).Order("created_at").Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// ListMembers returns an organization's memberships, oldest first.
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID uuid.UUID) ([]models.Membership, error) {
+	var memberships []models.Membership
+	if err := conn(ctx, r.db).Where("organization_id = ?", orgID).Order("created_at").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// CountMembers returns the number of an organization's members with role.
+func (r *OrganizationRepository) CountMembers(ctx context.Context, orgID uuid.UUID, role string) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ?", orgID, role).Count(&count).Error
+	return count, err
+}
+
+// UpdateMembership saves changes to a membership.
+func (r *OrganizationRepository) UpdateMembership(ctx context.Context, membership *models.Membership) error {
+	return conn(ctx, r.db).Omit("Organization").Save(membership).Error
+}
+
+// DeleteMembership removes a user from an organization.
+func (r *OrganizationRepository) DeleteMembership(ctx context.Context, orgID, userID uuid.UUID) error {
+	result := conn(ctx, r.db).Delete(&models.Membership{}, "organization_id = ? AND user_id = ?", orgID, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteMembershipsByUser removes a user from every organization.
+func (r *OrganizationRepository) DeleteMembershipsByUser(ctx context.Context, userID uuid.UUID) error {
+	return conn(ctx, r.db).Delete(&models.Membership{}, "user_id = ?", userID).Error
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// SessionRepository defines database operations for sign-in sessions.
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new repository instance.
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create inserts a new session.
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return conn(ctx, r.db).Create(session).Error
+}
+
+// GetActive returns an unexpired session by ID.
+func (r *SessionRepository) GetActive(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := conn(ctx, r.db).Where("id = ? AND expires_at > ?", id, time.Now()).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveByUser returns a user's unexpired sessions, newest first.
+func (r *SessionRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := conn(ctx, r.db).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("created_at desc").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete removes one of a user's sessions.
+func (r *SessionRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	result := conn(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteByUser removes all of a user's sessions except keep, which may be uuid.Nil.
+func (r *SessionRepository) DeleteByUser(ctx context.Context, userID, keep uuid.UUID) error {
+	return conn(ctx, r.db).Where("user_id = ? AND id <> ?", userID, keep).Delete(&models.Session{}).Error
+}
+
+// ListExpiredImpersonations returns expired impersonation sessions, which
+// DeleteExpired leaves in place so their end can be recorded.
+func (r *SessionRepository) ListExpiredImpersonations(ctx context.Context) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := conn(ctx, r.db).Where("impersonator_id IS NOT NULL AND expires_at <= ?", time.Now()).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteExpired removes sessions whose tokens have expired, except
+// impersonation sessions.
+func (r *SessionRepository) DeleteExpired(ctx context.Context) error {
+	return conn(ctx, r.db).Where("impersonator_id IS NULL AND expires_at <= ?", time.Now()).Delete(&models.Session{}).Error
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// UserStore persists users. Lookups return gorm.ErrRecordNotFound when no user matches.
+type UserStore interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// GetByIDForUpdate is GetByID that also locks the row until the
+	// surrounding transaction ends.
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.User, error)
+	List(ctx context.Context) ([]models.User, error)
+	Each(ctx context.Context, fn func(*models.User) error) error
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// UserSearcher finds users by free text, best match first. Implementations
+// honour tenant scoping like UserStore and never return erased users, so an
+// external search engine can be plugged in behind the same interface.
+type UserSearcher interface {
+	Search(ctx context.Context, query UserSearchQuery) ([]UserSearchHit, int64, error)
+}
+
+// UserSearchQuery is a page of a user search.
+type UserSearchQuery struct {
+	Text   string
+	Limit  int
+	Offset int
+}
+
+// UserSearchHit is a user matching a search, with its relevance. Scores are
+// only comparable within one search.
+type UserSearchHit struct {
+	User  models.User
+	Score float64
+}
+
+// IdentityStore persists the external identities linked to users.
+type IdentityStore interface {
+	Create(ctx context.Context, identity *models.UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	GetByUserProvider(ctx context.Context, userID uuid.UUID, provider string) (*models.UserIdentity, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error)
+	Update(ctx context.Context, identity *models.UserIdentity) error
+	DeleteByUserProvider(ctx context.Context, userID uuid.UUID, provider string) error
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// LoginCodeStore persists one-time login codes.
+type LoginCodeStore interface {
+	Create(ctx context.Context, code *models.LoginCode) error
+	Consume(ctx context.Context, codeHash string) (*models.LoginCode, error)
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
+
+// SessionStore persists sign-in sessions. Lookups return gorm.ErrRecordNotFound
+// when no unexpired session matches.
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetActive(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	DeleteByUser(ctx context.Context, userID, keep uuid.UUID) error
+	ListExpiredImpersonations(ctx context.Context) ([]models.Session, error)
+	DeleteExpired(ctx context.Context) error
+}
+
+// EmailChangeStore persists pending email changes. Lookups return
+// gorm.ErrRecordNotFound when no unexpired change matches.
+type EmailChangeStore interface {
+	Replace(ctx context.Context, change *models.EmailChange) error
+	GetByConfirmHash(ctx context.Context, hash string) (*models.EmailChange, error)
+	GetByCancelHash(ctx context.Context, hash string) (*models.EmailChange, error)
+	GetByUser(ctx context.Context, userID uuid.UUID) (*models.EmailChange, error)
+	Delete(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
+
+// JobStore persists background jobs. Claim returns gorm.ErrRecordNotFound when no job is due.
+type JobStore interface {
+	Enqueue(ctx context.Context, job *models.Job) (bool, error)
+	Claim(ctx context.Context, worker string, types []string, staleBefore time.Time) (*models.Job, error)
+	Complete(ctx context.Context, id uuid.UUID) error
+	Retry(ctx context.Context, id uuid.UUID, runAt time.Time, lastError string) error
+	Bury(ctx context.Context, id uuid.UUID, lastError string) error
+	DeleteCompleted(ctx context.Context, before time.Time) error
+	DeleteContaining(ctx context.Context, text string) error
+}
+
+// AuditStore appends audit events and queries them.
+type AuditStore interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, int64, error)
+	ListBySubject(ctx context.Context, userType string, userID uuid.UUID) ([]models.AuditEvent, error)
+	AnonymizeSubject(ctx context.Context, userType string, userID uuid.UUID) error
+	AnonymizeContaining(ctx context.Context, text string) error
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	ActorID    *uuid.UUID
+	TargetType string
+	TargetID   string
+	Action     string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+// WebhookStore persists webhook endpoints and deliveries. Lookups return
+// gorm.ErrRecordNotFound when nothing matches.
+type WebhookStore interface {
+	CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error)
+	ListActiveEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]models.WebhookDelivery, int64, error)
+	ListDeliveriesContaining(ctx context.Context, text string) ([]models.WebhookDelivery, error)
+}
+
+// OrganizationStore persists organizations and memberships. Lookups return
+// gorm.ErrRecordNotFound when nothing matches.
+type OrganizationStore interface {
+	Create(ctx context.Context, org *models.Organization) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	AddMember(ctx context.Context, membership *models.Membership) error
+	GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*models.Membership, error)
+	ListMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error)
+	ListMembers(ctx context.Context, orgID uuid.UUID) ([]models.Membership, error)
+	CountMembers(ctx context.Context, orgID uuid.UUID, role string) (int64, error)
+	UpdateMembership(ctx context.Context, membership *models.Membership) error
+	DeleteMembership(ctx context.Context, orgID, userID uuid.UUID) error
+	DeleteMembershipsByUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// InvitationStore persists organization invitations. Lookups return
+// gorm.ErrRecordNotFound when nothing matches.
+type InvitationStore interface {
+	Create(ctx context.Context, invitation *models.Invitation) error
+	GetByID(ctx context.Context, orgID, id uuid.UUID) (*models.Invitation, error)
+	GetByTokenHash(ctx context.Context, hash string) (*models.Invitation, error)
+	GetPending(ctx context.Context, orgID uuid.UUID, email string) (*models.Invitation, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]models.Invitation, error)
+	Update(ctx context.Context, invitation *models.Invitation) error
+	MarkAccepted(ctx context.Context, id, userID uuid.UUID) error
+	AnonymizeEmail(ctx context.Context, email, replacement string) error
+}
+
+// ErasureStore persists erasure requests. Lookups return
+// gorm.ErrRecordNotFound when nothing matches.
+type ErasureStore interface {
+	Create(ctx context.Context, request *models.ErasureRequest) error
+	Get(ctx context.Context, id uuid.UUID) (*models.ErasureRequest, error)
+	GetPendingByUser(ctx context.Context, userID uuid.UUID) (*models.ErasureRequest, error)
+	List(ctx context.Context, limit, offset int) ([]models.ErasureRequest, int64, error)
+	Update(ctx context.Context, request *models.ErasureRequest) error
+}
+
+var (
+	_ UserStore         = (*UserRepository)(nil)
+	_ UserSearcher      = (*UserRepository)(nil)
+	_ IdentityStore     = (*IdentityRepository)(nil)
+	_ LoginCodeStore    = (*LoginCodeRepository)(nil)
+	_ SessionStore      = (*SessionRepository)(nil)
+	_ EmailChangeStore  = (*EmailChangeRepository)(nil)
+	_ JobStore          = (*JobRepository)(nil)
+	_ AuditStore        = (*AuditRepository)(nil)
+	_ WebhookStore      = (*WebhookRepository)(nil)
+	_ OrganizationStore = (*OrganizationRepository)(nil)
+	_ InvitationStore   = (*InvitationRepository)(nil)
+	_ ErasureStore      = (*ErasureRepository)(nil)
+)
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose user queries only see the members of the
+// organization orgID.
+func WithTenant(ctx context.Context, orgID uuid.UUID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, orgID)
+}
+
+// TenantFromContext returns the organization user queries made with ctx are
+// scoped to, if any.
+func TenantFromContext(ctx context.Context) (uuid.UUID, bool) {
+	orgID, ok := ctx.Value(tenantKey{}).(uuid.UUID)
+	return orgID, ok
+}
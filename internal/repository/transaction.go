@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	database "github.com/example/golang-rest-boilerplate/internal/db"
+)
+
+// Transactor runs a function inside a unit of work. Repositories called with the
+// context passed to fn take part in the same transaction. The transaction commits
+// when fn returns nil and rolls back when it returns an error or panics.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txContextKey struct{}
+
+type afterCommitKey struct{}
+
+// afterCommitHooks collects the functions registered with AfterCommit during a transaction.
+type afterCommitHooks struct {
+	fns []func(ctx context.Context)
+}
+
+// GormTransactor implements Transactor with database transactions. Nested calls
+// run in a savepoint of the enclosing transaction.
+type GormTransactor struct {
+	db *gorm.DB
+}
+
+// NewGormTransactor creates a new GormTransactor.
+func NewGormTransactor(db *gorm.DB) *GormTransactor {
+	return &GormTransactor{db: db}
+}
+
+// WithinTransaction implements Transactor.
+func (t *GormTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withAfterCommit(ctx, func(txCtx context.Context) error {
+		return conn(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(txCtx, txContextKey{}, tx))
+		})
+	})
+}
+
+// AfterCommit runs fn once the transaction carried by ctx commits, or right
+// away when ctx carries none. fn receives the context the outermost
+// transaction was started with. Functions registered in a transaction that
+// rolls back, including a nested one, never run.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if hooks, ok := ctx.Value(afterCommitKey{}).(*afterCommitHooks); ok {
+		hooks.fns = append(hooks.fns, fn)
+		return
+	}
+	fn(ctx)
+}
+
+// withAfterCommit calls run with a context collecting AfterCommit functions.
+// When run succeeds they are handed to the enclosing transaction, or called
+// if there is none.
+func withAfterCommit(ctx context.Context, run func(ctx context.Context) error) error {
+	hooks := &afterCommitHooks{}
+	if err := run(context.WithValue(ctx, afterCommitKey{}, hooks)); err != nil {
+		return err
+	}
+	if parent, ok := ctx.Value(afterCommitKey{}).(*afterCommitHooks); ok {
+		parent.fns = append(parent.fns, hooks.fns...)
+		return nil
+	}
+	for _, fn := range hooks.fns {
+		fn(ctx)
+	}
+	return nil
+}
+
+// inTransaction reports whether ctx carries a transaction.
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txContextKey{}).(*gorm.DB)
+	return ok
+}
+
+// conn returns the transaction carried by ctx, or db when there is none.
+// Reads go to a replica unless the request has already written.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txContextKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	if database.PinnedToPrimary(ctx) {
+		return db.WithContext(ctx).Clauses(dbresolver.Write)
+	}
+	return db.WithContext(ctx)
+}
+
+// MemoryTransactor runs functions directly. The in-memory stores of package
+// memorystore cannot roll back, so it is only suitable for tests that do not
+// rely on rollback.
+type MemoryTransactor struct{}
+
+// NewMemoryTransactor creates a new MemoryTransactor.
+func NewMemoryTransactor() *MemoryTransactor { return &MemoryTransactor{} }
+
+// WithinTransaction implements Transactor.
+func (MemoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withAfterCommit(ctx, fn)
+}
+
+var (
+	_ Transactor = (*GormTransactor)(nil)
+	_ Transactor = (*MemoryTransactor)(nil)
+)
@@ -0,0 +1,59 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+func TestGormTransactor(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:transactor?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	users := repository.NewUserRepository(db)
+	transactor := repository.NewGormTransactor(db)
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	var committed []string
+
+	err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, users.Create(ctx, &models.User{Name: "Outer", Email: "outer@example.com"}))
+		repository.AfterCommit(ctx, func(context.Context) { committed = append(committed, "outer") })
+
+		// A failing nested unit of work only rolls back to its savepoint.
+		nestedErr := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			require.NoError(t, users.Create(ctx, &models.User{Name: "Nested", Email: "nested@example.com"}))
+			repository.AfterCommit(ctx, func(context.Context) { committed = append(committed, "nested") })
+			return errBoom
+		})
+		require.ErrorIs(t, nestedErr, errBoom)
+		require.Empty(t, committed, "hooks wait for the outermost commit")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"outer"}, committed)
+
+	_, err = users.GetByEmail(ctx, "outer@example.com")
+	require.NoError(t, err)
+	_, err = users.GetByEmail(ctx, "nested@example.com")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, users.Create(ctx, &models.User{Name: "Rolled", Email: "rolled@example.com"}))
+		repository.AfterCommit(ctx, func(context.Context) { committed = append(committed, "rolled") })
+		return errBoom
+	})
+	require.ErrorIs(t, err, errBoom)
+	require.Equal(t, []string{"outer"}, committed)
+
+	_, err = users.GetByEmail(ctx, "rolled@example.com")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
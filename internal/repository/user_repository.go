@@ -5,11 +5,13 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/example/golang-rest-boilerplate/internal/models"
 )
 
-// UserRepository defines database operations for users.
+// UserRepository defines database operations for users. Queries made with a
+// tenant context (see WithTenant) only see the members of that organization.
 type UserRepository struct {
 	db *gorm.DB
 }
@@ -19,15 +21,25 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// scoped restricts a query to the members of the tenant carried by ctx, if any.
+func (r *UserRepository) scoped(ctx context.Context) *gorm.DB {
+	db := conn(ctx, r.db)
+	if orgID, ok := TenantFromContext(ctx); ok {
+		db = db.Where("EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id AND memberships.organization_id = ?)", orgID)
+	}
+	return db
+}
+
 // Create inserts a new user.
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	return r.db.WithContext(ctx).Create(user).Error
+	return conn(ctx, r.db).Create(user).Error
 }
 
-// GetByEmail finds a user by email.
+// GetByEmail finds a user by email, ignoring case so accounts stored before
+// addresses were normalized are still found.
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.scoped(ctx).Where("LOWER(email) = ?", models.NormalizeEmail(email)).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -36,7 +48,17 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 // GetByID finds a user by ID.
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	if err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
+	if err := r.scoped(ctx).First(&user, "users.id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByIDForUpdate finds a user by ID and locks the row until the transaction
+// ends. SQLite has no row locks and serializes writers instead.
+func (r *UserRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := r.scoped(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "users.id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -45,18 +67,41 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 // List returns all users.
 func (r *UserRepository) List(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	if err := r.db.WithContext(ctx).Find(&users).Error; err != nil {
+	if err := r.scoped(ctx).Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
+// eachBatchSize is the number of users Each loads at a time.
+const eachBatchSize = 500
+
+// Each calls fn for every user, ordered by ID, loading them in batches so
+// that large tables are not held in memory. It stops at the first error.
+func (r *UserRepository) Each(ctx context.Context, fn func(*models.User) error) error {
+	var batch []models.User
+	return r.scoped(ctx).FindInBatches(&batch, eachBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
 // Update updates user fields.
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	return r.db.WithContext(ctx).Save(user).Error
+	// Save inserts rows it cannot update, so check visibility first.
+	if _, ok := TenantFromContext(ctx); ok {
+		if _, err := r.GetByID(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	return conn(ctx, r.db).Save(user).Error
 }
 
 // Delete removes a user by ID.
 func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&models.User{}, "id = ?", id).Error
+	return r.scoped(ctx).Delete(&models.User{}, "users.id = ?", id).Error
 }
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	database "github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// maxSearchTerms limits the number of words of a query that are matched.
+const maxSearchTerms = 8
+
+// likeEscaper escapes LIKE wildcards with "!", which, unlike a backslash,
+// needs no quoting in any supported dialect.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// SearchTerms splits a query into the lowercase words that are matched.
+func SearchTerms(text string) []string {
+	terms := strings.Fields(strings.ToLower(text))
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// Search implements UserSearcher over the name, display name and email of
+// users. On PostgreSQL a user matches a prefix full-text query of the words,
+// contains every word, or is similar to the query by trigrams, which
+// tolerates typos; results are ranked by full-text rank and similarity. On
+// other databases a user must contain every word, and users where a word
+// starts a field or a name part rank higher. An exact email match ranks
+// first on both.
+func (r *UserRepository) Search(ctx context.Context, query UserSearchQuery) ([]UserSearchHit, int64, error) {
+	terms := SearchTerms(query.Text)
+	if len(terms) == 0 {
+		return []UserSearchHit{}, 0, nil
+	}
+
+	var where, rank clause.Expr
+	if r.db.Dialector.Name() == database.DriverPostgres {
+		where, rank = postgresUserSearch(terms)
+	} else {
+		where, rank = likeUserSearch(terms)
+	}
+	matching := func() *gorm.DB {
+		return r.scoped(ctx).Model(&models.User{}).Where("users.status <> ?", models.StatusErased).Where(where)
+	}
+
+	var total int64
+	if err := matching().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		models.User
+		SearchRank float64
+	}
+	err := matching().Select("users.*, ? AS search_rank", rank).
+		Order("search_rank DESC").Order("users.id").
+		Limit(query.Limit).Offset(query.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]UserSearchHit, len(rows))
+	for i, row := range rows {
+		hits[i] = UserSearchHit{User: row.User, Score: row.SearchRank}
+	}
+	return hits, total, nil
+}
+
+// containsEveryTerm matches users with every term in one of the searched fields.
+func containsEveryTerm(terms []string) clause.Expr {
+	conditions := make([]string, len(terms))
+	var vars []interface{}
+	for i, term := range terms {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		conditions[i] = "(lower(name) LIKE ? ESCAPE '!' OR lower(display_name) LIKE ? ESCAPE '!' OR lower(email) LIKE ? ESCAPE '!')"
+		vars = append(vars, pattern, pattern, pattern)
+	}
+	return clause.Expr{SQL: "(" + strings.Join(conditions, " AND ") + ")", Vars: vars}
+}
+
+func likeUserSearch(terms []string) (where, rank clause.Expr) {
+	scores := make([]string, len(terms))
+	var vars []interface{}
+	for i, term := range terms {
+		prefix := likeEscaper.Replace(term) + "%"
+		scores[i] = "CASE WHEN lower(name) LIKE ? ESCAPE '!' OR lower(name) LIKE ? ESCAPE '!' OR lower(display_name) LIKE ? ESCAPE '!' OR lower(email) LIKE ? ESCAPE '!' THEN 2 ELSE 1 END"
+		vars = append(vars, prefix, "% "+prefix, prefix, prefix)
+	}
+	vars = append(vars, strings.Join(terms, " "))
+	rank = clause.Expr{SQL: strings.Join(scores, " + ") + " + CASE WHEN lower(email) = ? THEN 4 ELSE 0 END", Vars: vars}
+	return containsEveryTerm(terms), rank
+}
+
+func postgresUserSearch(terms []string) (where, rank clause.Expr) {
+	text := strings.Join(terms, " ")
+	contains := containsEveryTerm(terms)
+
+	where = clause.Expr{
+		SQL:  "(? OR ? <% lower(name) OR ? <% lower(display_name) OR ? <% lower(email))",
+		Vars: []interface{}{contains, text, text, text},
+	}
+	fullText := clause.Expr{SQL: "0"}
+	if tsquery := prefixTSQuery(terms); tsquery != "" {
+		where = clause.Expr{
+			SQL:  "(" + database.UserSearchDocument + " @@ to_tsquery('simple', ?) OR ?)",
+			Vars: []interface{}{tsquery, where},
+		}
+		fullText = clause.Expr{
+			SQL:  "ts_rank(" + database.UserSearchDocument + ", to_tsquery('simple', ?))",
+			Vars: []interface{}{tsquery},
+		}
+	}
+
+	rank = clause.Expr{
+		SQL: "? + greatest(word_similarity(?, lower(coalesce(name, ''))), word_similarity(?, lower(coalesce(display_name, ''))), word_similarity(?, lower(email)))" +
+			" + CASE WHEN lower(email) = ? THEN 1 ELSE 0 END",
+		Vars: []interface{}{fullText, text, text, text, text},
+	}
+	return where, rank
+}
+
+// prefixTSQuery builds a tsquery matching lexemes that start with every
+// term. Characters with a meaning in tsquery syntax are dropped.
+func prefixTSQuery(terms []string) string {
+	var lexemes []string
+	for _, term := range terms {
+		term = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@.-_", r) {
+				return r
+			}
+			return -1
+		}, term)
+		if term != "" {
+			lexemes = append(lexemes, "'"+term+"':*")
+		}
+	}
+	return strings.Join(lexemes, " & ")
+}
@@ -0,0 +1,68 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+func TestUserSearch(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:user_search?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	users := repository.NewUserRepository(db)
+	ctx := context.Background()
+	for _, user := range []*models.User{
+		{Name: "Ada Lovelace", Email: "ada@example.com"},
+		{Name: "Adam Smith", Email: "adam@example.com", DisplayName: "The Economist"},
+		{Name: "Grace Hopper", Email: "grace@navy.example", DisplayName: "Amazing Grace"},
+		{Name: "Percent 100%", Email: "percent@example.com"},
+		{Email: "erased-1@invalid", Status: models.StatusErased},
+	} {
+		require.NoError(t, users.Create(ctx, user))
+	}
+
+	search := func(text string, limit, offset int) ([]string, int64) {
+		t.Helper()
+		hits, total, err := users.Search(ctx, repository.UserSearchQuery{Text: text, Limit: limit, Offset: offset})
+		require.NoError(t, err)
+		emails := make([]string, len(hits))
+		for i, hit := range hits {
+			emails[i] = hit.User.Email
+		}
+		return emails, total
+	}
+
+	// Every word must match, in any field, and prefixes rank higher.
+	emails, total := search("ADA", 10, 0)
+	require.Equal(t, int64(2), total)
+	require.ElementsMatch(t, []string{"ada@example.com", "adam@example.com"}, emails)
+	emails, _ = search("ada@example.com", 10, 0)
+	require.Equal(t, []string{"ada@example.com"}, emails)
+	emails, _ = search("love ada", 10, 0)
+	require.Equal(t, []string{"ada@example.com"}, emails)
+	emails, _ = search("economist", 10, 0)
+	require.Equal(t, []string{"adam@example.com"}, emails)
+	emails, _ = search("grace", 10, 0)
+	require.Equal(t, []string{"grace@navy.example"}, emails)
+
+	// Wildcards are matched literally.
+	emails, _ = search("0%", 10, 0)
+	require.Equal(t, []string{"percent@example.com"}, emails)
+	emails, _ = search("_", 10, 0)
+	require.Empty(t, emails)
+
+	emails, total = search("example", 1, 1)
+	require.Equal(t, int64(4), total)
+	require.Len(t, emails, 1)
+
+	emails, _ = search("erased", 10, 0)
+	require.Empty(t, emails)
+}
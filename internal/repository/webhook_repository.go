@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// WebhookRepository stores webhook endpoints and their deliveries.
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a new repository instance.
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateEndpoint inserts a new endpoint.
+func (r *WebhookRepository) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	return conn(ctx, r.db).Create(endpoint).Error
+}
+
+// GetEndpoint finds an endpoint by ID.
+func (r *WebhookRepository) GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	if err := conn(ctx, r.db).First(&endpoint, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// ListEndpoints returns all endpoints ordered by creation time.
+func (r *WebhookRepository) ListEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	if err := conn(ctx, r.db).Order("created_at").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// ListActiveEndpoints returns the endpoints that are currently receiving events.
+// Subscriptions are stored as JSON, so callers filter by event type.
+func (r *WebhookRepository) ListActiveEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	if err := conn(ctx, r.db).Where("active = ?", true).Order("created_at").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// UpdateEndpoint saves changes to an endpoint.
+func (r *WebhookRepository) UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	return conn(ctx, r.db).Save(endpoint).Error
+}
+
+// DeleteEndpoint removes an endpoint and its delivery history.
+func (r *WebhookRepository) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.WebhookEndpoint{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// CreateDelivery inserts a new delivery.
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return conn(ctx, r.db).Create(delivery).Error
+}
+
+// GetDelivery finds a delivery by ID.
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := conn(ctx, r.db).First(&delivery, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt.
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return conn(ctx, r.db).Save(delivery).Error
+}
+
+// ListDeliveriesContaining returns the deliveries whose payload contains text.
+func (r *WebhookRepository) ListDeliveriesContaining(ctx context.Context, text string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	if err := conn(ctx, r.db).Where("payload LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(text)+"%").Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ListDeliveries returns an endpoint's deliveries, newest first, and their total number.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	query := conn(ctx, r.db).Model(&models.WebhookDelivery{}).Where("endpoint_id = ?", endpointID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("created_at desc, id desc").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var deliveries []models.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
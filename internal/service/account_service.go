@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// ErrPasswordNotSet is returned when changing the password of an account that signs in only through providers.
+var ErrPasswordNotSet = errors.New("account has no password; sign in with a linked provider")
+
+// ErrOwnStatus is returned when an administrator tries to change their own status.
+var ErrOwnStatus = errors.New("you cannot change the status of your own account")
+
+// userStatuses are the statuses administrators may set. Deactivation is left
+// to the account's owner, since signing in again undoes it.
+var userStatuses = []string{models.StatusActive, models.StatusSuspended, models.StatusPending}
+
+// AccountService implements the self-service operations a user performs on their own account.
+type AccountService struct {
+	users        repository.UserStore
+	identities   repository.IdentityStore
+	sessions     repository.SessionStore
+	loginCodes   repository.LoginCodeStore
+	emailChanges repository.EmailChangeStore
+	tx           repository.Transactor
+	audit        *AuditService
+	bus          *events.Bus
+}
+
+// NewAccountService constructs an AccountService.
+func NewAccountService(users repository.UserStore, identities repository.IdentityStore, sessions repository.SessionStore, loginCodes repository.LoginCodeStore, emailChanges repository.EmailChangeStore, tx repository.Transactor, audit *AuditService, bus *events.Bus) *AccountService {
+	return &AccountService{
+		users:        users,
+		identities:   identities,
+		sessions:     sessions,
+		loginCodes:   loginCodes,
+		emailChanges: emailChanges,
+		tx:           tx,
+		audit:        audit,
+		bus:          bus,
+	}
+}
+
+// Subscribe removes the sessions, linked identities, login codes and pending
+// email change of deleted users, however they were deleted. Otherwise a
+// leftover identity would keep resolving to the missing user, and its
+// provider account could never sign in again.
+func (s *AccountService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, "accounts", func(ctx context.Context, e events.UserDeleted) error {
+		userID := e.User.ID
+		if err := s.endImpersonations(ctx, userID, uuid.Nil, impersonationEndedDeletion); err != nil {
+			return err
+		}
+		if err := s.sessions.DeleteByUser(ctx, userID, uuid.Nil); err != nil {
+			return err
+		}
+		if err := s.identities.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.loginCodes.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+		return s.emailChanges.Delete(ctx, userID)
+	})
+}
+
+// ChangePassword replaces the user's password after verifying the current one.
+// Every session other than currentSession is signed out.
+func (s *AccountService) ChangePassword(ctx context.Context, userID, currentSession uuid.UUID, current, next string) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" {
+		return ErrPasswordNotSet
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(passwordHash)
+
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.users.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := s.endImpersonations(ctx, userID, currentSession, impersonationEndedSignOut); err != nil {
+			return err
+		}
+		if err := s.sessions.DeleteByUser(ctx, userID, currentSession); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditPasswordChanged,
+			ActorID:    userID,
+			TargetType: AuditTargetUser,
+			TargetID:   userID.String(),
+		})
+	})
+}
+
+// Sessions lists the user's active sessions, flagging currentSession.
+func (s *AccountService) Sessions(ctx context.Context, userID, currentSession uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.sessions.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSession
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs out one of the user's sessions. Revoking an
+// impersonation session ends the impersonation.
+func (s *AccountService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		session, err := s.sessions.GetActive(ctx, sessionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := s.sessions.Delete(ctx, userID, sessionID); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, AuditEntry{
+			Action:     AuditSessionRevoked,
+			ActorID:    userID,
+			TargetType: AuditTargetUser,
+			TargetID:   userID.String(),
+			Details:    map[string]interface{}{"session_id": sessionID.String()},
+		}); err != nil {
+			return err
+		}
+		if session == nil {
+			return nil
+		}
+		return recordImpersonationEnded(ctx, s.audit, session, impersonationEndedRevoked)
+	})
+}
+
+// endImpersonations records the end of the user's impersonation sessions
+// other than keep, before they are signed out for reason.
+func (s *AccountService) endImpersonations(ctx context.Context, userID, keep uuid.UUID, reason string) error {
+	sessions, err := s.sessions.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if sessions[i].ID == keep {
+			continue
+		}
+		if err := recordImpersonationEnded(ctx, s.audit, &sessions[i], reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deactivate deactivates the user's own account and signs out all of its
+// sessions. Signing in again reactivates it.
+func (s *AccountService) Deactivate(ctx context.Context, userID uuid.UUID, reason string) error {
+	_, err := s.changeStatus(ctx, userID, models.StatusDeactivated, reason)
+	return err
+}
+
+// SetStatus changes the status of the user userID on behalf of the
+// administrator adminID. Unless the new status is active, all of the user's
+// sessions are signed out.
+func (s *AccountService) SetStatus(ctx context.Context, adminID, userID uuid.UUID, status, reason string) (*models.User, error) {
+	fields := make(map[string]string)
+	if !containsUserStatus(status) {
+		fields["status"] = "must be one of " + strings.Join(userStatuses, ", ")
+	}
+	if msg := maxLength(reason, 500); msg != "" {
+		fields["reason"] = msg
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+	if adminID == userID {
+		return nil, ErrOwnStatus
+	}
+	return s.changeStatus(ctx, userID, status, reason)
+}
+
+func (s *AccountService) changeStatus(ctx context.Context, userID uuid.UUID, status, reason string) (*models.User, error) {
+	var user *models.User
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.users.GetByID(ctx, userID); err != nil {
+			return err
+		}
+		if user.Status == models.StatusErased {
+			return ErrAccountErased
+		}
+		if user.Status == status && user.StatusReason == reason {
+			return nil
+		}
+		if err := setStatus(ctx, s.users, s.bus, user, status, reason); err != nil {
+			return err
+		}
+		if status == models.StatusActive {
+			return nil
+		}
+		if err := s.endImpersonations(ctx, userID, uuid.Nil, impersonationEndedSignOut); err != nil {
+			return err
+		}
+		return s.sessions.DeleteByUser(ctx, userID, uuid.Nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Delete removes the user. Subscribers to events.UserDeleted remove the
+// user's sessions, identities and memberships.
+func (s *AccountService) Delete(ctx context.Context, userID uuid.UUID) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.users.Delete(ctx, userID); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserDeleted{User: user})
+	})
+}
+
+func containsUserStatus(status string) bool {
+	for _, known := range userStatuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
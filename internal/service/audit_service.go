@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/google/uuid"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// Audited actions.
+const (
+	AuditUserRegistered       = "user.registered"
+	AuditUserUpdated          = "user.updated"
+	AuditUserDeleted          = "user.deleted"
+	AuditUserStatusChanged    = "user.status_changed"
+	AuditDataExported         = "user.data_exported"
+	AuditErasureRequested     = "user.erasure_requested"
+	AuditUserErased           = "user.erased"
+	AuditUsersImported        = "users.imported"
+	AuditUsersExported        = "users.exported"
+	AuditPasswordChanged      = "user.password_changed"
+	AuditEmailChangeRequested = "user.email_change_requested"
+	AuditEmailChanged         = "user.email_changed"
+	AuditEmailChangeCancelled = "user.email_change_cancelled"
+	AuditLogin                = "auth.login"
+	AuditLoginFailed          = "auth.login_failed"
+	AuditOAuthLogin           = "auth.oauth_login"
+	AuditLogout               = "auth.logout"
+	AuditSessionRevoked       = "auth.session_revoked"
+	AuditImpersonationStarted = "auth.impersonation_started"
+	AuditImpersonationEnded   = "auth.impersonation_ended"
+	AuditIdentityLinked       = "identity.linked"
+	AuditIdentityUnlinked     = "identity.unlinked"
+	AuditOrganizationCreated  = "organization.created"
+	AuditMemberRoleChanged    = "organization.member_role_changed"
+	AuditMemberRemoved        = "organization.member_removed"
+	AuditInvitationCreated    = "invitation.created"
+	AuditInvitationRevoked    = "invitation.revoked"
+	AuditInvitationAccepted   = "invitation.accepted"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser         = "user"
+	AuditTargetOrganization = "organization"
+)
+
+// auditIgnoredFields are left out of change sets because every update touches them.
+var auditIgnoredFields = map[string]bool{"updated_at": true}
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor returns a context attributing audited actions to the user actorID.
+func WithActor(ctx context.Context, actorID uuid.UUID) context.Context {
+	return context.WithValue(ctx, actorKey{}, actorID)
+}
+
+// WithRequestID returns a context whose audited actions record requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// AuditEntry describes an action to record.
+type AuditEntry struct {
+	Action string
+	// ActorID is the user performing the action. It defaults to the actor
+	// carried by the context; anonymous actions have neither.
+	ActorID    uuid.UUID
+	TargetType string
+	TargetID   string
+	// Before and After are snapshots of the target, as returned by auditSnapshot.
+	// Fields whose values differ are recorded as changes.
+	Before  map[string]interface{}
+	After   map[string]interface{}
+	Details map[string]interface{}
+}
+
+// AuditService records and queries the audit log.
+type AuditService struct {
+	store repository.AuditStore
+}
+
+// NewAuditService constructs an AuditService.
+func NewAuditService(store repository.AuditStore) *AuditService {
+	return &AuditService{store: store}
+}
+
+// Record appends entry to the audit log with the client and request details
+// carried by ctx. Called within a transaction, the event commits or rolls back
+// with the change it describes.
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) error {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+
+	event := &models.AuditEvent{
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IPAddress:  truncate(info.IPAddress, 64),
+		UserAgent:  truncate(info.UserAgent, 512),
+		RequestID:  truncate(requestID, 128),
+		Changes:    auditDiff(entry.Before, entry.After),
+		Details:    entry.Details,
+	}
+	actorID := entry.ActorID
+	if actorID == uuid.Nil {
+		actorID, _ = ctx.Value(actorKey{}).(uuid.UUID)
+	}
+	if actorID != uuid.Nil {
+		event.ActorID = &actorID
+	}
+	return s.store.Create(ctx, event)
+}
+
+// Subscribe records the domain events published on bus. The subscribers run
+// synchronously, so each event is recorded in the transaction of its change.
+func (s *AuditService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserRegistered) error {
+		entry := AuditEntry{
+			Action:     AuditUserRegistered,
+			TargetType: AuditTargetUser,
+			TargetID:   e.User.ID.String(),
+			Details:    map[string]interface{}{"provider": e.Provider},
+		}
+		// Users register themselves unless someone, such as an importing
+		// administrator, is acting.
+		if _, ok := ctx.Value(actorKey{}).(uuid.UUID); !ok {
+			entry.ActorID = e.User.ID
+		}
+		return s.Record(ctx, entry)
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserLoggedIn) error {
+		entry := AuditEntry{Action: AuditLogin, ActorID: e.User.ID, TargetType: AuditTargetUser, TargetID: e.User.ID.String()}
+		if e.Provider != "" {
+			entry.Action, entry.Details = AuditOAuthLogin, map[string]interface{}{"provider": e.Provider}
+		}
+		return s.Record(ctx, entry)
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.LoginFailed) error {
+		entry := AuditEntry{Action: AuditLoginFailed, Details: map[string]interface{}{"email": e.Email}}
+		if e.UserID != uuid.Nil {
+			entry.TargetType, entry.TargetID = AuditTargetUser, e.UserID.String()
+		}
+		return s.Record(ctx, entry)
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserUpdated) error {
+		entry := AuditEntry{
+			Action:     AuditUserUpdated,
+			TargetType: AuditTargetUser,
+			TargetID:   e.User.ID.String(),
+			Before:     auditSnapshot(e.Before),
+			After:      auditSnapshot(e.User),
+		}
+		// Emails change only through a confirmation link, whose holder acts as the user.
+		if e.Before.Email != e.User.Email {
+			entry.Action, entry.ActorID = AuditEmailChanged, e.User.ID
+		}
+		return s.Record(ctx, entry)
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserStatusChanged) error {
+		return s.Record(ctx, AuditEntry{
+			Action:     AuditUserStatusChanged,
+			TargetType: AuditTargetUser,
+			TargetID:   e.User.ID.String(),
+			Details:    map[string]interface{}{"from": e.From, "to": e.User.Status, "reason": e.User.StatusReason},
+		})
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserDeleted) error {
+		return s.Record(ctx, AuditEntry{
+			Action:     AuditUserDeleted,
+			TargetType: AuditTargetUser,
+			TargetID:   e.User.ID.String(),
+			Before:     auditSnapshot(e.User),
+		})
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.UserErased) error {
+		if err := s.store.AnonymizeSubject(ctx, AuditTargetUser, e.User.ID); err != nil {
+			return err
+		}
+		// Failed sign-ins record the address they tried, with or without an
+		// account behind it.
+		if err := s.store.AnonymizeContaining(ctx, jsonString(e.Email)); err != nil {
+			return err
+		}
+		return s.Record(ctx, AuditEntry{
+			Action:     AuditUserErased,
+			ActorID:    e.RequestedBy,
+			TargetType: AuditTargetUser,
+			TargetID:   e.User.ID.String(),
+			Details:    map[string]interface{}{"request_id": e.RequestID.String()},
+		})
+	})
+	events.Subscribe(bus, "audit", func(ctx context.Context, e events.OAuthLinked) error {
+		return s.Record(ctx, AuditEntry{
+			Action:     AuditIdentityLinked,
+			ActorID:    e.UserID,
+			TargetType: AuditTargetUser,
+			TargetID:   e.UserID.String(),
+			Details:    map[string]interface{}{"provider": e.Provider, "subject": e.Subject},
+		})
+	})
+}
+
+// ListBySubject returns the events the user performed or was the target of, oldest first.
+func (s *AuditService) ListBySubject(ctx context.Context, userID uuid.UUID) ([]models.AuditEvent, error) {
+	return s.store.ListBySubject(ctx, AuditTargetUser, userID)
+}
+
+// List returns the events matching filter, newest first, and the total number of matches.
+func (s *AuditService) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEvent, int64, error) {
+	return s.store.List(ctx, filter)
+}
+
+// auditSnapshot returns the JSON representation of v as a map, which leaves
+// out fields hidden from the API such as password hashes.
+func auditSnapshot(v interface{}) map[string]interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(encoded, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// auditDiff returns the fields whose values differ between before and after.
+func auditDiff(before, after map[string]interface{}) map[string]models.AuditChange {
+	changes := make(map[string]models.AuditChange)
+	for key, from := range before {
+		if to := after[key]; !auditIgnoredFields[key] && !reflect.DeepEqual(from, to) {
+			changes[key] = models.AuditChange{From: from, To: to}
+		}
+	}
+	for key, to := range after {
+		if _, ok := before[key]; !ok && !auditIgnoredFields[key] {
+			changes[key] = models.AuditChange{From: nil, To: to}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+)
+
+// AuthStats counts committed sign-ups and sign-in attempts since start-up.
+type AuthStats struct {
+	Registrations uint64 `json:"registrations"`
+	Logins        uint64 `json:"logins"`
+	LoginFailures uint64 `json:"login_failures"`
+}
+
+// AuthMetrics counts authentication events for the metrics endpoint. Its
+// subscribers are asynchronous, so counting never slows a request and
+// changes that roll back are not counted.
+type AuthMetrics struct {
+	registrations atomic.Uint64
+	logins        atomic.Uint64
+	loginFailures atomic.Uint64
+}
+
+// NewAuthMetrics constructs an AuthMetrics with zero counts.
+func NewAuthMetrics() *AuthMetrics {
+	return &AuthMetrics{}
+}
+
+// Subscribe counts the authentication events published on bus.
+func (m *AuthMetrics) Subscribe(bus *events.Bus) {
+	events.SubscribeAsync(bus, "metrics", func(context.Context, events.UserRegistered) error {
+		m.registrations.Add(1)
+		return nil
+	})
+	events.SubscribeAsync(bus, "metrics", func(context.Context, events.UserLoggedIn) error {
+		m.logins.Add(1)
+		return nil
+	})
+	events.SubscribeAsync(bus, "metrics", func(context.Context, events.LoginFailed) error {
+		m.loginFailures.Add(1)
+		return nil
+	})
+}
+
+// Stats returns the current counts.
+func (m *AuthMetrics) Stats() AuthStats {
+	return AuthStats{
+		Registrations: m.registrations.Load(),
+		Logins:        m.logins.Load(),
+		LoginFailures: m.loginFailures.Load(),
+	}
+}
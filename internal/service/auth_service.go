@@ -2,44 +2,183 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/events"
 	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
 	"github.com/example/golang-rest-boilerplate/internal/repository"
 )
 
 // ErrInvalidCredentials represents invalid login attempts.
 var ErrInvalidCredentials = errors.New("invalid credentials")
 
+// ErrInvalidLoginCode is returned when a login code is unknown, expired or already used.
+var ErrInvalidLoginCode = errors.New("invalid or expired login code")
+
+// loginCodeTTL bounds how long a browser client has to exchange a login code.
+const loginCodeTTL = time.Minute
+
+// ErrIdentityConflict is returned when an OAuth sign-in matches an existing account
+// by an unverified email.
+var ErrIdentityConflict = errors.New("an account with this email already exists; sign in and link the provider instead")
+
+// ErrSessionRevoked is returned for tokens whose session has ended or been revoked.
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// ErrAccountSuspended is returned when a suspended user signs in or uses a token.
+var ErrAccountSuspended = errors.New("account is suspended")
+
+// ErrAccountDeactivated is returned when a deactivated user uses a token
+// issued before the deactivation.
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// ErrAccountPending is returned when a user whose account awaits activation
+// signs in or uses a token.
+var ErrAccountPending = errors.New("account is pending activation")
+
+// ErrAccountErased is returned for accounts whose personal data has been erased.
+var ErrAccountErased = errors.New("account has been erased")
+
+// IsAccountStatusError reports whether err rejects a sign-in, token or change
+// because of the account's status.
+func IsAccountStatusError(err error) bool {
+	return errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountDeactivated) ||
+		errors.Is(err, ErrAccountPending) || errors.Is(err, ErrAccountErased)
+}
+
+// ErrImpersonationNotAllowed is returned when an administrator tries to
+// impersonate themselves or another administrator.
+var ErrImpersonationNotAllowed = errors.New("this user cannot be impersonated")
+
+// Reasons recorded when an impersonation ends.
+const (
+	impersonationEndedLogout   = "logout"
+	impersonationEndedRevoked  = "revoked"
+	impersonationEndedExpired  = "expired"
+	impersonationEndedSignOut  = "signed_out"
+	impersonationEndedDeletion = "user_deleted"
+	impersonationEndedErasure  = "user_erased"
+)
+
+// TokenIssuer issues and validates access tokens.
+type TokenIssuer interface {
+	GenerateToken(ctx context.Context, user *models.User) (string, error)
+	ParseToken(ctx context.Context, tokenString string) (*Claims, error)
+}
+
+var _ TokenIssuer = (*AuthService)(nil)
+
+// Authenticator exposes sign-up, sign-in and token operations to the HTTP layer.
+type Authenticator interface {
+	TokenIssuer
+	Register(ctx context.Context, name, email, password string) (*models.User, error)
+	Login(ctx context.Context, email, password string) (string, *models.User, error)
+	FindOrCreateOAuthUser(ctx context.Context, identity *oauth.Identity) (*models.User, error)
+	IssueLoginCode(ctx context.Context, user *models.User) (string, error)
+	ExchangeLoginCode(ctx context.Context, code string) (string, *models.User, error)
+	SwitchOrganization(ctx context.Context, claims *Claims, ref string) (string, *models.Membership, error)
+	RevokeToken(ctx context.Context, tokenString string) error
+}
+
+var _ Authenticator = (*AuthService)(nil)
+
 // AuthService handles authentication-related operations.
 type AuthService struct {
-	repo              *repository.UserRepository
+	repo              repository.UserStore
+	identities        repository.IdentityStore
+	loginCodes        repository.LoginCodeStore
+	sessions          repository.SessionStore
+	orgs              repository.OrganizationStore
+	tx                repository.Transactor
+	audit             *AuditService
+	bus               *events.Bus
 	jwtSecret         []byte
 	jwtIssuer         string
 	tokenExpirePeriod time.Duration
+	impersonationTTL  time.Duration
 }
 
-// Claims represents JWT claims structure.
+// Claims represents JWT claims structure. The registered ID claim holds the
+// session ID; OrgID is the active organization, if the user belongs to any.
+// Act is set on tokens an administrator obtained by impersonating the user.
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Name   string `json:"name"`
+	OrgID  string `json:"org_id,omitempty"`
+	Act    *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the RFC 8693 actor claim, naming the party acting on behalf of the
+// token's subject.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// SessionID returns the session the token was issued for.
+func (c *Claims) SessionID() uuid.UUID {
+	id, _ := uuid.Parse(c.ID)
+	return id
+}
+
+// Impersonated reports whether the token was issued to an administrator
+// impersonating its user.
+func (c *Claims) Impersonated() bool {
+	return c.Act != nil
+}
+
+// ImpersonatorID returns the administrator impersonating the token's user, or
+// uuid.Nil if the token is not impersonated.
+func (c *Claims) ImpersonatorID() uuid.UUID {
+	if c.Act == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(c.Act.Subject)
+	return id
+}
+
+type clientInfoKey struct{}
+
+// ClientInfo describes the device a request was made from.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// WithClientInfo returns a context carrying info, which is recorded on sessions started with it.
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
 // NewAuthService creates a new AuthService.
-func NewAuthService(repo *repository.UserRepository, cfg *config.Config) *AuthService {
+func NewAuthService(repo repository.UserStore, identities repository.IdentityStore, loginCodes repository.LoginCodeStore, sessions repository.SessionStore, orgs repository.OrganizationStore, tx repository.Transactor, audit *AuditService, bus *events.Bus, cfg *config.Config) *AuthService {
 	return &AuthService{
 		repo:              repo,
+		identities:        identities,
+		loginCodes:        loginCodes,
+		sessions:          sessions,
+		orgs:              orgs,
+		tx:                tx,
+		audit:             audit,
+		bus:               bus,
 		jwtSecret:         []byte(cfg.JWTSecret),
 		jwtIssuer:         cfg.JWTIssuer,
 		tokenExpirePeriod: time.Duration(cfg.TokenExpireMinutes) * time.Minute,
+		impersonationTTL:  time.Duration(cfg.ImpersonationTTLMinutes) * time.Minute,
 	}
 }
 
@@ -52,90 +191,368 @@ func (s *AuthService) Register(ctx context.Context, name, email, password string
 
 	user := &models.User{
 		Name:         name,
-		Email:        email,
+		Email:        models.NormalizeEmail(email),
 		PasswordHash: string(passwordHash),
 		Provider:     "local",
 	}
 
-	if err := s.repo.Create(ctx, user); err != nil {
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Accounts stored before addresses were normalized differ only in case
+		// and slip past the unique index.
+		if _, err := s.repo.GetByEmail(ctx, user.Email); err == nil {
+			return ErrEmailTaken
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := s.repo.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserRegistered{User: user, Provider: user.Provider})
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// Login authenticates a user using email and password.
+// Login authenticates a user using email and password. Successful and failed
+// attempts are both published.
 func (s *AuthService) Login(ctx context.Context, email, password string) (string, *models.User, error) {
 	user, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil, ErrInvalidCredentials
+			return "", nil, s.loginFailed(ctx, email, nil)
 		}
 		return "", nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", nil, ErrInvalidCredentials
+		return "", nil, s.loginFailed(ctx, email, user)
+	}
+	if err := s.admit(ctx, user); err != nil {
+		return "", nil, err
 	}
 
-	token, err := s.GenerateToken(user)
+	token, err := s.GenerateToken(ctx, user)
 	if err != nil {
 		return "", nil, err
 	}
+	if err := s.bus.Publish(ctx, events.UserLoggedIn{User: user}); err != nil {
+		return "", nil, err
+	}
 
 	return token, user, nil
 }
 
-// FindOrCreateOAuthUser creates a user account based on OAuth provider information.
-func (s *AuthService) FindOrCreateOAuthUser(ctx context.Context, name, email, provider, providerID string) (*models.User, error) {
-	user, err := s.repo.GetByEmail(ctx, email)
-	if err == nil {
-		// existing user, update provider info if empty
-		if user.Provider == "" {
-			user.Provider = provider
-			user.ProviderID = providerID
-			if err := s.repo.Update(ctx, user); err != nil {
-				return nil, err
+// loginFailed publishes a failed login for email, which may not belong to any
+// user, and returns ErrInvalidCredentials.
+func (s *AuthService) loginFailed(ctx context.Context, email string, user *models.User) error {
+	event := events.LoginFailed{Email: models.NormalizeEmail(email)}
+	if user != nil {
+		event.UserID = user.ID
+	}
+	if err := s.bus.Publish(ctx, event); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// FindOrCreateOAuthUser resolves the user linked to an external identity,
+// linking or creating an account on first sign-in. The user and identity are
+// written and the resulting events published in a single transaction.
+func (s *AuthService) FindOrCreateOAuthUser(ctx context.Context, identity *oauth.Identity) (*models.User, error) {
+	var user *models.User
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		linked, err := s.identities.GetByProviderSubject(ctx, identity.Provider, identity.Subject)
+		if err == nil {
+			if user, err = s.repo.GetByID(ctx, linked.UserID); err != nil {
+				return err
+			}
+			if err := s.admit(ctx, user); err != nil {
+				return err
 			}
+			return s.bus.Publish(ctx, events.UserLoggedIn{User: user, Provider: identity.Provider})
 		}
-		return user, nil
-	}
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		user, err = s.repo.GetByEmail(ctx, identity.Email)
+		switch {
+		case err == nil:
+			// Only link to an existing account by a verified email; otherwise anyone
+			// able to claim the address at a provider could take the account over.
+			if !identity.EmailVerified {
+				return ErrIdentityConflict
+			}
+			if err := ensureProviderUnlinked(ctx, s.identities, user.ID, identity.Provider); err != nil {
+				return err
+			}
+			if err := s.admit(ctx, user); err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = &models.User{
+				Name:       identity.Name,
+				Email:      models.NormalizeEmail(identity.Email),
+				Provider:   identity.Provider,
+				ProviderID: identity.Subject,
+			}
+			if err := s.repo.Create(ctx, user); err != nil {
+				return err
+			}
+			if err := s.bus.Publish(ctx, events.UserRegistered{User: user, Provider: identity.Provider}); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if err := s.identities.Create(ctx, &models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}); err != nil {
+			return err
+		}
+		if err := s.bus.Publish(ctx, events.OAuthLinked{UserID: user.ID, Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email}); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserLoggedIn{User: user, Provider: identity.Provider})
+	})
+	if err != nil {
 		return nil, err
 	}
+	return user, nil
+}
+
+// admit checks that user may sign in, reactivating a deactivated account. It
+// returns the error for the account's status otherwise.
+func (s *AuthService) admit(ctx context.Context, user *models.User) error {
+	if user.Status != models.StatusDeactivated {
+		return statusError(user)
+	}
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		// The user reactivates their own account by signing in.
+		return setStatus(WithActor(ctx, user.ID), s.repo, s.bus, user, models.StatusActive, "")
+	})
+}
 
-	user = &models.User{
-		Name:       name,
-		Email:      email,
-		Provider:   provider,
-		ProviderID: providerID,
+// statusError returns the error reported for tokens and sign-ins of user, or
+// nil if the account is active.
+func statusError(user *models.User) error {
+	switch user.Status {
+	case models.StatusActive:
+		return nil
+	case models.StatusSuspended:
+		return ErrAccountSuspended
+	case models.StatusDeactivated:
+		return ErrAccountDeactivated
+	case models.StatusErased:
+		return ErrAccountErased
+	default:
+		return ErrAccountPending
 	}
-	if err := s.repo.Create(ctx, user); err != nil {
-		return nil, err
+}
+
+// setStatus changes the user's status and publishes the change.
+func setStatus(ctx context.Context, users repository.UserStore, bus *events.Bus, user *models.User, status, reason string) error {
+	from := user.Status
+	now := time.Now()
+	user.Status, user.StatusReason, user.StatusChangedAt = status, reason, &now
+	if err := users.Update(ctx, user); err != nil {
+		return err
 	}
-	return user, nil
+	return bus.Publish(ctx, events.UserStatusChanged{From: from, User: user})
+}
+
+// IssueLoginCode creates a short-lived, single-use code that can be exchanged
+// for an access token for user.
+func (s *AuthService) IssueLoginCode(ctx context.Context, user *models.User) (string, error) {
+	code, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.loginCodes.Create(ctx, &models.LoginCode{
+		CodeHash:  hashToken(code),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(loginCodeTTL),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeLoginCode redeems a code issued by IssueLoginCode for an access token.
+func (s *AuthService) ExchangeLoginCode(ctx context.Context, code string) (string, *models.User, error) {
+	loginCode, err := s.loginCodes.Consume(ctx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, ErrInvalidLoginCode
+		}
+		return "", nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, loginCode.UserID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, err := s.GenerateToken(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, user, nil
+}
+
+// newToken returns a random, URL-safe token for single-use links and codes.
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken returns the form in which single-use tokens are stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-// GenerateToken creates a JWT for the supplied user.
-func (s *AuthService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken starts a session for the supplied user and returns a JWT for it.
+// The device is taken from the ClientInfo carried by ctx, if any, and the
+// active organization is the user's oldest membership.
+func (s *AuthService) GenerateToken(ctx context.Context, user *models.User) (string, error) {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	session := &models.Session{
+		UserID:    user.ID,
+		UserAgent: truncate(info.UserAgent, 512),
+		IPAddress: truncate(info.IPAddress, 64),
+		ExpiresAt: time.Now().Add(s.tokenExpirePeriod),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return "", err
+	}
+	return s.signSession(ctx, user, session)
+}
+
+// Impersonate starts a short-lived session for the user userID on behalf of
+// the administrator adminID and returns a token for it. The token carries an
+// act claim naming the administrator. Administrators cannot be impersonated.
+func (s *AuthService) Impersonate(ctx context.Context, adminID, userID uuid.UUID) (string, *models.User, error) {
+	if adminID == userID {
+		return "", nil, ErrImpersonationNotAllowed
+	}
+
+	var token string
+	var user *models.User
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.repo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user.Role == models.RoleAdmin {
+			return ErrImpersonationNotAllowed
+		}
+		if err := statusError(user); err != nil {
+			return err
+		}
+
+		info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+		session := &models.Session{
+			UserID:         user.ID,
+			ImpersonatorID: &adminID,
+			UserAgent:      truncate(info.UserAgent, 512),
+			IPAddress:      truncate(info.IPAddress, 64),
+			ExpiresAt:      time.Now().Add(s.impersonationTTL),
+		}
+		if err := s.sessions.Create(ctx, session); err != nil {
+			return err
+		}
+		if token, err = s.signSession(ctx, user, session); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditImpersonationStarted,
+			ActorID:    adminID,
+			TargetType: AuditTargetUser,
+			TargetID:   user.ID.String(),
+			Details:    map[string]interface{}{"session_id": session.ID.String(), "expires_at": session.ExpiresAt},
+		})
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, user, nil
+}
+
+// signSession returns a JWT for the user's session.
+func (s *AuthService) signSession(ctx context.Context, user *models.User, session *models.Session) (string, error) {
+	memberships, err := s.orgs.ListMemberships(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
 		UserID: user.ID.String(),
 		Email:  user.Email,
 		Name:   user.Name,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID.String(),
 			Issuer:    s.jwtIssuer,
 			Subject:   user.ID.String(),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.tokenExpirePeriod)),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if len(memberships) > 0 {
+		claims.OrgID = memberships[0].OrganizationID.String()
+	}
+	if session.ImpersonatorID != nil {
+		claims.Act = &Actor{Subject: session.ImpersonatorID.String()}
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.jwtSecret)
 }
 
-// ParseToken validates a JWT and returns its claims.
-func (s *AuthService) ParseToken(tokenString string) (*Claims, error) {
+// SwitchOrganization re-issues the token described by claims with ref, an
+// organization ID or slug, as the active organization. The new token keeps
+// the session and expiry of the old one. It returns gorm.ErrRecordNotFound
+// if the organization does not exist or the user is not a member of it.
+func (s *AuthService) SwitchOrganization(ctx context.Context, claims *Claims, ref string) (string, *models.Membership, error) {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+	org, err := resolveOrganization(ctx, s.orgs, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	membership, err := s.orgs.GetMembership(ctx, org.ID, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switched := *claims
+	switched.OrgID = org.ID.String()
+	switched.IssuedAt = jwt.NewNumericDate(time.Now())
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &switched).SignedString(s.jwtSecret)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, membership, nil
+}
+
+// ParseToken validates a JWT and returns its claims. Tokens whose session has
+// been revoked are rejected with ErrSessionRevoked, and tokens of users who are
+// no longer active with the error for their status.
+func (s *AuthService) ParseToken(ctx context.Context, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return s.jwtSecret, nil
 	})
@@ -143,8 +560,80 @@ func (s *AuthService) ParseToken(tokenString string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidCredentials
+	}
+
+	if _, err := s.sessions.GetActive(ctx, claims.SessionID()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionRevoked
+		}
+		return nil, err
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionRevoked
+		}
+		return nil, err
+	}
+	if err := statusError(user); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RevokeToken ends the session tokenString was issued for. Revoking an
+// impersonated token ends the impersonation.
+func (s *AuthService) RevokeToken(ctx context.Context, tokenString string) error {
+	claims, err := s.ParseToken(ctx, tokenString)
+	if err != nil {
+		return err
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.sessions.Delete(ctx, userID, claims.SessionID()); err != nil {
+			return err
+		}
+		if impersonatorID := claims.ImpersonatorID(); impersonatorID != uuid.Nil {
+			return recordImpersonationEnded(ctx, s.audit, &models.Session{ID: claims.SessionID(), UserID: userID, ImpersonatorID: &impersonatorID}, impersonationEndedLogout)
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditLogout,
+			ActorID:    userID,
+			TargetType: AuditTargetUser,
+			TargetID:   userID.String(),
+			Details:    map[string]interface{}{"session_id": claims.SessionID().String()},
+		})
+	})
+}
+
+// recordImpersonationEnded records the end of the impersonation session for
+// reason. Sessions without an impersonator are ignored.
+func recordImpersonationEnded(ctx context.Context, audit *AuditService, session *models.Session, reason string) error {
+	if session.ImpersonatorID == nil {
+		return nil
+	}
+	return audit.Record(ctx, AuditEntry{
+		Action:     AuditImpersonationEnded,
+		ActorID:    *session.ImpersonatorID,
+		TargetType: AuditTargetUser,
+		TargetID:   session.UserID.String(),
+		Details:    map[string]interface{}{"session_id": session.ID.String(), "reason": reason},
+	})
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
 	}
-	return nil, ErrInvalidCredentials
+	return strings.ToValidUTF8(value[:max], "")
 }
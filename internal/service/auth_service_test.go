@@ -9,23 +9,32 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/example/golang-rest-boilerplate/internal/config"
-	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
 	"github.com/example/golang-rest-boilerplate/internal/repository"
 	"github.com/example/golang-rest-boilerplate/internal/service"
 )
 
-func setupRepository(t *testing.T) *repository.UserRepository {
+func setupAuthService(t *testing.T) (*service.AuthService, *service.IdentityService) {
 	t.Helper()
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	database, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{TranslateError: true})
 	require.NoError(t, err)
-	require.NoError(t, db.AutoMigrate(&models.User{}))
-	return repository.NewUserRepository(db)
+	require.NoError(t, db.Migrate(database))
+
+	repo := repository.NewUserRepository(database)
+	identityRepo := repository.NewIdentityRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	cfg := &config.Config{JWTSecret: "secret", JWTIssuer: "test", TokenExpireMinutes: 60}
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	authService := service.NewAuthService(repo, identityRepo, repository.NewLoginCodeRepository(database), repository.NewSessionRepository(database), repository.NewOrganizationRepository(database), transactor, audit, bus, cfg)
+	return authService, service.NewIdentityService(repo, identityRepo, transactor, audit, bus)
 }
 
 func TestRegisterAndLogin(t *testing.T) {
-	repo := setupRepository(t)
-	cfg := &config.Config{JWTSecret: "secret", JWTIssuer: "test", TokenExpireMinutes: 60}
-	authService := service.NewAuthService(repo, cfg)
+	authService, _ := setupAuthService(t)
 
 	user, err := authService.Register(context.Background(), "Alice", "alice@example.com", "Password123")
 	require.NoError(t, err)
@@ -37,7 +46,161 @@ func TestRegisterAndLogin(t *testing.T) {
 	require.NotEmpty(t, token)
 	require.Equal(t, user.Email, loggedInUser.Email)
 
-	claims, err := authService.ParseToken(token)
+	claims, err := authService.ParseToken(context.Background(), token)
 	require.NoError(t, err)
 	require.Equal(t, user.Email, claims.Email)
+
+	require.NoError(t, authService.RevokeToken(context.Background(), token))
+	_, err = authService.ParseToken(context.Background(), token)
+	require.ErrorIs(t, err, service.ErrSessionRevoked)
+}
+
+func TestFindOrCreateOAuthUser(t *testing.T) {
+	authService, identityService := setupAuthService(t)
+	ctx := context.Background()
+
+	identity := &oauth.Identity{Provider: "github", Subject: "42", Email: "bob@example.com", EmailVerified: true, Name: "Bob"}
+	user, err := authService.FindOrCreateOAuthUser(ctx, identity)
+	require.NoError(t, err)
+
+	// Provider addresses are stored lower-cased.
+	gus, err := authService.FindOrCreateOAuthUser(ctx, &oauth.Identity{Provider: "github", Subject: "gh-gus", Email: "Gus@Example.com", EmailVerified: true})
+	require.NoError(t, err)
+	require.Equal(t, "gus@example.com", gus.Email)
+
+	// A changed email at the provider must still resolve to the same user.
+	identity.Email = "bob@work.example.com"
+	again, err := authService.FindOrCreateOAuthUser(ctx, identity)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, again.ID)
+
+	// An unverified email must not be linked to an existing account.
+	_, err = authService.FindOrCreateOAuthUser(ctx, &oauth.Identity{Provider: "gitlab", Subject: "7", Email: "bob@example.com"})
+	require.ErrorIs(t, err, service.ErrIdentityConflict)
+
+	require.ErrorIs(t, identityService.Unlink(ctx, user.ID, "github"), service.ErrLastLoginMethod)
+}
+
+func TestLinkIdentity(t *testing.T) {
+	authService, identityService := setupAuthService(t)
+	ctx := context.Background()
+	user, err := authService.Register(ctx, "Lin", "lin@example.com", "Password123")
+	require.NoError(t, err)
+	other, err := authService.Register(ctx, "Max", "max@example.com", "Password123")
+	require.NoError(t, err)
+
+	linked, err := identityService.Link(ctx, user.ID, &oauth.Identity{Provider: "github", Subject: "1", Email: "lin@example.com"})
+	require.NoError(t, err)
+	again, err := identityService.Link(ctx, user.ID, &oauth.Identity{Provider: "github", Subject: "1", Email: "lin@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, linked.ID, again.ID)
+
+	_, err = identityService.Link(ctx, other.ID, &oauth.Identity{Provider: "github", Subject: "1"})
+	require.ErrorIs(t, err, service.ErrIdentityInUse)
+	_, err = identityService.Link(ctx, user.ID, &oauth.Identity{Provider: "github", Subject: "2", Email: "lin@work.example.com"})
+	require.ErrorIs(t, err, service.ErrProviderAlreadyLinked)
+
+	// Signing in with a second account of the provider does not link it by email either.
+	_, err = authService.FindOrCreateOAuthUser(ctx, &oauth.Identity{Provider: "github", Subject: "3", Email: "lin@example.com", EmailVerified: true})
+	require.ErrorIs(t, err, service.ErrProviderAlreadyLinked)
+}
+
+func TestDeletedUserSignsInAgain(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:deleted_user?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", JWTIssuer: "test", TokenExpireMinutes: 60}
+	userRepo := repository.NewUserRepository(database)
+	identities := repository.NewIdentityRepository(database)
+	loginCodes := repository.NewLoginCodeRepository(database)
+	sessions := repository.NewSessionRepository(database)
+	orgs := repository.NewOrganizationRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	orgService := service.NewOrganizationService(orgs, transactor, audit)
+	orgService.Subscribe(bus)
+	service.NewAccountService(userRepo, identities, sessions, loginCodes, repository.NewEmailChangeRepository(database), transactor, audit, bus).Subscribe(bus)
+	authService := service.NewAuthService(userRepo, identities, loginCodes, sessions, orgs, transactor, audit, bus, cfg)
+	users := service.NewUserService(userRepo, transactor, bus)
+
+	identity := &oauth.Identity{Provider: "google", Subject: "g-1", Email: "gus@example.com", EmailVerified: true, Name: "Gus"}
+	user, err := authService.FindOrCreateOAuthUser(ctx, identity)
+	require.NoError(t, err)
+	token, err := authService.GenerateToken(ctx, user)
+	require.NoError(t, err)
+	_, err = orgService.Create(ctx, user.ID, "Gus Inc", "")
+	require.NoError(t, err)
+
+	require.NoError(t, users.Delete(ctx, user.ID))
+
+	linked, err := identities.ListByUser(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, linked)
+	active, err := sessions.ListActiveByUser(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, active)
+	memberships, err := orgs.ListMemberships(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, memberships)
+	_, err = authService.ParseToken(ctx, token)
+	require.ErrorIs(t, err, service.ErrSessionRevoked)
+
+	// The provider account signs up afresh instead of resolving to the deleted user.
+	again, err := authService.FindOrCreateOAuthUser(ctx, identity)
+	require.NoError(t, err)
+	require.NotEqual(t, user.ID, again.ID)
+	require.Equal(t, "gus@example.com", again.Email)
+}
+
+func TestMixedCaseEmail(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:mixed_case_email?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", JWTIssuer: "test", TokenExpireMinutes: 60}
+	users := repository.NewUserRepository(database)
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	authService := service.NewAuthService(users, repository.NewIdentityRepository(database), repository.NewLoginCodeRepository(database), repository.NewSessionRepository(database), repository.NewOrganizationRepository(database), repository.NewGormTransactor(database), audit, bus, cfg)
+
+	// Accounts stored before addresses were normalized keep their case.
+	ada, err := authService.Register(ctx, "Ada", "ada@example.com", "Password123")
+	require.NoError(t, err)
+	ada.Email = "Ada@Example.com"
+	require.NoError(t, users.Update(ctx, ada))
+
+	_, user, err := authService.Login(ctx, "ADA@example.com", "Password123")
+	require.NoError(t, err)
+	require.Equal(t, ada.ID, user.ID)
+	_, err = authService.Register(ctx, "Ada Again", "ada@EXAMPLE.com", "Password123")
+	require.ErrorIs(t, err, service.ErrEmailTaken)
+
+	bob, err := authService.Register(ctx, "Bob", " Bob@Example.com ", "Password123")
+	require.NoError(t, err)
+	require.Equal(t, "bob@example.com", bob.Email)
+}
+
+func TestLoginCodeIsSingleUse(t *testing.T) {
+	authService, _ := setupAuthService(t)
+	ctx := context.Background()
+
+	user, err := authService.Register(ctx, "Carol", "carol@example.com", "Password123")
+	require.NoError(t, err)
+
+	code, err := authService.IssueLoginCode(ctx, user)
+	require.NoError(t, err)
+
+	token, exchanged, err := authService.ExchangeLoginCode(ctx, code)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.Equal(t, user.ID, exchanged.ID)
+
+	_, _, err = authService.ExchangeLoginCode(ctx, code)
+	require.ErrorIs(t, err, service.ErrInvalidLoginCode)
 }
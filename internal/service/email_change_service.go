@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// ErrEmailTaken is returned when an address being registered or confirmed
+// belongs to another account.
+var ErrEmailTaken = errors.New("email address is already in use")
+
+// ErrEmailUnchanged is returned when the requested address is the current one.
+var ErrEmailUnchanged = errors.New("new email matches the current email")
+
+// ErrInvalidEmailChangeToken is returned when an email change token is unknown, expired or stale.
+var ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+
+// emailChangeTTL bounds how long a requested email change can be confirmed.
+const emailChangeTTL = 24 * time.Hour
+
+// EmailChangeService changes a user's email address once the new address is confirmed.
+type EmailChangeService struct {
+	users     repository.UserStore
+	changes   repository.EmailChangeStore
+	tx        repository.Transactor
+	mailer    mailer.Mailer
+	templates *mailer.Templates
+	audit     *AuditService
+	bus       *events.Bus
+	appURL    string
+}
+
+// NewEmailChangeService constructs an EmailChangeService. Links in emails point at APP_URL.
+func NewEmailChangeService(users repository.UserStore, changes repository.EmailChangeStore, tx repository.Transactor, m mailer.Mailer, templates *mailer.Templates, audit *AuditService, bus *events.Bus, cfg *config.Config) *EmailChangeService {
+	return &EmailChangeService{
+		users:     users,
+		changes:   changes,
+		tx:        tx,
+		mailer:    m,
+		templates: templates,
+		audit:     audit,
+		bus:       bus,
+		appURL:    strings.TrimSuffix(cfg.AppURL, "/"),
+	}
+}
+
+// Request starts changing the user's email to newEmail. A confirmation link is
+// sent to newEmail and a notice with a cancel link to the current address.
+// Requests for an address that belongs to another account succeed without
+// sending anything, so they do not reveal which addresses are registered.
+// Accounts with a password must supply it. A later request replaces an earlier one.
+func (s *EmailChangeService) Request(ctx context.Context, userID uuid.UUID, newEmail, password string) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return ErrInvalidCredentials
+		}
+	}
+
+	newEmail = models.NormalizeEmail(newEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	if _, err := s.users.GetByEmail(ctx, newEmail); err == nil {
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	confirmToken, err := newToken()
+	if err != nil {
+		return err
+	}
+	cancelToken, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.changes.Replace(ctx, &models.EmailChange{
+			UserID:           user.ID,
+			OldEmail:         user.Email,
+			NewEmail:         newEmail,
+			ConfirmTokenHash: hashToken(confirmToken),
+			CancelTokenHash:  hashToken(cancelToken),
+			ExpiresAt:        time.Now().Add(emailChangeTTL),
+		}); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditEmailChangeRequested,
+			ActorID:    user.ID,
+			TargetType: AuditTargetUser,
+			TargetID:   user.ID.String(),
+			Details:    map[string]interface{}{"new_email": newEmail},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	confirm, err := s.templates.Render(newEmail, user.Locale, "email_change_confirm", map[string]interface{}{
+		"NewEmail":       newEmail,
+		"ConfirmURL":     s.link("/email-change/confirm", confirmToken),
+		"ExpiresInHours": int(emailChangeTTL.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+	notice, err := s.templates.Render(user.Email, user.Locale, "email_change_notice", map[string]interface{}{
+		"NewEmail":  newEmail,
+		"CancelURL": s.link("/email-change/cancel", cancelToken),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(ctx, confirm); err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, notice)
+}
+
+// Confirm applies the change identified by token and returns the updated user.
+// The unique email index arbitrates races with registrations of the same
+// address, so exactly one of them succeeds. Linked identities are keyed by
+// provider subject rather than email and keep working unchanged.
+func (s *EmailChangeService) Confirm(ctx context.Context, token string) (*models.User, error) {
+	var user *models.User
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		change, err := s.changes.GetByConfirmHash(ctx, hashToken(token))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidEmailChangeToken
+			}
+			return err
+		}
+
+		user, err = s.users.GetByID(ctx, change.UserID)
+		if err != nil {
+			return err
+		}
+		// The address changed some other way since the request was made.
+		if user.Email != change.OldEmail {
+			return ErrInvalidEmailChangeToken
+		}
+
+		if other, err := s.users.GetByEmail(ctx, change.NewEmail); err == nil && other.ID != user.ID {
+			return ErrEmailTaken
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		before := *user
+		user.Email = change.NewEmail
+		if err := s.users.Update(ctx, user); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+		if err := s.changes.Delete(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserUpdated{Before: &before, User: user})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Cancel discards the change identified by a cancel token.
+func (s *EmailChangeService) Cancel(ctx context.Context, token string) error {
+	change, err := s.changes.GetByCancelHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidEmailChangeToken
+		}
+		return err
+	}
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.changes.Delete(ctx, change.UserID); err != nil {
+			return err
+		}
+		// The cancel link is sent to the old address, so its holder acts as the user.
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditEmailChangeCancelled,
+			ActorID:    change.UserID,
+			TargetType: AuditTargetUser,
+			TargetID:   change.UserID.String(),
+			Details:    map[string]interface{}{"new_email": change.NewEmail},
+		})
+	})
+}
+
+func (s *EmailChangeService) link(path, token string) string {
+	return s.appURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
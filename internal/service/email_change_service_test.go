@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+var tokenLink = regexp.MustCompile(`https?://\S+`)
+
+// linkToken returns the token in the link of the last message sent to to.
+func linkToken(t *testing.T, mail *mailer.MemoryMailer, to string) string {
+	t.Helper()
+	msg, ok := mail.Last(to)
+	require.True(t, ok, "no message sent to %s", to)
+	link, err := url.Parse(tokenLink.FindString(msg.Text))
+	require.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func TestEmailChange(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:email_change?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", TokenExpireMinutes: 60, AppURL: "https://app.example.com"}
+	users := repository.NewUserRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	authService := service.NewAuthService(users, repository.NewIdentityRepository(database), repository.NewLoginCodeRepository(database), repository.NewSessionRepository(database), repository.NewOrganizationRepository(database), transactor, audit, bus, cfg)
+	mail := mailer.NewMemoryMailer()
+	templates, err := mailer.NewTemplates()
+	require.NoError(t, err)
+	changes := repository.NewEmailChangeRepository(database)
+	emailChanges := service.NewEmailChangeService(users, changes, transactor, mail, templates, audit, bus, cfg)
+
+	user, err := authService.Register(ctx, "Dana", "dana@example.com", "Password123")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, emailChanges.Request(ctx, user.ID, "dana@new.example.com", "wrong"), service.ErrInvalidCredentials)
+
+	// Cancelling through the link sent to the old address discards the change.
+	require.NoError(t, emailChanges.Request(ctx, user.ID, "dana@new.example.com", "Password123"))
+	require.NoError(t, emailChanges.Cancel(ctx, linkToken(t, mail, "dana@example.com")))
+	_, err = emailChanges.Confirm(ctx, linkToken(t, mail, "dana@new.example.com"))
+	require.ErrorIs(t, err, service.ErrInvalidEmailChangeToken)
+
+	// A taken address is accepted without a trace.
+	cat, err := authService.Register(ctx, "Cat", "cat@example.com", "Password123")
+	require.NoError(t, err)
+	require.NoError(t, emailChanges.Request(ctx, user.ID, "CAT@Example.com", "Password123"))
+	_, sent := mail.Last(cat.Email)
+	require.False(t, sent)
+	_, err = changes.GetByUser(ctx, user.ID)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// An address registered while the change is pending wins the race, even
+	// when it was stored before addresses were normalized.
+	require.NoError(t, emailChanges.Request(ctx, user.ID, " Dana@New.Example.com", "Password123"))
+	confirm := linkToken(t, mail, "dana@new.example.com")
+	squatter, err := authService.Register(ctx, "Eve", "dana@new.example.com", "Password123")
+	require.NoError(t, err)
+	squatter.Email = "Dana@New.Example.com"
+	require.NoError(t, users.Update(ctx, squatter))
+	_, err = emailChanges.Confirm(ctx, confirm)
+	require.ErrorIs(t, err, service.ErrEmailTaken)
+	require.NoError(t, users.Delete(ctx, squatter.ID))
+
+	changed, err := emailChanges.Confirm(ctx, confirm)
+	require.NoError(t, err)
+	require.Equal(t, "dana@new.example.com", changed.Email)
+
+	_, _, err = authService.Login(ctx, "dana@new.example.com", "Password123")
+	require.NoError(t, err)
+	_, err = emailChanges.Confirm(ctx, confirm)
+	require.ErrorIs(t, err, service.ErrInvalidEmailChangeToken)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// ErrIdentityInUse is returned when a provider account is already linked to another user.
+var ErrIdentityInUse = errors.New("this provider account is linked to another user")
+
+// ErrProviderAlreadyLinked is returned when linking a second account of a
+// provider the user has already linked.
+var ErrProviderAlreadyLinked = errors.New("an account of this provider is already linked; unlink it first")
+
+// ErrLastLoginMethod is returned when unlinking would leave a user unable to sign in.
+var ErrLastLoginMethod = errors.New("cannot remove the last login method")
+
+// IdentityLinker manages a user's linked identities for the HTTP layer.
+type IdentityLinker interface {
+	List(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error)
+	Link(ctx context.Context, userID uuid.UUID, identity *oauth.Identity) (*models.UserIdentity, error)
+	Unlink(ctx context.Context, userID uuid.UUID, provider string) error
+}
+
+var _ IdentityLinker = (*IdentityService)(nil)
+
+// IdentityService manages the external identities linked to users.
+type IdentityService struct {
+	users      repository.UserStore
+	identities repository.IdentityStore
+	tx         repository.Transactor
+	audit      *AuditService
+	bus        *events.Bus
+}
+
+// NewIdentityService constructs a new IdentityService.
+func NewIdentityService(users repository.UserStore, identities repository.IdentityStore, tx repository.Transactor, audit *AuditService, bus *events.Bus) *IdentityService {
+	return &IdentityService{users: users, identities: identities, tx: tx, audit: audit, bus: bus}
+}
+
+// List returns the identities linked to a user.
+func (s *IdentityService) List(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	return s.identities.ListByUser(ctx, userID)
+}
+
+// Link attaches an external identity to a user. A user links at most one
+// account per provider.
+func (s *IdentityService) Link(ctx context.Context, userID uuid.UUID, identity *oauth.Identity) (*models.UserIdentity, error) {
+	existing, err := s.identities.GetByProviderSubject(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityInUse
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	linked := &models.UserIdentity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := ensureProviderUnlinked(ctx, s.identities, userID, identity.Provider); err != nil {
+			return err
+		}
+		if err := s.identities.Create(ctx, linked); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.OAuthLinked{UserID: userID, Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return linked, nil
+}
+
+// Unlink removes the identity a user has linked for provider, refusing to
+// remove the only remaining way to sign in. The user row stays locked until
+// the identity is gone, so concurrent unlinks cannot both pass the check.
+func (s *IdentityService) Unlink(ctx context.Context, userID uuid.UUID, provider string) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.GetByIDForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		identities, err := s.identities.ListByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		remaining := 0
+		for _, identity := range identities {
+			if identity.Provider != provider {
+				remaining++
+			}
+		}
+		if remaining == len(identities) {
+			return gorm.ErrRecordNotFound
+		}
+		if remaining == 0 && user.PasswordHash == "" {
+			return ErrLastLoginMethod
+		}
+
+		if err := s.identities.DeleteByUserProvider(ctx, userID, provider); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditIdentityUnlinked,
+			ActorID:    userID,
+			TargetType: AuditTargetUser,
+			TargetID:   userID.String(),
+			Details:    map[string]interface{}{"provider": provider},
+		})
+	})
+}
+
+// ensureProviderUnlinked returns ErrProviderAlreadyLinked if the user has an
+// identity of provider.
+func ensureProviderUnlinked(ctx context.Context, identities repository.IdentityStore, userID uuid.UUID, provider string) error {
+	_, err := identities.GetByUserProvider(ctx, userID, provider)
+	switch {
+	case err == nil:
+		return ErrProviderAlreadyLinked
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// ErrInvitationNotFound is returned for unknown invitation tokens.
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+// ErrInvitationExpired is returned when an invitation is used after it expired.
+var ErrInvitationExpired = errors.New("invitation has expired; ask for a new one")
+
+// ErrInvitationAccepted is returned when an invitation is used a second time.
+var ErrInvitationAccepted = errors.New("invitation has already been accepted")
+
+// ErrInvitationRevoked is returned when a revoked invitation is used.
+var ErrInvitationRevoked = errors.New("invitation has been revoked")
+
+// ErrInvitationPending is returned when inviting an address that already has a pending invitation.
+var ErrInvitationPending = errors.New("this email already has a pending invitation; resend it instead")
+
+// ErrInvitationEmailMismatch is returned when an invitation is accepted by an
+// account with a different email address.
+var ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+
+// ErrInvitationAccountExists is returned when registering through an invitation
+// for an address that already has an account.
+var ErrInvitationAccountExists = errors.New("an account with this email already exists; sign in to accept the invitation")
+
+// ErrAlreadyMember is returned when inviting or adding an existing member.
+var ErrAlreadyMember = errors.New("user is already a member of this organization")
+
+// InvitationAcceptor looks up and accepts invitations for the HTTP layer.
+type InvitationAcceptor interface {
+	Get(ctx context.Context, token string) (*models.Invitation, error)
+	AcceptWithPassword(ctx context.Context, token, name, password string) (*models.User, *models.Membership, error)
+	AcceptAsUser(ctx context.Context, token string, userID uuid.UUID) (*models.Membership, error)
+	AcceptWithIdentity(ctx context.Context, token string, identity *oauth.Identity) (*models.User, *models.Membership, error)
+}
+
+var _ InvitationAcceptor = (*InvitationService)(nil)
+
+// InvitationService invites people to organizations by email. The invited
+// role is granted when the invitation is accepted.
+type InvitationService struct {
+	invitations repository.InvitationStore
+	orgs        repository.OrganizationStore
+	users       repository.UserStore
+	auth        *AuthService
+	tx          repository.Transactor
+	mailer      mailer.Mailer
+	templates   *mailer.Templates
+	audit       *AuditService
+	ttl         time.Duration
+	appURL      string
+}
+
+// NewInvitationService constructs an InvitationService. Links in emails point at APP_URL.
+func NewInvitationService(invitations repository.InvitationStore, orgs repository.OrganizationStore, users repository.UserStore, auth *AuthService, tx repository.Transactor, m mailer.Mailer, templates *mailer.Templates, audit *AuditService, cfg *config.Config) *InvitationService {
+	return &InvitationService{
+		invitations: invitations,
+		orgs:        orgs,
+		users:       users,
+		auth:        auth,
+		tx:          tx,
+		mailer:      m,
+		templates:   templates,
+		audit:       audit,
+		ttl:         time.Duration(cfg.InvitationTTLHours) * time.Hour,
+		appURL:      strings.TrimSuffix(cfg.AppURL, "/"),
+	}
+}
+
+// Subscribe removes the email addresses of erased users from the invitations
+// sent to them.
+func (s *InvitationService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, "invitations", func(ctx context.Context, e events.UserErased) error {
+		return s.invitations.AnonymizeEmail(ctx, e.Email, e.User.Email)
+	})
+}
+
+// Create invites email to actor's organization with role and emails the
+// invitation link. Admins may not invite owners.
+func (s *InvitationService) Create(ctx context.Context, actor *models.Membership, email, role string) (*models.Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !(&models.Membership{Role: role}).HasRole(orgRoles...) {
+		return nil, &ValidationError{Fields: map[string]string{"role": "must be one of " + strings.Join(orgRoles, ", ")}}
+	}
+	if !canManageMember(actor, role) {
+		return nil, ErrOrganizationRole
+	}
+
+	// Scoped to the organization, the lookup only finds existing members.
+	if _, err := s.users.GetByEmail(repository.WithTenant(ctx, actor.OrganizationID), email); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		OrganizationID: actor.OrganizationID,
+		Email:          email,
+		Role:           role,
+		InvitedBy:      actor.UserID,
+	}
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.invitations.GetPending(ctx, actor.OrganizationID, email); err == nil {
+			return ErrInvitationPending
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		token, err := s.issue(invitation)
+		if err != nil {
+			return err
+		}
+		if err := s.invitations.Create(ctx, invitation); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, AuditEntry{
+			Action:     AuditInvitationCreated,
+			TargetType: AuditTargetOrganization,
+			TargetID:   actor.OrganizationID.String(),
+			Details:    map[string]interface{}{"invitation_id": invitation.ID.String(), "email": email, "role": role},
+		}); err != nil {
+			return err
+		}
+		return s.send(ctx, actor, invitation, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// List returns the organization's invitations, newest first.
+func (s *InvitationService) List(ctx context.Context, orgID uuid.UUID) ([]models.Invitation, error) {
+	return s.invitations.List(ctx, orgID)
+}
+
+// Revoke withdraws one of actor's organization's invitations so it can no
+// longer be accepted. Revoking a revoked invitation does nothing.
+func (s *InvitationService) Revoke(ctx context.Context, actor *models.Membership, id uuid.UUID) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		invitation, err := s.invitations.GetByID(ctx, actor.OrganizationID, id)
+		if err != nil {
+			return err
+		}
+		switch invitation.Status() {
+		case models.InvitationAccepted:
+			return ErrInvitationAccepted
+		case models.InvitationRevoked:
+			return nil
+		}
+		if !canManageMember(actor, invitation.Role) {
+			return ErrOrganizationRole
+		}
+
+		now := time.Now()
+		invitation.RevokedAt = &now
+		if err := s.invitations.Update(ctx, invitation); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditInvitationRevoked,
+			TargetType: AuditTargetOrganization,
+			TargetID:   actor.OrganizationID.String(),
+			Details:    map[string]interface{}{"invitation_id": invitation.ID.String(), "email": invitation.Email},
+		})
+	})
+}
+
+// Resend emails a pending or expired invitation again with a new link and a
+// fresh expiry. Links sent earlier stop working.
+func (s *InvitationService) Resend(ctx context.Context, actor *models.Membership, id uuid.UUID) (*models.Invitation, error) {
+	var invitation *models.Invitation
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		invitation, err = s.invitations.GetByID(ctx, actor.OrganizationID, id)
+		if err != nil {
+			return err
+		}
+		if err := invitationUsable(invitation, true); err != nil {
+			return err
+		}
+		if !canManageMember(actor, invitation.Role) {
+			return ErrOrganizationRole
+		}
+
+		token, err := s.issue(invitation)
+		if err != nil {
+			return err
+		}
+		if err := s.invitations.Update(ctx, invitation); err != nil {
+			return err
+		}
+		return s.send(ctx, actor, invitation, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// Get returns the pending invitation for token, with its organization loaded.
+func (s *InvitationService) Get(ctx context.Context, token string) (*models.Invitation, error) {
+	invitation, err := s.invitations.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	if err := invitationUsable(invitation, false); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// AcceptWithPassword registers a local account for the invited address and
+// accepts the invitation for it.
+func (s *InvitationService) AcceptWithPassword(ctx context.Context, token, name, password string) (*models.User, *models.Membership, error) {
+	var user *models.User
+	var membership *models.Membership
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		invitation, err := s.Get(ctx, token)
+		if err != nil {
+			return err
+		}
+		if _, err := s.users.GetByEmail(ctx, invitation.Email); err == nil {
+			return ErrInvitationAccountExists
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if user, err = s.auth.Register(ctx, name, invitation.Email, password); err != nil {
+			return err
+		}
+		membership, err = s.accept(ctx, invitation, user)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, membership, nil
+}
+
+// AcceptAsUser accepts the invitation for an existing account, which must
+// have the invited email address.
+func (s *InvitationService) AcceptAsUser(ctx context.Context, token string, userID uuid.UUID) (*models.Membership, error) {
+	var membership *models.Membership
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		invitation, err := s.Get(ctx, token)
+		if err != nil {
+			return err
+		}
+		user, err := s.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(user.Email, invitation.Email) {
+			return ErrInvitationEmailMismatch
+		}
+		membership, err = s.accept(ctx, invitation, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// AcceptWithIdentity signs in with an external identity, creating or linking
+// the account as AuthService.FindOrCreateOAuthUser does, and accepts the
+// invitation for it. The provider must have verified the invited address.
+func (s *InvitationService) AcceptWithIdentity(ctx context.Context, token string, identity *oauth.Identity) (*models.User, *models.Membership, error) {
+	var user *models.User
+	var membership *models.Membership
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		invitation, err := s.Get(ctx, token)
+		if err != nil {
+			return err
+		}
+		if !identity.EmailVerified || !strings.EqualFold(identity.Email, invitation.Email) {
+			return ErrInvitationEmailMismatch
+		}
+
+		if user, err = s.auth.FindOrCreateOAuthUser(ctx, identity); err != nil {
+			return err
+		}
+		if !strings.EqualFold(user.Email, invitation.Email) {
+			return ErrInvitationEmailMismatch
+		}
+		membership, err = s.accept(ctx, invitation, user)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, membership, nil
+}
+
+// accept grants user the invited role and marks the invitation accepted.
+func (s *InvitationService) accept(ctx context.Context, invitation *models.Invitation, user *models.User) (*models.Membership, error) {
+	if err := s.invitations.MarkAccepted(ctx, invitation.ID, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationAccepted
+		}
+		return nil, err
+	}
+
+	membership := &models.Membership{OrganizationID: invitation.OrganizationID, UserID: user.ID, Role: invitation.Role}
+	if err := s.orgs.AddMember(ctx, membership); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, err
+	}
+	if err := s.audit.Record(ctx, AuditEntry{
+		Action:     AuditInvitationAccepted,
+		ActorID:    user.ID,
+		TargetType: AuditTargetOrganization,
+		TargetID:   invitation.OrganizationID.String(),
+		Details:    map[string]interface{}{"invitation_id": invitation.ID.String(), "role": invitation.Role},
+	}); err != nil {
+		return nil, err
+	}
+	membership.Organization = invitation.Organization
+	return membership, nil
+}
+
+// issue gives invitation a new token and expiry and returns the token.
+func (s *InvitationService) issue(invitation *models.Invitation) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	invitation.TokenHash = hashToken(token)
+	invitation.ExpiresAt = time.Now().Add(s.ttl)
+	return token, nil
+}
+
+// send emails the invitation link, in the inviter's locale.
+func (s *InvitationService) send(ctx context.Context, actor *models.Membership, invitation *models.Invitation, token string) error {
+	org, err := s.orgs.GetByID(ctx, invitation.OrganizationID)
+	if err != nil {
+		return err
+	}
+	inviter, err := s.users.GetByID(ctx, actor.UserID)
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.templates.Render(invitation.Email, inviter.Locale, "invitation", map[string]interface{}{
+		"InviterName":      inviter.Name,
+		"OrganizationName": org.Name,
+		"Role":             invitation.Role,
+		"AcceptURL":        s.appURL + "/invitations/accept?" + url.Values{"token": {token}}.Encode(),
+		"ExpiresInDays":    int(math.Ceil(s.ttl.Hours() / 24)),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// invitationUsable returns why invitation cannot be used, if it cannot.
+// Expired invitations are usable when allowExpired is set, for resending.
+func invitationUsable(invitation *models.Invitation, allowExpired bool) error {
+	switch invitation.Status() {
+	case models.InvitationAccepted:
+		return ErrInvitationAccepted
+	case models.InvitationRevoked:
+		return ErrInvitationRevoked
+	case models.InvitationExpired:
+		if !allowExpired {
+			return ErrInvitationExpired
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func TestInvitations(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:invitations?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", TokenExpireMinutes: 60, AppURL: "https://app.example.com", InvitationTTLHours: 72}
+	users := repository.NewUserRepository(database)
+	orgs := repository.NewOrganizationRepository(database)
+	invitationRepo := repository.NewInvitationRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	authService := service.NewAuthService(users, repository.NewIdentityRepository(database), repository.NewLoginCodeRepository(database), repository.NewSessionRepository(database), orgs, transactor, audit, bus, cfg)
+	mail := mailer.NewMemoryMailer()
+	templates, err := mailer.NewTemplates()
+	require.NoError(t, err)
+	orgService := service.NewOrganizationService(orgs, transactor, audit)
+	invitations := service.NewInvitationService(invitationRepo, orgs, users, authService, transactor, mail, templates, audit, cfg)
+
+	owner, err := authService.Register(ctx, "Olivia", "olivia@example.com", "Password123")
+	require.NoError(t, err)
+	actor, err := orgService.Create(ctx, owner.ID, "Acme", "")
+	require.NoError(t, err)
+
+	// A new teammate registers through the link and gets the invited role.
+	invitation, err := invitations.Create(ctx, actor, "Pat@Example.com", models.OrgRoleAdmin)
+	require.NoError(t, err)
+	require.Equal(t, "pat@example.com", invitation.Email)
+	_, err = invitations.Create(ctx, actor, "pat@example.com", models.OrgRoleMember)
+	require.ErrorIs(t, err, service.ErrInvitationPending)
+
+	token := linkToken(t, mail, "pat@example.com")
+	pat, membership, err := invitations.AcceptWithPassword(ctx, token, "Pat", "Password123")
+	require.NoError(t, err)
+	require.Equal(t, "pat@example.com", pat.Email)
+	require.Equal(t, models.OrgRoleAdmin, membership.Role)
+	_, _, err = invitations.AcceptWithPassword(ctx, token, "Pat", "Password123")
+	require.ErrorIs(t, err, service.ErrInvitationAccepted)
+	_, err = invitations.Create(ctx, actor, "pat@example.com", models.OrgRoleMember)
+	require.ErrorIs(t, err, service.ErrAlreadyMember)
+
+	// Admins cannot invite owners.
+	_, err = invitations.Create(ctx, membership, "boss@example.com", models.OrgRoleOwner)
+	require.ErrorIs(t, err, service.ErrOrganizationRole)
+
+	// Existing accounts accept while signed in, as the invited address only.
+	robin, err := authService.Register(ctx, "Robin", "robin@example.com", "Password123")
+	require.NoError(t, err)
+	_, err = invitations.Create(ctx, actor, "robin@example.com", models.OrgRoleMember)
+	require.NoError(t, err)
+	token = linkToken(t, mail, "robin@example.com")
+	_, _, err = invitations.AcceptWithPassword(ctx, token, "Robin", "Password123")
+	require.ErrorIs(t, err, service.ErrInvitationAccountExists)
+	_, err = invitations.AcceptAsUser(ctx, token, pat.ID)
+	require.ErrorIs(t, err, service.ErrInvitationEmailMismatch)
+	_, err = invitations.AcceptAsUser(ctx, token, robin.ID)
+	require.NoError(t, err)
+
+	// Provider sign-ins must have verified the invited address.
+	invitation, err = invitations.Create(ctx, actor, "sam@example.com", models.OrgRoleMember)
+	require.NoError(t, err)
+	token = linkToken(t, mail, "sam@example.com")
+	identity := &oauth.Identity{Provider: "google", Subject: "sam-1", Email: "sam@example.com", Name: "Sam"}
+	_, _, err = invitations.AcceptWithIdentity(ctx, token, identity)
+	require.ErrorIs(t, err, service.ErrInvitationEmailMismatch)
+
+	// Expired invitations are rejected until resent, which replaces the link.
+	invitation.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, invitationRepo.Update(ctx, invitation))
+	_, err = invitations.Get(ctx, token)
+	require.ErrorIs(t, err, service.ErrInvitationExpired)
+	_, err = invitations.Resend(ctx, actor, invitation.ID)
+	require.NoError(t, err)
+	_, err = invitations.Get(ctx, token)
+	require.ErrorIs(t, err, service.ErrInvitationNotFound)
+
+	identity.EmailVerified = true
+	sam, membership, err := invitations.AcceptWithIdentity(ctx, linkToken(t, mail, "sam@example.com"), identity)
+	require.NoError(t, err)
+	require.Equal(t, sam.ID, membership.UserID)
+
+	// Revoked invitations cannot be accepted.
+	invitation, err = invitations.Create(ctx, actor, "lee@example.com", models.OrgRoleMember)
+	require.NoError(t, err)
+	require.NoError(t, invitations.Revoke(ctx, actor, invitation.ID))
+	_, _, err = invitations.AcceptWithPassword(ctx, linkToken(t, mail, "lee@example.com"), "Lee", "Password123")
+	require.ErrorIs(t, err, service.ErrInvitationRevoked)
+
+	list, err := invitations.List(ctx, actor.OrganizationID)
+	require.NoError(t, err)
+	require.Len(t, list, 4)
+	require.Equal(t, models.InvitationRevoked, list[0].Status())
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// PurgeExpiredJob is the job type that runs MaintenanceService.PurgeExpired.
+const PurgeExpiredJob = "maintenance.purge_expired"
+
+// MaintenanceService removes data that is no longer needed.
+type MaintenanceService struct {
+	sessions     repository.SessionStore
+	loginCodes   repository.LoginCodeStore
+	emailChanges repository.EmailChangeStore
+	tx           repository.Transactor
+	audit        *AuditService
+}
+
+// NewMaintenanceService constructs a MaintenanceService.
+func NewMaintenanceService(sessions repository.SessionStore, loginCodes repository.LoginCodeStore, emailChanges repository.EmailChangeStore, tx repository.Transactor, audit *AuditService) *MaintenanceService {
+	return &MaintenanceService{sessions: sessions, loginCodes: loginCodes, emailChanges: emailChanges, tx: tx, audit: audit}
+}
+
+// PurgeExpired deletes expired sessions, login codes and pending email changes.
+// It attempts every store and reports all failures.
+func (s *MaintenanceService) PurgeExpired(ctx context.Context) error {
+	return errors.Join(
+		s.endExpiredImpersonations(ctx),
+		s.sessions.DeleteExpired(ctx),
+		s.loginCodes.DeleteExpired(ctx),
+		s.emailChanges.DeleteExpired(ctx),
+	)
+}
+
+// endExpiredImpersonations records the end of each expired impersonation
+// session as it deletes it.
+func (s *MaintenanceService) endExpiredImpersonations(ctx context.Context) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		sessions, err := s.sessions.ListExpiredImpersonations(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range sessions {
+			if err := s.sessions.Delete(ctx, sessions[i].UserID, sessions[i].ID); err != nil {
+				return err
+			}
+			if err := recordImpersonationEnded(ctx, s.audit, &sessions[i], impersonationEndedExpired); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
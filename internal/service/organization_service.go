@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// ErrSlugTaken is returned when an organization slug is already in use.
+var ErrSlugTaken = errors.New("organization slug is already in use")
+
+// ErrLastOwner is returned when a change would leave an organization without an owner.
+var ErrLastOwner = errors.New("an organization must keep at least one owner")
+
+// ErrOrganizationRole is returned when a member's role does not allow a change.
+var ErrOrganizationRole = errors.New("your organization role does not allow this")
+
+// ErrSharedMember is returned when an organization tries to edit the profile
+// of a user who also belongs to other organizations.
+var ErrSharedMember = errors.New("this user also belongs to other organizations; only they can edit their profile")
+
+// orgSlugPattern matches slugs usable as a DNS label, so organizations can be
+// addressed by subdomain.
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var orgRoles = []string{models.OrgRoleOwner, models.OrgRoleAdmin, models.OrgRoleMember}
+
+// TenantResolver resolves the organization a request acts in and the
+// requesting user's membership of it.
+type TenantResolver interface {
+	Resolve(ctx context.Context, ref string) (*models.Organization, error)
+	Membership(ctx context.Context, orgID, userID uuid.UUID) (*models.Membership, error)
+}
+
+var _ TenantResolver = (*OrganizationService)(nil)
+
+// MemberManager lets organization managers act on the accounts of members.
+type MemberManager interface {
+	AuthorizeProfileEdit(ctx context.Context, actor *models.Membership, userID uuid.UUID) error
+	RemoveMember(ctx context.Context, actor *models.Membership, userID uuid.UUID) error
+}
+
+var _ MemberManager = (*OrganizationService)(nil)
+
+// OrganizationService manages organizations and their memberships.
+type OrganizationService struct {
+	orgs  repository.OrganizationStore
+	tx    repository.Transactor
+	audit *AuditService
+}
+
+// NewOrganizationService constructs an OrganizationService.
+func NewOrganizationService(orgs repository.OrganizationStore, tx repository.Transactor, audit *AuditService) *OrganizationService {
+	return &OrganizationService{orgs: orgs, tx: tx, audit: audit}
+}
+
+// Subscribe removes deleted and erased users from their organizations.
+func (s *OrganizationService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, "organizations", func(ctx context.Context, e events.UserDeleted) error {
+		return s.orgs.DeleteMembershipsByUser(ctx, e.User.ID)
+	})
+	events.Subscribe(bus, "organizations", func(ctx context.Context, e events.UserErased) error {
+		return s.orgs.DeleteMembershipsByUser(ctx, e.User.ID)
+	})
+}
+
+// Create creates an organization with userID as its owner and returns the
+// owner's membership. The slug is derived from name when empty.
+func (s *OrganizationService) Create(ctx context.Context, userID uuid.UUID, name, slug string) (*models.Membership, error) {
+	name = strings.TrimSpace(name)
+	if slug == "" {
+		slug = slugify(name)
+	}
+	fields := make(map[string]string)
+	if name == "" {
+		fields["name"] = "is required"
+	} else if msg := maxLength(name, 100); msg != "" {
+		fields["name"] = msg
+	}
+	if !orgSlugPattern.MatchString(slug) {
+		fields["slug"] = "must be 1 to 63 lowercase letters, digits or hyphens, not starting or ending with a hyphen"
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	org := &models.Organization{Name: name, Slug: slug}
+	membership := &models.Membership{UserID: userID, Role: models.OrgRoleOwner}
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.orgs.Create(ctx, org); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrSlugTaken
+			}
+			return err
+		}
+		membership.OrganizationID = org.ID
+		if err := s.orgs.AddMember(ctx, membership); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditOrganizationCreated,
+			ActorID:    userID,
+			TargetType: AuditTargetOrganization,
+			TargetID:   org.ID.String(),
+			Details:    map[string]interface{}{"name": org.Name, "slug": org.Slug},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	membership.Organization = org
+	return membership, nil
+}
+
+// ListForUser returns the user's memberships with their organizations, oldest first.
+func (s *OrganizationService) ListForUser(ctx context.Context, userID uuid.UUID) ([]models.Membership, error) {
+	return s.orgs.ListMemberships(ctx, userID)
+}
+
+// Resolve finds an organization by ID or slug.
+func (s *OrganizationService) Resolve(ctx context.Context, ref string) (*models.Organization, error) {
+	return resolveOrganization(ctx, s.orgs, ref)
+}
+
+// Membership returns the user's membership of the organization.
+func (s *OrganizationService) Membership(ctx context.Context, orgID, userID uuid.UUID) (*models.Membership, error) {
+	return s.orgs.GetMembership(ctx, orgID, userID)
+}
+
+// Members lists the organization's memberships, oldest first.
+func (s *OrganizationService) Members(ctx context.Context, orgID uuid.UUID) ([]models.Membership, error) {
+	return s.orgs.ListMembers(ctx, orgID)
+}
+
+// UpdateMemberRole changes the role of userID in actor's organization. Owners
+// may change any role; admins may only move members between admin and member.
+func (s *OrganizationService) UpdateMemberRole(ctx context.Context, actor *models.Membership, userID uuid.UUID, role string) (*models.Membership, error) {
+	if !(&models.Membership{Role: role}).HasRole(orgRoles...) {
+		return nil, &ValidationError{Fields: map[string]string{"role": "must be one of " + strings.Join(orgRoles, ", ")}}
+	}
+
+	var membership *models.Membership
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		membership, err = s.orgs.GetMembership(ctx, actor.OrganizationID, userID)
+		if err != nil {
+			return err
+		}
+		if !canManageMember(actor, membership.Role) || !canManageMember(actor, role) {
+			return ErrOrganizationRole
+		}
+		if membership.Role == role {
+			return nil
+		}
+		if err := s.keepOwner(ctx, membership); err != nil {
+			return err
+		}
+
+		from := membership.Role
+		membership.Role = role
+		if err := s.orgs.UpdateMembership(ctx, membership); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditMemberRoleChanged,
+			TargetType: AuditTargetOrganization,
+			TargetID:   actor.OrganizationID.String(),
+			Details:    map[string]interface{}{"user_id": userID.String(), "from": from, "to": role},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// RemoveMember removes userID from actor's organization. Any member may leave;
+// removing someone else follows the same rules as UpdateMemberRole.
+func (s *OrganizationService) RemoveMember(ctx context.Context, actor *models.Membership, userID uuid.UUID) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		membership, err := s.orgs.GetMembership(ctx, actor.OrganizationID, userID)
+		if err != nil {
+			return err
+		}
+		if userID != actor.UserID && !canManageMember(actor, membership.Role) {
+			return ErrOrganizationRole
+		}
+		if err := s.keepOwner(ctx, membership); err != nil {
+			return err
+		}
+
+		if err := s.orgs.DeleteMembership(ctx, actor.OrganizationID, userID); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, AuditEntry{
+			Action:     AuditMemberRemoved,
+			TargetType: AuditTargetOrganization,
+			TargetID:   actor.OrganizationID.String(),
+			Details:    map[string]interface{}{"user_id": userID.String(), "role": membership.Role},
+		})
+	})
+}
+
+// AuthorizeProfileEdit reports whether actor may edit the profile of userID.
+// The user must be a member actor may manage, and belong to no other
+// organization, since a profile is shared by all of a user's organizations.
+// Members may always edit their own profile.
+func (s *OrganizationService) AuthorizeProfileEdit(ctx context.Context, actor *models.Membership, userID uuid.UUID) error {
+	if userID == actor.UserID {
+		return nil
+	}
+	membership, err := s.orgs.GetMembership(ctx, actor.OrganizationID, userID)
+	if err != nil {
+		return err
+	}
+	if !canManageMember(actor, membership.Role) {
+		return ErrOrganizationRole
+	}
+	memberships, err := s.orgs.ListMemberships(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(memberships) > 1 {
+		return ErrSharedMember
+	}
+	return nil
+}
+
+// keepOwner returns ErrLastOwner if membership is its organization's only owner.
+func (s *OrganizationService) keepOwner(ctx context.Context, membership *models.Membership) error {
+	if membership.Role != models.OrgRoleOwner {
+		return nil
+	}
+	owners, err := s.orgs.CountMembers(ctx, membership.OrganizationID, models.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// canManageMember reports whether actor may manage a member holding role.
+func canManageMember(actor *models.Membership, role string) bool {
+	switch actor.Role {
+	case models.OrgRoleOwner:
+		return true
+	case models.OrgRoleAdmin:
+		return role != models.OrgRoleOwner
+	default:
+		return false
+	}
+}
+
+// resolveOrganization finds an organization by ID or, failing that, by slug.
+func resolveOrganization(ctx context.Context, orgs repository.OrganizationStore, ref string) (*models.Organization, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return orgs.GetByID(ctx, id)
+	}
+	return orgs.GetBySlug(ctx, strings.ToLower(ref))
+}
+
+// slugify derives a slug from an organization name.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > 63 {
+		slug = slug[:63]
+	}
+	return strings.TrimRight(slug, "-")
+}
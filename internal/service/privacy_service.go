@@ -0,0 +1,319 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// EraseUserJob is the job type that carries out one erasure request.
+const EraseUserJob = "users.erase"
+
+// ErrErasurePending is returned when the user already has an erasure request waiting to run.
+var ErrErasurePending = errors.New("an erasure request for this account is already pending")
+
+type eraseUserJob struct {
+	RequestID uuid.UUID `json:"request_id"`
+}
+
+// PrivacyService exports a user's personal data and erases it on request.
+// Erasure runs as a background job and leaves the users row behind as an
+// anonymized tombstone, so audit events and other references to the ID stay
+// valid.
+type PrivacyService struct {
+	users        repository.UserStore
+	identities   repository.IdentityStore
+	sessions     repository.SessionStore
+	loginCodes   repository.LoginCodeStore
+	emailChanges repository.EmailChangeStore
+	orgs         repository.OrganizationStore
+	erasures     repository.ErasureStore
+	queue        *jobs.Queue
+	tx           repository.Transactor
+	audit        *AuditService
+	bus          *events.Bus
+}
+
+// NewPrivacyService constructs a PrivacyService.
+func NewPrivacyService(users repository.UserStore, identities repository.IdentityStore, sessions repository.SessionStore, loginCodes repository.LoginCodeStore, emailChanges repository.EmailChangeStore, orgs repository.OrganizationStore, erasures repository.ErasureStore, queue *jobs.Queue, tx repository.Transactor, audit *AuditService, bus *events.Bus) *PrivacyService {
+	return &PrivacyService{
+		users:        users,
+		identities:   identities,
+		sessions:     sessions,
+		loginCodes:   loginCodes,
+		emailChanges: emailChanges,
+		orgs:         orgs,
+		erasures:     erasures,
+		queue:        queue,
+		tx:           tx,
+		audit:        audit,
+		bus:          bus,
+	}
+}
+
+// DataExport is everything the service holds about one user.
+type DataExport struct {
+	ExportedAt         time.Time             `json:"exported_at"`
+	Profile            *models.User          `json:"profile"`
+	Identities         []models.UserIdentity `json:"identities"`
+	Sessions           []models.Session      `json:"sessions"`
+	Memberships        []models.Membership   `json:"memberships"`
+	PendingEmailChange *PendingEmailChange   `json:"pending_email_change,omitempty"`
+	AuditEvents        []models.AuditEvent   `json:"audit_events"`
+}
+
+// PendingEmailChange is the exported part of an unconfirmed email change.
+type PendingEmailChange struct {
+	NewEmail  string    `json:"new_email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WriteZip writes the export as a zip archive with one JSON file per section.
+func (e *DataExport) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	sections := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"identities.json", e.Identities},
+		{"sessions.json", e.Sessions},
+		{"memberships.json", e.Memberships},
+		{"pending_email_change.json", e.PendingEmailChange},
+		{"audit_events.json", e.AuditEvents},
+	}
+	for _, section := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: section.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.value); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Export collects the user's personal data and records that it was exported.
+func (s *PrivacyService) Export(ctx context.Context, userID uuid.UUID) (*DataExport, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &DataExport{ExportedAt: time.Now().UTC(), Profile: user}
+	if export.Identities, err = s.identities.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Sessions, err = s.sessions.ListActiveByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Memberships, err = s.orgs.ListMemberships(ctx, userID); err != nil {
+		return nil, err
+	}
+	change, err := s.emailChanges.GetByUser(ctx, userID)
+	switch {
+	case err == nil:
+		export.PendingEmailChange = &PendingEmailChange{NewEmail: change.NewEmail, ExpiresAt: change.ExpiresAt}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	if export.AuditEvents, err = s.audit.ListBySubject(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	err = s.audit.Record(ctx, AuditEntry{
+		Action:     AuditDataExported,
+		ActorID:    userID,
+		TargetType: AuditTargetUser,
+		TargetID:   userID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// RequestOwnErasure queues the erasure of the user's own account. Accounts
+// with a password must confirm it.
+func (s *PrivacyService) RequestOwnErasure(ctx context.Context, userID uuid.UUID, password string) (*models.ErasureRequest, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return nil, ErrInvalidCredentials
+		}
+	}
+	return s.RequestErasure(ctx, userID, userID)
+}
+
+// RequestErasure queues the erasure of the user's personal data on behalf of
+// requestedBy. The account keeps working until the job runs.
+func (s *PrivacyService) RequestErasure(ctx context.Context, requestedBy, userID uuid.UUID) (*models.ErasureRequest, error) {
+	request := &models.ErasureRequest{UserID: userID, RequestedBy: requestedBy, Status: models.ErasurePending}
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user.Status == models.StatusErased {
+			return ErrAccountErased
+		}
+		if _, err := s.erasures.GetPendingByUser(ctx, userID); err == nil {
+			return ErrErasurePending
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := s.erasures.Create(ctx, request); err != nil {
+			return err
+		}
+		err = s.audit.Record(ctx, AuditEntry{
+			Action:     AuditErasureRequested,
+			ActorID:    requestedBy,
+			TargetType: AuditTargetUser,
+			TargetID:   userID.String(),
+			Details:    map[string]interface{}{"request_id": request.ID.String()},
+		})
+		if err != nil {
+			return err
+		}
+		return s.queue.Enqueue(ctx, EraseUserJob, eraseUserJob{RequestID: request.ID}, jobs.UniqueKey("erase:"+request.ID.String()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Erasure returns one erasure request.
+func (s *PrivacyService) Erasure(ctx context.Context, id uuid.UUID) (*models.ErasureRequest, error) {
+	return s.erasures.Get(ctx, id)
+}
+
+// Erasures returns a page of erasure requests, newest first, and the total number of requests.
+func (s *PrivacyService) Erasures(ctx context.Context, limit, offset int) ([]models.ErasureRequest, int64, error) {
+	return s.erasures.List(ctx, limit, offset)
+}
+
+// RegisterJobs makes runner carry out queued erasures.
+func (s *PrivacyService) RegisterJobs(runner *jobs.Runner) {
+	jobs.Handle(runner, EraseUserJob, func(ctx context.Context, job eraseUserJob) error {
+		return s.Erase(ctx, job.RequestID)
+	})
+}
+
+// Erase carries out an erasure request. The user's sessions, identities,
+// login codes, pending email change and the jobs holding their address are
+// deleted and the users row is replaced by a tombstone; subscribers to
+// events.UserErased erase the rest.
+// Completed requests are skipped, so the job can safely run again.
+func (s *PrivacyService) Erase(ctx context.Context, requestID uuid.UUID) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		request, err := s.erasures.Get(ctx, requestID)
+		if err != nil {
+			return err
+		}
+		if request.Status == models.ErasureCompleted {
+			return nil
+		}
+
+		user, err := s.users.GetByID(ctx, request.UserID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// The account was deleted outright in the meantime.
+			return s.completeErasure(ctx, request)
+		case err != nil:
+			return err
+		}
+
+		if err := s.endImpersonations(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.sessions.DeleteByUser(ctx, user.ID, uuid.Nil); err != nil {
+			return err
+		}
+		if err := s.identities.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.loginCodes.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.emailChanges.Delete(ctx, user.ID); err != nil {
+			return err
+		}
+		// Queued mail holds the address and the message, and dead-lettered
+		// jobs are never pruned.
+		if err := s.queue.DeleteContaining(ctx, jsonString(user.Email)); err != nil {
+			return err
+		}
+
+		email := user.Email
+		now := time.Now().UTC()
+		tombstone := &models.User{
+			ID:              user.ID,
+			Email:           "erased-" + user.ID.String() + "@invalid",
+			Role:            models.RoleUser,
+			Status:          models.StatusErased,
+			StatusChangedAt: &now,
+			CreatedAt:       user.CreatedAt,
+		}
+		if err := s.users.Update(ctx, tombstone); err != nil {
+			return err
+		}
+
+		err = s.bus.Publish(ctx, events.UserErased{
+			User:        tombstone,
+			Email:       email,
+			RequestID:   request.ID,
+			RequestedBy: request.RequestedBy,
+		})
+		if err != nil {
+			return err
+		}
+		return s.completeErasure(ctx, request)
+	})
+}
+
+// jsonString returns s quoted as a JSON string, the way job payloads and audit
+// details hold it. Matching the quotes keeps an address from matching the
+// longer addresses ending in it.
+func jsonString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+func (s *PrivacyService) completeErasure(ctx context.Context, request *models.ErasureRequest) error {
+	now := time.Now().UTC()
+	request.Status = models.ErasureCompleted
+	request.CompletedAt = &now
+	return s.erasures.Update(ctx, request)
+}
+
+func (s *PrivacyService) endImpersonations(ctx context.Context, userID uuid.UUID) error {
+	sessions, err := s.sessions.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := recordImpersonationEnded(ctx, s.audit, &sessions[i], impersonationEndedErasure); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/mailer"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func TestPrivacyExportAndErasure(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:privacy?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", TokenExpireMinutes: 60}
+	users := repository.NewUserRepository(database)
+	identities := repository.NewIdentityRepository(database)
+	loginCodes := repository.NewLoginCodeRepository(database)
+	sessions := repository.NewSessionRepository(database)
+	orgs := repository.NewOrganizationRepository(database)
+	auditRepo := repository.NewAuditRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	audit := service.NewAuditService(auditRepo)
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	orgService := service.NewOrganizationService(orgs, transactor, audit)
+	orgService.Subscribe(bus)
+	authService := service.NewAuthService(users, identities, loginCodes, sessions, orgs, transactor, audit, bus, cfg)
+	queue := jobs.NewQueue(repository.NewJobRepository(database))
+	privacy := service.NewPrivacyService(users, identities, sessions, loginCodes, repository.NewEmailChangeRepository(database), orgs, repository.NewErasureRepository(database), queue, transactor, audit, bus)
+
+	// A failed sign-in before the account exists has no user to target.
+	_, _, err = authService.Login(ctx, "Erin@Example.com", "Password123")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	user, err := authService.Register(ctx, "Erin", "erin@example.com", "Password123")
+	require.NoError(t, err)
+	_, err = orgService.Create(ctx, user.ID, "Erin's Team", "")
+	require.NoError(t, err)
+	token, _, err := authService.Login(ctx, "erin@example.com", "Password123")
+	require.NoError(t, err)
+	mail := mailer.NewQueued(queue, 1)
+	require.NoError(t, mail.Send(ctx, mailer.Message{To: "erin@example.com", Subject: "Hello"}))
+	require.NoError(t, mail.Send(ctx, mailer.Message{To: "karin@example.com", Subject: "Hello"}))
+
+	export, err := privacy.Export(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "erin@example.com", export.Profile.Email)
+	require.Len(t, export.Sessions, 1)
+	require.Len(t, export.Memberships, 1)
+	require.NotEmpty(t, export.AuditEvents)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteZip(&buf))
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 6)
+
+	// Erasure must be confirmed with the password and is requested once.
+	_, err = privacy.RequestOwnErasure(ctx, user.ID, "wrong")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	request, err := privacy.RequestOwnErasure(ctx, user.ID, "Password123")
+	require.NoError(t, err)
+	require.Equal(t, models.ErasurePending, request.Status)
+	_, err = privacy.RequestErasure(ctx, user.ID, user.ID)
+	require.ErrorIs(t, err, service.ErrErasurePending)
+
+	require.NoError(t, privacy.Erase(ctx, request.ID))
+	require.NoError(t, privacy.Erase(ctx, request.ID))
+
+	request, err = privacy.Erasure(ctx, request.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.ErasureCompleted, request.Status)
+	require.NotNil(t, request.CompletedAt)
+
+	// The account is an anonymized tombstone that can no longer sign in.
+	tombstone, err := users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.StatusErased, tombstone.Status)
+	require.Equal(t, "erased-"+user.ID.String()+"@invalid", tombstone.Email)
+	require.Empty(t, tombstone.Name)
+	require.Empty(t, tombstone.PasswordHash)
+	_, err = authService.ParseToken(ctx, token)
+	require.Error(t, err)
+	_, _, err = authService.Login(ctx, "erin@example.com", "Password123")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	memberships, err := orgs.ListMemberships(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, memberships)
+	_, err = privacy.RequestErasure(ctx, user.ID, user.ID)
+	require.ErrorIs(t, err, service.ErrAccountErased)
+
+	// Audit events keep their actions but lose the personal data.
+	auditEvents, err := audit.ListBySubject(ctx, user.ID)
+	require.NoError(t, err)
+	var erased bool
+	for _, event := range auditEvents {
+		if event.Action == service.AuditUserErased {
+			erased = true
+			continue
+		}
+		require.Empty(t, event.IPAddress, event.Action)
+		if event.TargetType == service.AuditTargetUser {
+			require.Nil(t, event.Details, event.Action)
+			require.Nil(t, event.Changes, event.Action)
+		}
+	}
+	require.True(t, erased)
+	var failed models.AuditEvent
+	require.NoError(t, database.Order("created_at").First(&failed, "action = ?", service.AuditLoginFailed).Error)
+	require.Nil(t, failed.Details)
+
+	// Jobs holding the address are deleted.
+	var payloads []string
+	require.NoError(t, database.Model(&models.Job{}).Where("type = ?", mailer.SendJob).Pluck("payload", &payloads).Error)
+	require.Len(t, payloads, 1)
+	require.Contains(t, payloads[0], "karin@example.com")
+}
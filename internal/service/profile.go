@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+)
+
+// ErrInvalidPatch is returned when a merge patch document is not a JSON object.
+var ErrInvalidPatch = errors.New("patch must be a JSON object")
+
+const maxMetadataBytes = 4096
+
+// ValidationError reports why individual fields were rejected, keyed by JSON field name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string { return "validation failed" }
+
+// profileFields maps the string profile fields a user may change to their model field.
+var profileFields = map[string]func(*models.User) *string{
+	"name":         func(u *models.User) *string { return &u.Name },
+	"display_name": func(u *models.User) *string { return &u.DisplayName },
+	"avatar_url":   func(u *models.User) *string { return &u.AvatarURL },
+	"locale":       func(u *models.User) *string { return &u.Locale },
+	"timezone":     func(u *models.User) *string { return &u.Timezone },
+}
+
+// protectedFields are user attributes that cannot be changed through a profile update.
+var protectedFields = map[string]bool{
+	"id":          true,
+	"email":       true,
+	"password":    true,
+	"provider":    true,
+	"provider_id": true,
+	"role":        true,
+	"created_at":  true,
+	"updated_at":  true,
+}
+
+// applyProfilePatch applies a JSON Merge Patch (RFC 7396) to user's profile.
+// Only fields present in patch are validated, so existing data that predates
+// a rule does not block unrelated changes.
+func applyProfilePatch(user *models.User, patch []byte) error {
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return ErrInvalidPatch
+	}
+
+	fields := make(map[string]string)
+	for key, raw := range changes {
+		switch {
+		case protectedFields[key]:
+			fields[key] = "field cannot be changed"
+		case key == "metadata":
+			if msg := patchMetadata(user, raw); msg != "" {
+				fields[key] = msg
+			}
+		case profileFields[key] != nil:
+			var value *string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				fields[key] = "must be a string or null"
+				continue
+			}
+			field := profileFields[key](user)
+			*field = ""
+			if value != nil {
+				*field = *value
+			}
+			if msg := validateProfileField(key, field); msg != "" {
+				fields[key] = msg
+			}
+		default:
+			fields[key] = "unknown field"
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// patchMetadata merges raw into the user's metadata and returns a validation
+// message when the result is unacceptable.
+func patchMetadata(user *models.User, raw json.RawMessage) string {
+	var patch interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return "must be valid JSON"
+	}
+	if patch == nil {
+		user.Metadata = nil
+		return ""
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return "must be an object or null"
+	}
+
+	merged := mergePatch(map[string]interface{}(user.Metadata), patch).(map[string]interface{})
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return "must be valid JSON"
+	}
+	if len(encoded) > maxMetadataBytes {
+		return fmt.Sprintf("must be at most %d bytes when encoded", maxMetadataBytes)
+	}
+	user.Metadata = merged
+	return ""
+}
+
+// mergePatch returns target with patch applied as described in RFC 7396.
+// target is never modified.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, _ := target.(map[string]interface{})
+	merged := make(map[string]interface{}, len(targetObj)+len(patchObj))
+	for k, v := range targetObj {
+		merged[k] = v
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergePatch(merged[k], v)
+	}
+	return merged
+}
+
+// validateProfileField checks a single profile field, normalizing it where a
+// canonical form exists, and returns an empty string when it is valid.
+func validateProfileField(key string, value *string) string {
+	switch key {
+	case "name":
+		if *value == "" {
+			return "is required"
+		}
+		return maxLength(*value, 100)
+	case "display_name":
+		return maxLength(*value, 100)
+	case "avatar_url":
+		if *value == "" {
+			return ""
+		}
+		if msg := maxLength(*value, 2048); msg != "" {
+			return msg
+		}
+		u, err := url.Parse(*value)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return "must be an absolute http or https URL"
+		}
+	case "locale":
+		if *value == "" {
+			return ""
+		}
+		tag, err := language.Parse(*value)
+		if err != nil {
+			return "must be a BCP 47 language tag"
+		}
+		*value = tag.String()
+	case "timezone":
+		if *value == "" {
+			return ""
+		}
+		if _, err := time.LoadLocation(*value); err != nil || *value == "Local" {
+			return "must be an IANA time zone name"
+		}
+	}
+	return ""
+}
+
+func maxLength(value string, max int) string {
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Sprintf("must be at most %d characters", max)
+	}
+	return ""
+}
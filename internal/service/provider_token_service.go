@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/pkg/sealer"
+)
+
+// ErrNoProviderToken is returned when no usable token is stored for a linked identity.
+var ErrNoProviderToken = errors.New("no provider token stored; the user must sign in with the provider again")
+
+// ErrProviderGrantRevoked is returned when the provider rejects the stored refresh token.
+var ErrProviderGrantRevoked = errors.New("provider access was revoked; the user must sign in with the provider again")
+
+// ProviderTokenService stores upstream OAuth tokens and hands out authorized clients.
+type ProviderTokenService struct {
+	identities repository.IdentityStore
+	providers  *oauth.Registry
+	sealer     *sealer.Sealer
+}
+
+// NewProviderTokenService constructs a ProviderTokenService. Tokens are encrypted
+// with TOKEN_ENCRYPTION_KEY, falling back to the JWT secret when unset.
+func NewProviderTokenService(identities repository.IdentityStore, providers *oauth.Registry, cfg *config.Config) (*ProviderTokenService, error) {
+	key := cfg.TokenEncryptionKey
+	if key == "" {
+		key = cfg.JWTSecret
+	}
+	s, err := sealer.New(key, "provider-token")
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderTokenService{identities: identities, providers: providers, sealer: s}, nil
+}
+
+// Save stores token against the identity the user has linked for provider.
+// Providers only return a refresh token on first consent, so an existing
+// refresh token is kept when token does not carry a new one.
+func (s *ProviderTokenService) Save(ctx context.Context, userID uuid.UUID, provider string, token *oauth2.Token) error {
+	identity, err := s.identities.GetByUserProvider(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+	return s.store(ctx, identity, token)
+}
+
+// Client returns an HTTP client authorized as the user at provider. The access
+// token is refreshed as needed and refreshed tokens are persisted.
+func (s *ProviderTokenService) Client(ctx context.Context, userID uuid.UUID, provider string) (*http.Client, error) {
+	p, err := s.providers.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identities.GetByUserProvider(ctx, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.decrypt(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client outlives the request that built it, so refreshed tokens are
+	// stored even after that request's context is cancelled.
+	storeCtx := context.WithoutCancel(ctx)
+	src := &persistingTokenSource{
+		src:  p.TokenSource(ctx, token),
+		last: token.AccessToken,
+		save: func(t *oauth2.Token) error { return s.store(storeCtx, identity, t) },
+		revoke: func() error {
+			return s.clear(storeCtx, identity)
+		},
+	}
+
+	// Resolve a valid token up front so revoked grants surface here rather
+	// than on the caller's first request.
+	if _, err := src.Token(); err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, src), nil
+}
+
+func (s *ProviderTokenService) store(ctx context.Context, identity *models.UserIdentity, token *oauth2.Token) error {
+	access, err := s.sealer.Seal([]byte(token.AccessToken))
+	if err != nil {
+		return err
+	}
+	identity.EncryptedAccessToken = access
+
+	if token.RefreshToken != "" {
+		refresh, err := s.sealer.Seal([]byte(token.RefreshToken))
+		if err != nil {
+			return err
+		}
+		identity.EncryptedRefreshToken = refresh
+	}
+
+	identity.TokenExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		identity.TokenExpiresAt = &expiry
+	}
+
+	return s.identities.Update(ctx, identity)
+}
+
+func (s *ProviderTokenService) clear(ctx context.Context, identity *models.UserIdentity) error {
+	identity.EncryptedAccessToken = ""
+	identity.EncryptedRefreshToken = ""
+	identity.TokenExpiresAt = nil
+	return s.identities.Update(ctx, identity)
+}
+
+func (s *ProviderTokenService) decrypt(identity *models.UserIdentity) (*oauth2.Token, error) {
+	if identity.EncryptedAccessToken == "" && identity.EncryptedRefreshToken == "" {
+		return nil, ErrNoProviderToken
+	}
+
+	token := &oauth2.Token{TokenType: "Bearer"}
+	if identity.EncryptedAccessToken != "" {
+		access, err := s.sealer.Open(identity.EncryptedAccessToken)
+		if err != nil {
+			return nil, err
+		}
+		token.AccessToken = string(access)
+	}
+	if identity.EncryptedRefreshToken != "" {
+		refresh, err := s.sealer.Open(identity.EncryptedRefreshToken)
+		if err != nil {
+			return nil, err
+		}
+		token.RefreshToken = string(refresh)
+	}
+	if identity.TokenExpiresAt != nil {
+		token.Expiry = *identity.TokenExpiresAt
+	} else if token.RefreshToken != "" {
+		// Without a known expiry, force a refresh rather than trust a stale token.
+		token.Expiry = time.Unix(1, 0)
+	}
+	return token, nil
+}
+
+// persistingTokenSource saves refreshed tokens and clears revoked grants.
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	src    oauth2.TokenSource
+	last   string
+	save   func(*oauth2.Token) error
+	revoke func() error
+}
+
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token, err := p.src.Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			if revokeErr := p.revoke(); revokeErr != nil {
+				return nil, revokeErr
+			}
+			return nil, ErrProviderGrantRevoked
+		}
+		return nil, err
+	}
+
+	if token.AccessToken != p.last {
+		if err := p.save(token); err != nil {
+			return nil, err
+		}
+		p.last = token.AccessToken
+	}
+	return token, nil
+}
@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/oauth"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func TestProviderTokens(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:provider_tokens?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, database.AutoMigrate(&models.User{}, &models.UserIdentity{}))
+	users := repository.NewUserRepository(database)
+	identities := repository.NewIdentityRepository(database)
+	ctx := context.Background()
+
+	// linkedUser creates a user who signed in with the custom provider.
+	linkedUser := func(t *testing.T, name string) *models.User {
+		t.Helper()
+		user := &models.User{Name: name, Email: strings.ToLower(name) + "@example.com"}
+		require.NoError(t, users.Create(ctx, user))
+		require.NoError(t, identities.Create(ctx, &models.UserIdentity{UserID: user.ID, Provider: "custom", Subject: strings.ToLower(name)}))
+		return user
+	}
+
+	var refreshes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			atomic.AddInt32(&refreshes, 1)
+			w.Header().Set("Content-Type", "application/json")
+			if r.PostForm.Get("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-2", "token_type": "Bearer", "expires_in": 3600})
+		case "/api":
+			_, _ = io.WriteString(w, r.Header.Get("Authorization"))
+		}
+	}))
+	defer server.Close()
+
+	providers := oauth.NewRegistry()
+	providers.Register(oauth.NewOIDCProvider(oauth.OIDCConfig{Name: "custom", ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: server.URL + "/token"}}))
+	tokens, err := service.NewProviderTokenService(identities, providers, &config.Config{JWTSecret: "secret"})
+	require.NoError(t, err)
+
+	// call makes an API request with the user's client and returns the authorization it sent.
+	call := func(t *testing.T, client *http.Client) string {
+		t.Helper()
+		resp, err := client.Get(server.URL + "/api")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("tokens are stored encrypted", func(t *testing.T) {
+		user := linkedUser(t, "Ann")
+		_, err = tokens.Client(ctx, user.ID, "custom")
+		require.ErrorIs(t, err, service.ErrNoProviderToken)
+
+		require.NoError(t, tokens.Save(ctx, user.ID, "custom", &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(time.Hour)}))
+		identity, err := identities.GetByUserProvider(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.NotEmpty(t, identity.EncryptedAccessToken)
+		require.NotContains(t, identity.EncryptedAccessToken, "access-1")
+		require.NotContains(t, identity.EncryptedRefreshToken, "refresh-1")
+
+		client, err := tokens.Client(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.Equal(t, "Bearer access-1", call(t, client))
+	})
+
+	t.Run("expired token is refreshed and persisted", func(t *testing.T) {
+		user := linkedUser(t, "Ben")
+		require.NoError(t, tokens.Save(ctx, user.ID, "custom", &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(-time.Minute)}))
+		atomic.StoreInt32(&refreshes, 0)
+
+		client, err := tokens.Client(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.Equal(t, "Bearer access-2", call(t, client))
+		require.EqualValues(t, 1, atomic.LoadInt32(&refreshes))
+
+		identity, err := identities.GetByUserProvider(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.NotNil(t, identity.TokenExpiresAt)
+		require.WithinDuration(t, time.Now().Add(time.Hour), *identity.TokenExpiresAt, time.Minute)
+		require.NotEmpty(t, identity.EncryptedRefreshToken, "the refresh token is kept when none is returned")
+
+		// The persisted token is used without refreshing again.
+		client, err = tokens.Client(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.Equal(t, "Bearer access-2", call(t, client))
+		require.EqualValues(t, 1, atomic.LoadInt32(&refreshes))
+	})
+
+	t.Run("revoked grant clears the stored tokens", func(t *testing.T) {
+		user := linkedUser(t, "Cy")
+		require.NoError(t, tokens.Save(ctx, user.ID, "custom", &oauth2.Token{AccessToken: "access-1", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute)}))
+
+		_, err = tokens.Client(ctx, user.ID, "custom")
+		require.ErrorIs(t, err, service.ErrProviderGrantRevoked)
+
+		identity, err := identities.GetByUserProvider(ctx, user.ID, "custom")
+		require.NoError(t, err)
+		require.Empty(t, identity.EncryptedAccessToken)
+		require.Empty(t, identity.EncryptedRefreshToken)
+		require.Nil(t, identity.TokenExpiresAt)
+		_, err = tokens.Client(ctx, user.ID, "custom")
+		require.ErrorIs(t, err, service.ErrNoProviderToken)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := tokens.Client(ctx, linkedUser(t, "Dee").ID, "google")
+		require.ErrorIs(t, err, oauth.ErrUnknownProvider)
+	})
+}
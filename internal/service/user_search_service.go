@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// Limits of a user search query, in characters.
+const (
+	minSearchLength = 2
+	maxSearchLength = 100
+)
+
+// UserSearchResult is a user matching a search. Highlights hold the searched
+// fields that contain a word of the query, HTML-escaped, with each
+// occurrence wrapped in <mark> tags.
+type UserSearchResult struct {
+	User       models.User       `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// UserSearchService finds users by partial name, display name or email. The
+// matching and ranking is left to a repository.UserSearcher, so another
+// search engine can replace the database.
+type UserSearchService struct {
+	searcher repository.UserSearcher
+}
+
+// NewUserSearchService constructs a UserSearchService.
+func NewUserSearchService(searcher repository.UserSearcher) *UserSearchService {
+	return &UserSearchService{searcher: searcher}
+}
+
+// Search returns a page of the users matching text, best match first, and the
+// total number of matches. Within a tenant context only its members are
+// searched.
+func (s *UserSearchService) Search(ctx context.Context, text string, limit, offset int) ([]UserSearchResult, int64, error) {
+	text = strings.TrimSpace(text)
+	if n := utf8.RuneCountInString(text); n < minSearchLength || n > maxSearchLength {
+		return nil, 0, &ValidationError{Fields: map[string]string{"q": "must be between 2 and 100 characters"}}
+	}
+
+	hits, total, err := s.searcher.Search(ctx, repository.UserSearchQuery{Text: text, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	terms := repository.SearchTerms(text)
+	results := make([]UserSearchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = UserSearchResult{User: hit.User, Score: hit.Score}
+		for field, value := range map[string]string{"name": hit.User.Name, "display_name": hit.User.DisplayName, "email": hit.User.Email} {
+			if highlighted, ok := highlight(value, terms); ok {
+				if results[i].Highlights == nil {
+					results[i].Highlights = make(map[string]string)
+				}
+				results[i].Highlights[field] = highlighted
+			}
+		}
+	}
+	return results, total, nil
+}
+
+// highlight escapes value for HTML and marks every case-insensitive
+// occurrence of terms in it. It reports false if no term occurs.
+func highlight(value string, terms []string) (string, bool) {
+	runes := []rune(value)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marked := make([]bool, len(runes))
+	found := false
+	for _, term := range terms {
+		needle := []rune(term)
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == term {
+				for j := i; j < i+len(needle); j++ {
+					marked[j] = true
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			segment = "<mark>" + segment + "</mark>"
+		}
+		b.WriteString(segment)
+		i = j
+	}
+	return b.String(), true
+}
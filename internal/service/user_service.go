@@ -2,21 +2,38 @@ package service
 
 import (
 	"context"
+	"errors"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
+	"github.com/example/golang-rest-boilerplate/internal/events"
 	"github.com/example/golang-rest-boilerplate/internal/models"
 	"github.com/example/golang-rest-boilerplate/internal/repository"
 )
 
-// UserService contains business logic for user management.
+// UserManager exposes user management operations to the HTTP layer.
+type UserManager interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, id uuid.UUID) (*models.User, error)
+	Update(ctx context.Context, id uuid.UUID, name string) (*models.User, error)
+	Patch(ctx context.Context, id uuid.UUID, patch []byte) (*models.User, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+var _ UserManager = (*UserService)(nil)
+
+// UserService contains business logic for user management. Changes are
+// published as events in the transaction that makes them.
 type UserService struct {
-	repo *repository.UserRepository
+	repo repository.UserStore
+	tx   repository.Transactor
+	bus  *events.Bus
 }
 
 // NewUserService constructs a new UserService.
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserStore, tx repository.Transactor, bus *events.Bus) *UserService {
+	return &UserService{repo: repo, tx: tx, bus: bus}
 }
 
 // List retrieves all users.
@@ -36,15 +53,63 @@ func (s *UserService) Update(ctx context.Context, id uuid.UUID, name string) (*m
 		return nil, err
 	}
 
+	before := *user
 	user.Name = name
-	if err := s.repo.Update(ctx, user); err != nil {
+	if msg := validateProfileField("name", &user.Name); msg != "" {
+		return nil, &ValidationError{Fields: map[string]string{"name": msg}}
+	}
+	if err := s.save(ctx, user, &before); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to the user's profile. Identity
+// fields such as email and provider are rejected with a ValidationError.
+func (s *UserService) Patch(ctx context.Context, id uuid.UUID, patch []byte) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *user
+	if err := applyProfilePatch(user, patch); err != nil {
+		return nil, err
+	}
+	if err := s.save(ctx, user, &before); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// Delete removes a user by ID.
+// save updates user and publishes the change from before.
+func (s *UserService) save(ctx context.Context, user, before *models.User) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, user); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserUpdated{Before: before, User: user})
+	})
+}
+
+// Delete removes a user by ID. Deleting a user that does not exist succeeds.
+// Subscribers to events.UserDeleted remove the user's sessions, identities
+// and memberships, as for AccountService.Delete.
 func (s *UserService) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.repo.GetByID(ctx, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserDeleted{User: user})
+	})
 }
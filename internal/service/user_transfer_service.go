@@ -0,0 +1,454 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+)
+
+// Formats of user imports and exports.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Statuses of imported rows.
+const (
+	ImportCreated = "created"
+	ImportExists  = "exists"
+	ImportInvalid = "invalid"
+)
+
+// ImportProvider is the provider recorded for imported users.
+const ImportProvider = "import"
+
+// MaxImportRows is the largest number of rows an import may contain unless
+// its options set a limit.
+const MaxImportRows = 10000
+
+// ErrUnsupportedFormat is returned for formats other than FormatCSV and FormatNDJSON.
+var ErrUnsupportedFormat = errors.New("format must be csv or ndjson")
+
+// ErrTooManyRows is returned when an import has more rows than its limit.
+var ErrTooManyRows = errors.New("import has too many rows")
+
+// exportColumns are the CSV columns of an export. Imports read the columns of
+// importFields and ignore the rest, so exports can be imported again.
+var exportColumns = []string{"id", "email", "name", "display_name", "avatar_url", "locale", "timezone", "role", "status", "provider", "created_at"}
+
+var importFields = []string{"email", "name", "display_name", "avatar_url", "locale", "timezone", "password"}
+
+// ImportOptions controls an import. With DryRun the rows are only validated.
+// MaxRows limits the rows of the file, and zero means MaxImportRows.
+type ImportOptions struct {
+	DryRun  bool
+	MaxRows int
+}
+
+// ImportRecord is one user to import.
+type ImportRecord struct {
+	Email       string `json:"email"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Locale      string `json:"locale"`
+	Timezone    string `json:"timezone"`
+	Password    string `json:"password"`
+}
+
+// ImportResult is the outcome of one row. Line is the row's line in the file.
+type ImportResult struct {
+	Line   int               `json:"line"`
+	Email  string            `json:"email,omitempty"`
+	Status string            `json:"status"`
+	UserID *uuid.UUID        `json:"user_id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ImportReport summarizes an import. In a dry run nothing is written, and
+// rows reported as created are the ones that would be.
+type ImportReport struct {
+	DryRun   bool           `json:"dry_run"`
+	Created  int            `json:"created"`
+	Existing int            `json:"existing"`
+	Invalid  int            `json:"invalid"`
+	Rows     []ImportResult `json:"rows"`
+}
+
+// UserTransferService imports users in bulk and exports them.
+type UserTransferService struct {
+	users repository.UserStore
+	tx    repository.Transactor
+	audit *AuditService
+	bus   *events.Bus
+}
+
+// NewUserTransferService constructs a UserTransferService.
+func NewUserTransferService(users repository.UserStore, tx repository.Transactor, audit *AuditService, bus *events.Bus) *UserTransferService {
+	return &UserTransferService{users: users, tx: tx, audit: audit, bus: bus}
+}
+
+// Import creates a user for every valid row of r, read in format. Rows are
+// matched to existing users by email, so importing the same file twice
+// creates each user once. Each row is created in its own transaction, and
+// in a dry run nothing is written. Rows that cannot be parsed or validated are
+// reported with their errors; only an unreadable file or one with too many
+// rows fails the whole import.
+func (s *UserTransferService) Import(ctx context.Context, format string, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	var next func() (int, *ImportRecord, error)
+	switch format {
+	case FormatCSV:
+		reader, err := newCSVImportReader(r)
+		if err != nil {
+			return nil, err
+		}
+		next = reader.next
+	case FormatNDJSON:
+		next = newNDJSONImportReader(r).next
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	maxRows := opts.MaxRows
+	if maxRows <= 0 {
+		maxRows = MaxImportRows
+	}
+	dryRun := opts.DryRun
+	report := &ImportReport{DryRun: dryRun, Rows: []ImportResult{}}
+	seen := make(map[string]int)
+	for {
+		line, record, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if len(report.Rows) == maxRows {
+			return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyRows, maxRows)
+		}
+		var rowErr *importRowError
+		if errors.As(err, &rowErr) {
+			report.add(ImportResult{Line: line, Status: ImportInvalid, Errors: map[string]string{"row": rowErr.msg}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := ImportResult{Line: line, Email: record.Email}
+		user, fields := importUser(record)
+		if user != nil {
+			result.Email = user.Email
+			if first, ok := seen[user.Email]; ok {
+				fields = map[string]string{"email": fmt.Sprintf("duplicates line %d", first)}
+			} else {
+				seen[user.Email] = line
+			}
+		}
+		if len(fields) > 0 {
+			result.Status, result.Errors = ImportInvalid, fields
+			report.add(result)
+			continue
+		}
+
+		existing, err := s.users.GetByEmail(ctx, user.Email)
+		switch {
+		case err == nil:
+			result.Status, result.UserID = ImportExists, &existing.ID
+			report.add(result)
+			continue
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, err
+		}
+
+		if !dryRun {
+			created, err := s.create(ctx, user, record.Password)
+			if err != nil {
+				return nil, err
+			}
+			if !created {
+				result.Status = ImportExists
+				report.add(result)
+				continue
+			}
+			result.UserID = &user.ID
+		}
+		result.Status = ImportCreated
+		report.add(result)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	err := s.audit.Record(ctx, AuditEntry{
+		Action:  AuditUsersImported,
+		Details: map[string]interface{}{"format": format, "created": report.Created, "existing": report.Existing, "invalid": report.Invalid},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// create inserts user, hashing password if one was given. It reports false
+// when the email was taken since it was checked.
+func (s *UserTransferService) create(ctx context.Context, user *models.User, password string) (bool, error) {
+	if password != "" {
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return false, err
+		}
+		user.PasswordHash = string(passwordHash)
+	}
+
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.users.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.bus.Publish(ctx, events.UserRegistered{User: user, Provider: user.Provider})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *ImportReport) add(result ImportResult) {
+	switch result.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportExists:
+		r.Existing++
+	case ImportInvalid:
+		r.Invalid++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// importUser validates record and returns the user it describes, or the
+// errors of its fields. The user is nil when the email is unusable.
+func importUser(record *ImportRecord) (*models.User, map[string]string) {
+	fields := make(map[string]string)
+	email := strings.ToLower(strings.TrimSpace(record.Email))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		fields["email"] = "must be a valid email address"
+	} else if msg := maxLength(email, 255); msg != "" {
+		fields["email"] = msg
+	}
+	if record.Password != "" && len(record.Password) < 8 {
+		fields["password"] = "must be at least 8 characters"
+	}
+
+	user := &models.User{
+		Email:       email,
+		Name:        strings.TrimSpace(record.Name),
+		DisplayName: strings.TrimSpace(record.DisplayName),
+		AvatarURL:   strings.TrimSpace(record.AvatarURL),
+		Locale:      strings.TrimSpace(record.Locale),
+		Timezone:    strings.TrimSpace(record.Timezone),
+		Provider:    ImportProvider,
+	}
+	for key, field := range profileFields {
+		if msg := validateProfileField(key, field(user)); msg != "" {
+			fields[key] = msg
+		}
+	}
+	if _, ok := fields["email"]; ok {
+		return nil, fields
+	}
+	return user, fields
+}
+
+// importRowError rejects a single row that could not be parsed.
+type importRowError struct {
+	msg string
+}
+
+func (e *importRowError) Error() string { return e.msg }
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVImportReader reads the header row, which must name an email column.
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &ValidationError{Fields: map[string]string{"file": "is empty"}}
+	}
+	if err != nil {
+		return nil, &ValidationError{Fields: map[string]string{"file": err.Error()}}
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if containsImportField(name) {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, &ValidationError{Fields: map[string]string{"file": "header must include an email column"}}
+	}
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvImportReader) next() (int, *ImportRecord, error) {
+	row, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+		return parseErr.StartLine, nil, &importRowError{msg: "has the wrong number of fields"}
+	}
+	if err != nil {
+		return 0, nil, &ValidationError{Fields: map[string]string{"file": err.Error()}}
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	value := func(name string) string {
+		if i, ok := r.columns[name]; ok {
+			return csvUnescape(row[i])
+		}
+		return ""
+	}
+	return line, &ImportRecord{
+		Email:       value("email"),
+		Name:        value("name"),
+		DisplayName: value("display_name"),
+		AvatarURL:   value("avatar_url"),
+		Locale:      value("locale"),
+		Timezone:    value("timezone"),
+		Password:    value("password"),
+	}, nil
+}
+
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+// next returns the record on the next non-blank line. Fields other than those
+// of ImportRecord are ignored.
+func (r *ndjsonImportReader) next() (int, *ImportRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record ImportRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return r.line, nil, &importRowError{msg: "must be a JSON object with string fields"}
+		}
+		return r.line, &record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return 0, nil, &ValidationError{Fields: map[string]string{"file": err.Error()}}
+	}
+	return 0, nil, io.EOF
+}
+
+func containsImportField(name string) bool {
+	for _, field := range importFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Export writes every user to w in format, one at a time, so the users are
+// never all held in memory. CSV exports have the columns of exportColumns;
+// NDJSON exports have one user object per line. Erased users and password
+// hashes are never exported; suspended and deactivated users are, with their
+// status.
+func (s *UserTransferService) Export(ctx context.Context, format string, w io.Writer) error {
+	var write func(*models.User) error
+	var flush func() error
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return err
+		}
+		write = func(user *models.User) error {
+			return writer.Write([]string{
+				user.ID.String(), csvEscape(user.Email), csvEscape(user.Name), csvEscape(user.DisplayName),
+				csvEscape(user.AvatarURL), csvEscape(user.Locale), csvEscape(user.Timezone),
+				user.Role, user.Status, user.Provider, user.CreatedAt.UTC().Format(time.RFC3339),
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		write = func(user *models.User) error { return encoder.Encode(user) }
+		flush = buffered.Flush
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	count := 0
+	err := s.users.Each(ctx, func(user *models.User) error {
+		if user.Status == models.StatusErased {
+			return nil
+		}
+		count++
+		return write(user)
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, AuditEntry{
+		Action:  AuditUsersExported,
+		Details: map[string]interface{}{"format": format, "count": count},
+	})
+}
+
+// csvEscape prefixes value with a quote if it starts with a character that
+// spreadsheets read as the start of a formula, so that opening an export
+// cannot run a formula planted in a user's profile.
+func csvEscape(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUnescape reverses csvEscape, so exports can be imported again.
+func csvUnescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && csvEscape(value[1:]) != value[1:] {
+		return value[1:]
+	}
+	return value
+}
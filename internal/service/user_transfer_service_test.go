@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func TestUserImportExport(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:transfer?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+
+	ctx := context.Background()
+	users := repository.NewUserRepository(database)
+	audit := service.NewAuditService(repository.NewAuditRepository(database))
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	audit.Subscribe(bus)
+	transfers := service.NewUserTransferService(users, repository.NewGormTransactor(database), audit, bus)
+
+	file := "Email,Name,Locale,Timezone,Password\n" +
+		"Ada@Example.com,Ada,en-gb,Europe/London,Password123\n" +
+		"not-an-email,Nobody,,,\n" +
+		"ada@example.com,Ada Again,,,\n" +
+		"bob@example.com,Bob,xx-not-a-locale-tag,,\n" +
+		"carol@example.com,Carol\n" +
+		"dan@example.com,Dan,,Mars/Olympus,\n" +
+		"erin@example.com,Erin,,,\n"
+
+	// A dry run validates every row and writes nothing.
+	report, err := transfers.Import(ctx, service.FormatCSV, strings.NewReader(file), service.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Created)
+	require.Equal(t, 5, report.Invalid)
+	require.Len(t, report.Rows, 7)
+	require.Equal(t, 2, report.Rows[0].Line)
+	require.Equal(t, "ada@example.com", report.Rows[0].Email)
+	require.Contains(t, report.Rows[1].Errors, "email")
+	require.Equal(t, "duplicates line 2", report.Rows[2].Errors["email"])
+	require.Contains(t, report.Rows[3].Errors, "locale")
+	require.Contains(t, report.Rows[4].Errors, "row")
+	require.Contains(t, report.Rows[5].Errors, "timezone")
+	all, err := users.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	report, err = transfers.Import(ctx, service.FormatCSV, strings.NewReader(file), service.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Created)
+	require.NotNil(t, report.Rows[0].UserID)
+	ada, err := users.GetByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	require.Equal(t, "en-GB", ada.Locale)
+	require.Equal(t, service.ImportProvider, ada.Provider)
+	require.NotEmpty(t, ada.PasswordHash)
+
+	// Importing again matches the users by email.
+	report, err = transfers.Import(ctx, service.FormatCSV, strings.NewReader(file), service.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Created)
+	require.Equal(t, 2, report.Existing)
+
+	report, err = transfers.Import(ctx, service.FormatNDJSON, strings.NewReader(`{"email":"frank@example.com","name":"Frank"}
+
+{"email": 42}
+{"email":"ada@example.com","name":"Ada","role":"admin"}
+`), service.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 1, report.Existing)
+	require.Equal(t, 1, report.Invalid)
+	require.Equal(t, 3, report.Rows[1].Line)
+
+	_, err = transfers.Import(ctx, "xml", strings.NewReader(""), service.ImportOptions{})
+	require.ErrorIs(t, err, service.ErrUnsupportedFormat)
+	_, err = transfers.Import(ctx, service.FormatCSV, strings.NewReader("name\nAda\n"), service.ImportOptions{})
+	require.Error(t, err)
+
+	file = "email,name\ngrace@example.com,\"=HYPERLINK(\"\"https://example.org\"\")\"\n"
+	_, err = transfers.Import(ctx, service.FormatCSV, strings.NewReader(file+"heidi@example.com,Heidi\n"), service.ImportOptions{DryRun: true, MaxRows: 1})
+	require.ErrorIs(t, err, service.ErrTooManyRows)
+	report, err = transfers.Import(ctx, service.FormatCSV, strings.NewReader(file), service.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Created)
+
+	// Erased users are left out of exports.
+	frank, err := users.GetByEmail(ctx, "frank@example.com")
+	require.NoError(t, err)
+	frank.Status = models.StatusErased
+	require.NoError(t, users.Update(ctx, frank))
+
+	var out bytes.Buffer
+	require.NoError(t, transfers.Export(ctx, service.FormatCSV, &out))
+	rows, err := csv.NewReader(bytes.NewReader(out.Bytes())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, "id", rows[0][0])
+	require.NotContains(t, out.String(), ada.PasswordHash)
+	require.NotContains(t, out.String(), "frank@example.com")
+	for _, row := range rows[1:] {
+		if row[1] == "grace@example.com" {
+			require.Equal(t, `'=HYPERLINK("https://example.org")`, row[2])
+		}
+	}
+
+	// The escaped formula is read back as it was written.
+	report, err = transfers.Import(ctx, service.FormatCSV, bytes.NewReader(out.Bytes()), service.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Existing)
+	grace, err := users.GetByEmail(ctx, "grace@example.com")
+	require.NoError(t, err)
+	require.Equal(t, `=HYPERLINK("https://example.org")`, grace.Name)
+
+	// Exports can be imported again.
+	out.Reset()
+	require.NoError(t, transfers.Export(ctx, service.FormatNDJSON, &out))
+	require.Equal(t, 3, strings.Count(out.String(), "\n"))
+	report, err = transfers.Import(ctx, service.FormatNDJSON, &out, service.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Existing)
+}
@@ -0,0 +1,448 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/pkg/sealer"
+)
+
+// Webhook event types.
+const (
+	WebhookUserCreated       = "user.created"
+	WebhookUserUpdated       = "user.updated"
+	WebhookUserDeleted       = "user.deleted"
+	WebhookUserStatusChanged = "user.status_changed"
+	WebhookUserErased        = "user.erased"
+)
+
+// WebhookEventTypes lists the event types endpoints can subscribe to.
+var WebhookEventTypes = []string{WebhookUserCreated, WebhookUserUpdated, WebhookUserDeleted, WebhookUserStatusChanged, WebhookUserErased}
+
+// WebhookDeliverJob is the job type that sends one webhook delivery.
+const WebhookDeliverJob = "webhooks.deliver"
+
+// Headers set on webhook requests.
+const (
+	WebhookSignatureHeader = "Webhook-Signature"
+	WebhookEventIDHeader   = "Webhook-Id"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookDeliveryHeader  = "Webhook-Delivery"
+)
+
+// maxWebhookResponseBody bounds how much of an endpoint's response is kept in the delivery history.
+const maxWebhookResponseBody = 1024
+
+// WebhookInput holds the editable fields of a webhook endpoint.
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+// webhookEvent is the JSON body posted to endpoints.
+type webhookEvent struct {
+	ID        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookDeliveryJob struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+// WebhookService manages webhook endpoints and delivers events to them.
+type WebhookService struct {
+	store       repository.WebhookStore
+	queue       *jobs.Queue
+	tx          repository.Transactor
+	sealer      *sealer.Sealer
+	client      *http.Client
+	maxAttempts int
+}
+
+// NewWebhookService constructs a WebhookService. Endpoint secrets are encrypted
+// with TOKEN_ENCRYPTION_KEY, falling back to the JWT secret when unset.
+func NewWebhookService(store repository.WebhookStore, queue *jobs.Queue, tx repository.Transactor, cfg *config.Config) (*WebhookService, error) {
+	key := cfg.TokenEncryptionKey
+	if key == "" {
+		key = cfg.JWTSecret
+	}
+	s, err := sealer.New(key, "webhook-secret")
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts := cfg.WebhookMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = jobs.DefaultMaxAttempts
+	}
+	return &WebhookService{
+		store:  store,
+		queue:  queue,
+		tx:     tx,
+		sealer: s,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.WebhookTimeoutSeconds) * time.Second,
+			// A redirect is reported as a failed delivery rather than followed.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// RegisterJobs makes runner deliver queued webhooks.
+func (s *WebhookService) RegisterJobs(runner *jobs.Runner) {
+	jobs.Handle(runner, WebhookDeliverJob, func(ctx context.Context, job webhookDeliveryJob) error {
+		return s.Deliver(ctx, job.DeliveryID)
+	})
+}
+
+// Create registers an endpoint and returns it with its signing secret, which
+// is not retrievable later.
+func (s *WebhookService) Create(ctx context.Context, input WebhookInput) (*models.WebhookEndpoint, string, error) {
+	endpoint := &models.WebhookEndpoint{Active: true}
+	if err := applyWebhookInput(endpoint, input); err != nil {
+		return nil, "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := "whsec_" + token
+	if endpoint.EncryptedSecret, err = s.sealer.Seal([]byte(secret)); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.store.CreateEndpoint(ctx, endpoint); err != nil {
+		return nil, "", err
+	}
+	return endpoint, secret, nil
+}
+
+// List returns all endpoints.
+func (s *WebhookService) List(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	return s.store.ListEndpoints(ctx)
+}
+
+// Get returns an endpoint by ID.
+func (s *WebhookService) Get(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	return s.store.GetEndpoint(ctx, id)
+}
+
+// Update replaces an endpoint's URL, description and subscriptions, and
+// enables or disables it when input.Active is set.
+func (s *WebhookService) Update(ctx context.Context, id uuid.UUID, input WebhookInput) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.store.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWebhookInput(endpoint, input); err != nil {
+		return nil, err
+	}
+	if err := s.store.UpdateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// Delete removes an endpoint and its delivery history. Queued deliveries to it are dropped.
+func (s *WebhookService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.store.DeleteEndpoint(ctx, id)
+}
+
+// Deliveries returns an endpoint's delivery history, newest first, and the total number of deliveries.
+func (s *WebhookService) Deliveries(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	if _, err := s.store.GetEndpoint(ctx, endpointID); err != nil {
+		return nil, 0, err
+	}
+	return s.store.ListDeliveries(ctx, endpointID, limit, offset)
+}
+
+// Redeliver queues the event of a past delivery to be sent again as a new
+// delivery. The event ID is unchanged, so receivers can deduplicate it.
+func (s *WebhookService) Redeliver(ctx context.Context, endpointID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	previous, err := s.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if previous.EndpointID != endpointID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	delivery := &models.WebhookDelivery{
+		EndpointID: previous.EndpointID,
+		EventID:    previous.EventID,
+		EventType:  previous.EventType,
+		Payload:    previous.Payload,
+	}
+	if err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.enqueue(ctx, delivery)
+	}); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Subscribe queues webhooks for the user events published on bus. The
+// subscribers run synchronously, so deliveries commit with their change.
+func (s *WebhookService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, e events.UserRegistered) error {
+		return s.Publish(ctx, WebhookUserCreated, map[string]interface{}{"user": e.User})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, e events.UserUpdated) error {
+		return s.Publish(ctx, WebhookUserUpdated, map[string]interface{}{"user": e.User})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, e events.UserStatusChanged) error {
+		return s.Publish(ctx, WebhookUserStatusChanged, map[string]interface{}{"user": e.User, "previous_status": e.From})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, e events.UserDeleted) error {
+		return s.Publish(ctx, WebhookUserDeleted, map[string]interface{}{"user": e.User})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, e events.UserErased) error {
+		if err := s.redactDeliveries(ctx, e.User.ID); err != nil {
+			return err
+		}
+		return s.Publish(ctx, WebhookUserErased, map[string]interface{}{"user": map[string]interface{}{"id": e.User.ID}})
+	})
+}
+
+// redactDeliveries replaces the data of every stored delivery mentioning the
+// user, sent or not, so that erased personal data does not linger in the
+// outbox. Receivers of redacted deliveries get {"redacted": true} as data.
+func (s *WebhookService) redactDeliveries(ctx context.Context, userID uuid.UUID) error {
+	deliveries, err := s.store.ListDeliveriesContaining(ctx, userID.String())
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		var event webhookEvent
+		if err := json.Unmarshal([]byte(deliveries[i].Payload), &event); err != nil {
+			return err
+		}
+		event.Data = map[string]interface{}{"redacted": true}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		deliveries[i].Payload = string(payload)
+		if err := s.store.UpdateDelivery(ctx, &deliveries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish queues an event for every active endpoint subscribed to eventType.
+// Called within a transaction, the deliveries commit or roll back with the
+// change that raised the event.
+func (s *WebhookService) Publish(ctx context.Context, eventType string, data interface{}) error {
+	endpoints, err := s.store.ListActiveEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	event := webhookEvent{ID: uuid.New(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(eventType) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		if err := s.enqueue(ctx, &models.WebhookDelivery{
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  eventType,
+			Payload:    string(payload),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WebhookService) enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Status = models.WebhookDeliveryPending
+	if err := s.store.CreateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	return s.queue.Enqueue(ctx, WebhookDeliverJob, webhookDeliveryJob{DeliveryID: delivery.ID}, jobs.MaxAttempts(s.maxAttempts))
+}
+
+// Deliver posts a delivery to its endpoint and records the outcome. A non-2xx
+// response or transport error is returned so the job is retried; after the
+// last attempt the delivery is marked failed.
+func (s *WebhookService) Deliver(ctx context.Context, deliveryID uuid.UUID) error {
+	delivery, err := s.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if delivery.Status != models.WebhookDeliveryPending {
+		return nil
+	}
+	endpoint, err := s.store.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	var deliveryErr error
+	if endpoint.Active {
+		deliveryErr = s.post(ctx, endpoint, delivery)
+	} else {
+		deliveryErr = jobs.Permanent(errors.New("endpoint is disabled"))
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastError = ""
+	var permanent bool
+	switch {
+	case deliveryErr == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= s.maxAttempts || jobs.IsPermanent(deliveryErr):
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = deliveryErr.Error()
+		permanent = true
+	default:
+		delivery.LastError = deliveryErr.Error()
+	}
+
+	if err := s.store.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		return err
+	}
+	if permanent {
+		return jobs.Permanent(deliveryErr)
+	}
+	return deliveryErr
+}
+
+// post sends delivery to endpoint, recording the response on delivery.
+func (s *WebhookService) post(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) error {
+	secret, err := s.sealer.Open(endpoint.EncryptedSecret)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("open endpoint secret: %w", err))
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventIDHeader, delivery.EventID.String())
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookSignatureHeader, "t="+strconv.FormatInt(timestamp, 10)+",v1="+WebhookSignature(string(secret), timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		delivery.ResponseStatus, delivery.ResponseBody = 0, ""
+		return err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	delivery.ResponseStatus = resp.StatusCode
+	delivery.ResponseBody = strings.ToValidUTF8(string(responseBody), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookSignature returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with secret, as sent in the v1 field of the Webhook-Signature header.
+// Receivers should recompute it and reject stale timestamps to prevent replays.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func applyWebhookInput(endpoint *models.WebhookEndpoint, input WebhookInput) error {
+	fields := make(map[string]string)
+
+	endpoint.URL = strings.TrimSpace(input.URL)
+	if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fields["url"] = "must be an absolute http or https URL"
+	} else if len(endpoint.URL) > 2048 {
+		fields["url"] = "must be at most 2048 characters"
+	}
+
+	endpoint.Description = strings.TrimSpace(input.Description)
+	if msg := maxLength(endpoint.Description, 255); msg != "" {
+		fields["description"] = msg
+	}
+
+	events := make([]string, 0, len(input.Events))
+	seen := make(map[string]bool)
+	for _, event := range input.Events {
+		if !containsWebhookEvent(event) {
+			fields["events"] = "unknown event type " + strconv.Quote(event)
+			break
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	if len(input.Events) == 0 {
+		fields["events"] = "must subscribe to at least one event type"
+	}
+	endpoint.Events = events
+
+	if input.Active != nil {
+		endpoint.Active = *input.Active
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func containsWebhookEvent(event string) bool {
+	for _, known := range WebhookEventTypes {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
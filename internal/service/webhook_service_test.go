@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/example/golang-rest-boilerplate/internal/config"
+	"github.com/example/golang-rest-boilerplate/internal/db"
+	"github.com/example/golang-rest-boilerplate/internal/events"
+	"github.com/example/golang-rest-boilerplate/internal/jobs"
+	"github.com/example/golang-rest-boilerplate/internal/models"
+	"github.com/example/golang-rest-boilerplate/internal/repository"
+	"github.com/example/golang-rest-boilerplate/internal/service"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open("file:webhooks?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(database))
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	cfg := &config.Config{JWTSecret: "secret", TokenExpireMinutes: 60, WebhookMaxAttempts: 3, WebhookTimeoutSeconds: 5}
+	jobStore := repository.NewJobRepository(database)
+	transactor := repository.NewGormTransactor(database)
+	webhooks, err := service.NewWebhookService(repository.NewWebhookRepository(database), jobs.NewQueue(jobStore), transactor, cfg)
+	require.NoError(t, err)
+	bus := events.NewBus(events.Config{AfterCommit: repository.AfterCommit})
+	webhooks.Subscribe(bus)
+	users := repository.NewUserRepository(database)
+	authService := service.NewAuthService(users, repository.NewIdentityRepository(database), repository.NewLoginCodeRepository(database), repository.NewSessionRepository(database), repository.NewOrganizationRepository(database), transactor, service.NewAuditService(repository.NewAuditRepository(database)), bus, cfg)
+
+	var requests int32
+	received := make(chan map[string]interface{}, 4)
+	var secret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var timestamp int64
+		var signature string
+		for _, part := range strings.Split(r.Header.Get(service.WebhookSignatureHeader), ",") {
+			if v, ok := strings.CutPrefix(part, "t="); ok {
+				timestamp, _ = strconv.ParseInt(v, 10, 64)
+			} else if v, ok := strings.CutPrefix(part, "v1="); ok {
+				signature = v
+			}
+		}
+		if signature != service.WebhookSignature(secret, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Fail the first request to exercise retries.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event map[string]interface{}
+		_ = json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer server.Close()
+
+	_, _, err = webhooks.Create(ctx, service.WebhookInput{URL: "ftp://example.com", Events: []string{"user.exploded"}})
+	var validationErr *service.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Contains(t, validationErr.Fields, "url")
+	require.Contains(t, validationErr.Fields, "events")
+
+	endpoint, secret, err := webhooks.Create(ctx, service.WebhookInput{URL: server.URL, Events: []string{service.WebhookUserCreated}})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "whsec_"))
+
+	// Events raised by a transaction that rolls back are never delivered.
+	rollback := errors.New("rollback")
+	require.ErrorIs(t, transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, webhooks.Publish(ctx, service.WebhookUserCreated, map[string]interface{}{"user": "ghost"}))
+		return rollback
+	}), rollback)
+
+	user, err := authService.Register(ctx, "Gail", "gail@example.com", "Password123")
+	require.NoError(t, err)
+	_, err = service.NewUserService(users, transactor, bus).Update(ctx, user.ID, "Gail G")
+	require.NoError(t, err)
+
+	runner := jobs.NewRunner(jobStore, jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond, RetryBaseDelay: 10 * time.Millisecond})
+	webhooks.RegisterJobs(runner)
+	runner.Start()
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		require.NoError(t, runner.Stop(stopCtx))
+	}()
+
+	var event map[string]interface{}
+	select {
+	case event = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	require.Equal(t, service.WebhookUserCreated, event["type"])
+	require.Equal(t, user.ID.String(), event["data"].(map[string]interface{})["user"].(map[string]interface{})["id"])
+
+	var deliveries []models.WebhookDelivery
+	require.Eventually(t, func() bool {
+		deliveries, _, err = webhooks.Deliveries(ctx, endpoint.ID, 10, 0)
+		return err == nil && len(deliveries) == 1 && deliveries[0].Status == models.WebhookDeliverySucceeded
+	}, 5*time.Second, 20*time.Millisecond, "only the committed user.created event is delivered")
+	require.Equal(t, 2, deliveries[0].Attempts)
+	require.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+
+	redelivery, err := webhooks.Redeliver(ctx, endpoint.ID, deliveries[0].ID)
+	require.NoError(t, err)
+	select {
+	case event = <-received:
+		require.Equal(t, deliveries[0].EventID.String(), event["id"], "redelivery keeps the event ID")
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not redelivered")
+	}
+	require.NotEqual(t, deliveries[0].ID, redelivery.ID)
+}
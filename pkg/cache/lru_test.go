@@ -0,0 +1,72 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/pkg/cache"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("get returns what was set", func(t *testing.T) {
+		c := cache.NewLRU(2)
+		require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		value, ok, err := c.Get(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("1"), value)
+
+		require.NoError(t, c.Set(ctx, "a", []byte("2"), time.Minute))
+		value, _, _ = c.Get(ctx, "a")
+		require.Equal(t, []byte("2"), value)
+
+		_, ok, err = c.Get(ctx, "missing")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Equal(t, cache.Stats{Hits: 2, Misses: 1, Size: 1}, c.Stats())
+	})
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		c := cache.NewLRU(2)
+		require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		require.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+		_, _, _ = c.Get(ctx, "a")
+		require.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+		_, ok, _ := c.Get(ctx, "b")
+		require.False(t, ok)
+		_, ok, _ = c.Get(ctx, "a")
+		require.True(t, ok)
+		_, ok, _ = c.Get(ctx, "c")
+		require.True(t, ok)
+		require.Equal(t, uint64(1), c.Stats().Evictions)
+		require.Equal(t, 2, c.Stats().Size)
+	})
+
+	t.Run("expired entries are dropped on access", func(t *testing.T) {
+		c := cache.NewLRU(2)
+		require.NoError(t, c.Set(ctx, "a", []byte("1"), -time.Second))
+		_, ok, err := c.Get(ctx, "a")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Equal(t, 0, c.Stats().Size)
+
+		// Setting again refreshes the expiry.
+		require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		_, ok, _ = c.Get(ctx, "a")
+		require.True(t, ok)
+	})
+
+	t.Run("delete ignores missing keys", func(t *testing.T) {
+		c := cache.NewLRU(0)
+		require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		require.NoError(t, c.Delete(ctx, "a", "missing"))
+		_, ok, _ := c.Get(ctx, "a")
+		require.False(t, ok)
+	})
+}
@@ -1,6 +1,10 @@
 package response
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
 
 // JSON writes a standardized JSON response.
 func JSON(c *gin.Context, status int, data interface{}) {
@@ -11,3 +15,8 @@ func JSON(c *gin.Context, status int, data interface{}) {
 func Error(c *gin.Context, status int, message string) {
 	c.AbortWithStatusJSON(status, gin.H{"error": message})
 }
+
+// ValidationError writes a 422 response listing the rejected fields.
+func ValidationError(c *gin.Context, fields map[string]string) {
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed", "fields": fields})
+}
@@ -0,0 +1,54 @@
+package sealer_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/golang-rest-boilerplate/pkg/sealer"
+)
+
+func TestSealer(t *testing.T) {
+	s, err := sealer.New("secret", "test")
+	require.NoError(t, err)
+
+	sealed, err := s.Seal([]byte("hello"))
+	require.NoError(t, err)
+	opened, err := s.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(opened))
+
+	again, err := s.Seal([]byte("hello"))
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again, "every seal uses a fresh nonce")
+
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	otherPurpose, err := sealer.New("secret", "other")
+	require.NoError(t, err)
+	otherSecret, err := sealer.New("other", "test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		sealer *sealer.Sealer
+		value  string
+	}{
+		{"tampered", s, tampered},
+		{"truncated", s, sealed[:8]},
+		{"not base64", s, "not base64!"},
+		{"empty", s, ""},
+		{"other purpose", otherPurpose, sealed},
+		{"other secret", otherSecret, sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.sealer.Open(tt.value)
+			require.ErrorIs(t, err, sealer.ErrInvalidCiphertext)
+		})
+	}
+}